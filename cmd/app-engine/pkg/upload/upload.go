@@ -15,7 +15,6 @@
 package upload
 
 import (
-	"archive/zip"
 	"context"
 	"fmt"
 	"io"
@@ -24,15 +23,18 @@ import (
 	"path/filepath"
 
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/internal/archive"
 )
 
 // ZipDirectory creates a zip archive of files and folders within the specified directory.
 // The directory itself is not included.
 func ZipDirectory(sourceDir string, out io.Writer) error {
-	zipWriter := zip.NewWriter(out)
-	defer zipWriter.Close()
+	zipWriter, err := archive.NewWriter(out, archive.Zip)
+	if err != nil {
+		return err
+	}
 
-	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
 		// Propagate any errors encountered during directory traversal.
 		if err != nil {
 			return err
@@ -43,47 +45,25 @@ func ZipDirectory(sourceDir string, out io.Writer) error {
 			return nil
 		}
 
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-
 		relPath, err := filepath.Rel(sourceDir, path)
 		if err != nil {
 			return err
 		}
-
-		// Use forward slashes for zip file paths (cross-platform compatibility).
-		header.Name = filepath.ToSlash(relPath)
-
-		// A trailing slash indicates that this file is a directory and should have no data.
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate
-		}
-
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
-		}
-
-		// No content to write for a directory
-		if info.IsDir() {
+		if relPath == "." {
 			return nil
 		}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return err
+		// Use forward slashes for zip file paths (cross-platform compatibility).
+		if info.IsDir() {
+			return zipWriter.AddDir(info, filepath.ToSlash(relPath))
 		}
-		defer file.Close()
-
-		_, err = io.Copy(writer, file)
-		return err
+		return zipWriter.AddFile(path, filepath.ToSlash(relPath))
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return zipWriter.Close()
 }
 
 // ToGCSZipped uploads a zipped folder to Google Cloud Storage.
@@ -0,0 +1,56 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	deploy "cloud.google.com/go/deploy/apiv1"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/apply"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+var applyFlags config.ApplyConfiguration
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update the Cloud Deploy resources of a YAML file, as gcloud deploy apply does",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		cdClient, err := deploy.NewCloudDeployClient(ctx, option.WithUserAgent(userAgent))
+		if err != nil {
+			return err
+		}
+		defer cdClient.Close()
+
+		return apply.Apply(ctx, cdClient, &applyFlags)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVar(&applyFlags.File, "file", "", "The path of the YAML file declaring the resources to apply")
+	applyCmd.Flags().StringVar(&applyFlags.Region, "region", "", "The cloud region of the resources")
+	applyCmd.Flags().StringVar(&applyFlags.ProjectId, "project-id", "", "The GCP project id")
+	applyCmd.Flags().BoolVar(&applyFlags.DryRun, "dry-run", false, "Print the changes and validate them without applying them")
+	applyCmd.Flags().StringVar(&userAgent, "google-apis-user-agent", "", "The user-agent to be applied when calling Google APIs")
+
+	applyCmd.MarkFlagRequired("file")
+	applyCmd.MarkFlagRequired("region")
+	applyCmd.MarkFlagRequired("project-id")
+}
@@ -0,0 +1,403 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	deploy "cloud.google.com/go/deploy/apiv1"
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Apply creates the resources of the file that do not exist, and updates the fields written in the
+// file that differ from the existing resources, in the order of the file. The fields that are not
+// written in the file are left unchanged. With flags.DryRun, the changes are only validated.
+func Apply(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.ApplyConfiguration) error {
+	resources, err := ReadResources(flags.File, flags.ProjectId, flags.Region)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if err := applyResource(ctx, cdClient, resource, flags.DryRun); err != nil {
+			return fmt.Errorf("failed to apply %s %s: %w", resource.Kind, resource.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyResource(ctx context.Context, cdClient *deploy.CloudDeployClient, resource *Resource, dryRun bool) error {
+	suffix := ""
+	if dryRun {
+		suffix = " (dry run)"
+	}
+
+	current, err := getResource(ctx, cdClient, resource)
+	if status.Code(err) == codes.NotFound {
+		empty := resource.Message.ProtoReflect().Type().New().Interface()
+		fmt.Printf("Creating %s %s%s... \n%s", resource.Kind, resource.Name, suffix, formatChanges(changedFields(empty, resource.Message, resource.Fields)))
+		if err := createResource(ctx, cdClient, resource, dryRun); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s %s \n", done(dryRun, "Created"), resource.Kind, resource.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("err getting %s: %w", resource.Name, err)
+	}
+
+	changes := changedFields(current, resource.Message, resource.Fields)
+	if len(changes) == 0 {
+		fmt.Printf("%s %s is unchanged \n", resource.Kind, resource.Name)
+		return nil
+	}
+	fmt.Printf("Updating %s %s%s... \n%s", resource.Kind, resource.Name, suffix, formatChanges(changes))
+	if err := updateResource(ctx, cdClient, resource, updateMask(changes), dryRun); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s %s \n", done(dryRun, "Updated"), resource.Kind, resource.Name)
+	return nil
+}
+
+// done returns the message of a change that was applied, or only validated with dryRun.
+func done(dryRun bool, action string) string {
+	if dryRun {
+		return "Validated the change (dry run), not " + strings.ToLower(action)
+	}
+	return action
+}
+
+// fieldChange is a field of the desired resource whose value differs from the current resource.
+type fieldChange struct {
+	path    string // ex: serial_pipeline.stages
+	current string // ex: ["staging"], or "" if the field is not set in the current resource
+	desired string // ex: ["staging", "prod"]
+}
+
+// changedFields returns the fields of the desired resource that are set or written in the file,
+// as listed by written, and whose value differs from the current resource. A field written with its
+// zero value, such as requireApproval: false or labels: {}, is compared like any other. The fields
+// that are only set in the current resource, such as the defaults of the server, are not compared,
+// nor are the output only fields, the etag and the name. The fields of a message set in both
+// resources are compared one by one, while lists and maps are compared as a whole, by the fields
+// set in their elements.
+func changedFields(current, desired proto.Message, written map[string]bool) []fieldChange {
+	return messageChanges("", current.ProtoReflect(), desired.ProtoReflect(), written)
+}
+
+func messageChanges(prefix string, current, desired protoreflect.Message, written map[string]bool) []fieldChange {
+	var changes []fieldChange
+	fields := desired.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+		if !(desired.Has(fd) || written[path]) || isOutputOnly(fd) || (prefix == "" && fd.Name() == "name") {
+			continue
+		}
+		if !desired.Has(fd) && !current.Has(fd) {
+			continue
+		}
+		if current.Has(fd) && desired.Has(fd) && isNestedMessage(fd) {
+			changes = append(changes, messageChanges(path+".", current.Get(fd).Message(), desired.Get(fd).Message(), written)...)
+			continue
+		}
+		if current.Has(fd) && containsField(fd, current.Get(fd), desired.Get(fd)) {
+			continue
+		}
+
+		change := fieldChange{path: path, desired: formatField(fd, desired.Get(fd))}
+		if current.Has(fd) {
+			change.current = formatField(fd, current.Get(fd))
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// isOutputOnly reports whether the field is set by the server, such as the uid, conditions and
+// timestamps of a resource, or is its etag.
+func isOutputOnly(fd protoreflect.FieldDescriptor) bool {
+	behaviors, _ := proto.GetExtension(fd.Options(), annotations.E_FieldBehavior).([]annotations.FieldBehavior)
+	return fd.Name() == "etag" || slices.Contains(behaviors, annotations.FieldBehavior_OUTPUT_ONLY)
+}
+
+// isNestedMessage reports whether the field holds a single message whose fields are compared one
+// by one, which excludes the well-known types such as durations.
+func isNestedMessage(fd protoreflect.FieldDescriptor) bool {
+	return fd.Message() != nil && !fd.IsList() && !fd.IsMap() && fd.Message().ParentFile().Package() != "google.protobuf"
+}
+
+// containsField reports whether the current value of the field holds the desired value: lists and
+// maps have the same elements, and messages have the same values for the fields of the desired
+// message.
+func containsField(fd protoreflect.FieldDescriptor, current, desired protoreflect.Value) bool {
+	switch {
+	case fd.IsList():
+		if current.List().Len() != desired.List().Len() {
+			return false
+		}
+		for i := 0; i < desired.List().Len(); i++ {
+			if !containsValue(fd, current.List().Get(i), desired.List().Get(i)) {
+				return false
+			}
+		}
+		return true
+	case fd.IsMap():
+		if current.Map().Len() != desired.Map().Len() {
+			return false
+		}
+		contains := true
+		desired.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			contains = current.Map().Has(k) && containsValue(fd.MapValue(), current.Map().Get(k), v)
+			return contains
+		})
+		return contains
+	default:
+		return containsValue(fd, current, desired)
+	}
+}
+
+// containsValue is containsField for a single value of the field, or an element of its list.
+func containsValue(fd protoreflect.FieldDescriptor, current, desired protoreflect.Value) bool {
+	if fd.Message() == nil {
+		return current.Equal(desired)
+	}
+	if fd.Message().ParentFile().Package() == "google.protobuf" {
+		return proto.Equal(current.Message().Interface(), desired.Message().Interface())
+	}
+	return len(messageChanges("", current.Message(), desired.Message(), nil)) == 0
+}
+
+// formatChanges returns a line per changed field, as "+ path: desired" for a field that is not set
+// in the current resource, or "~ path: current -> desired".
+func formatChanges(changes []fieldChange) string {
+	var b strings.Builder
+	for _, change := range changes {
+		if change.current == "" {
+			fmt.Fprintf(&b, "  + %s: %s\n", change.path, change.desired)
+		} else {
+			fmt.Fprintf(&b, "  ~ %s: %s -> %s\n", change.path, change.current, change.desired)
+		}
+	}
+	return b.String()
+}
+
+// formatField formats the value of the field in the same way between runs, unlike the text and
+// JSON formats of protobuf: messages list their fields set, in the order of their declaration, and
+// maps their keys in order.
+func formatField(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch {
+	case fd.IsList():
+		elements := make([]string, v.List().Len())
+		for i := range elements {
+			elements[i] = formatValue(fd, v.List().Get(i))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case fd.IsMap():
+		var entries []string
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			entries = append(entries, formatValue(fd.MapKey(), k.Value())+": "+formatValue(fd.MapValue(), mv))
+			return true
+		})
+		sort.Strings(entries)
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return formatValue(fd, v)
+	}
+}
+
+// formatValue is formatField for a single value of the field, or an element of its list.
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if d, ok := v.Message().Interface().(*durationpb.Duration); ok {
+			return d.AsDuration().String()
+		}
+		var fields []string
+		m := v.Message()
+		mfields := m.Descriptor().Fields()
+		for i := 0; i < mfields.Len(); i++ {
+			if mfd := mfields.Get(i); m.Has(mfd) && !isOutputOnly(mfd) {
+				fields = append(fields, string(mfd.Name())+": "+formatField(mfd, m.Get(mfd)))
+			}
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// updateMask returns the mask of the changed fields, so that the fields of the resource that are
+// not written in the file, such as the defaults of the server, are left unchanged, while the
+// fields written with their zero value are cleared.
+func updateMask(changes []fieldChange) *fieldmaskpb.FieldMask {
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		paths[i] = change.path
+	}
+	return &fieldmaskpb.FieldMask{Paths: paths}
+}
+
+func getResource(ctx context.Context, cdClient *deploy.CloudDeployClient, resource *Resource) (proto.Message, error) {
+	switch resource.Message.(type) {
+	case *deploypb.DeliveryPipeline:
+		return cdClient.GetDeliveryPipeline(ctx, &deploypb.GetDeliveryPipelineRequest{Name: resource.Name})
+	case *deploypb.Target:
+		return cdClient.GetTarget(ctx, &deploypb.GetTargetRequest{Name: resource.Name})
+	case *deploypb.Automation:
+		return cdClient.GetAutomation(ctx, &deploypb.GetAutomationRequest{Name: resource.Name})
+	case *deploypb.CustomTargetType:
+		return cdClient.GetCustomTargetType(ctx, &deploypb.GetCustomTargetTypeRequest{Name: resource.Name})
+	}
+	return nil, fmt.Errorf("unsupported kind: %s", resource.Kind)
+}
+
+// createResource creates the resource, or only validates its creation if validateOnly is set.
+func createResource(ctx context.Context, cdClient *deploy.CloudDeployClient, resource *Resource, validateOnly bool) error {
+	requestId := uuid.NewString()
+	switch m := resource.Message.(type) {
+	case *deploypb.DeliveryPipeline:
+		op, err := cdClient.CreateDeliveryPipeline(ctx, &deploypb.CreateDeliveryPipelineRequest{
+			Parent:             resource.Parent,
+			DeliveryPipelineId: resource.Id,
+			DeliveryPipeline:   m,
+			RequestId:          requestId,
+			ValidateOnly:       validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	case *deploypb.Target:
+		op, err := cdClient.CreateTarget(ctx, &deploypb.CreateTargetRequest{
+			Parent:       resource.Parent,
+			TargetId:     resource.Id,
+			Target:       m,
+			RequestId:    requestId,
+			ValidateOnly: validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	case *deploypb.Automation:
+		op, err := cdClient.CreateAutomation(ctx, &deploypb.CreateAutomationRequest{
+			Parent:       resource.Parent,
+			AutomationId: resource.Id,
+			Automation:   m,
+			RequestId:    requestId,
+			ValidateOnly: validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	case *deploypb.CustomTargetType:
+		op, err := cdClient.CreateCustomTargetType(ctx, &deploypb.CreateCustomTargetTypeRequest{
+			Parent:             resource.Parent,
+			CustomTargetTypeId: resource.Id,
+			CustomTargetType:   m,
+			RequestId:          requestId,
+			ValidateOnly:       validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	}
+	return fmt.Errorf("unsupported kind: %s", resource.Kind)
+}
+
+// updateResource updates the fields of the resource in the mask, or only validates its update if
+// validateOnly is set.
+func updateResource(ctx context.Context, cdClient *deploy.CloudDeployClient, resource *Resource, updateMask *fieldmaskpb.FieldMask, validateOnly bool) error {
+	requestId := uuid.NewString()
+	switch m := resource.Message.(type) {
+	case *deploypb.DeliveryPipeline:
+		op, err := cdClient.UpdateDeliveryPipeline(ctx, &deploypb.UpdateDeliveryPipelineRequest{
+			UpdateMask:       updateMask,
+			DeliveryPipeline: m,
+			RequestId:        requestId,
+			ValidateOnly:     validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	case *deploypb.Target:
+		op, err := cdClient.UpdateTarget(ctx, &deploypb.UpdateTargetRequest{
+			UpdateMask:   updateMask,
+			Target:       m,
+			RequestId:    requestId,
+			ValidateOnly: validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	case *deploypb.Automation:
+		op, err := cdClient.UpdateAutomation(ctx, &deploypb.UpdateAutomationRequest{
+			UpdateMask:   updateMask,
+			Automation:   m,
+			RequestId:    requestId,
+			ValidateOnly: validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	case *deploypb.CustomTargetType:
+		op, err := cdClient.UpdateCustomTargetType(ctx, &deploypb.UpdateCustomTargetTypeRequest{
+			UpdateMask:       updateMask,
+			CustomTargetType: m,
+			RequestId:        requestId,
+			ValidateOnly:     validateOnly,
+		})
+		if err != nil || validateOnly {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	}
+	return fmt.Errorf("unsupported kind: %s", resource.Kind)
+}
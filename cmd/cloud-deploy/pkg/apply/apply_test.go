@@ -0,0 +1,288 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/test"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const applyResources = `apiVersion: deploy.cloud.google.com/v1
+kind: DeliveryPipeline
+metadata:
+  name: web-app
+description: main application pipeline
+serialPipeline:
+  stages:
+  - targetId: prod
+---
+apiVersion: deploy.cloud.google.com/v1
+kind: Target
+metadata:
+  name: prod
+description: production cluster
+requireApproval: true
+`
+
+const (
+	pipelineName = "projects/my-project/locations/us-central1/deliveryPipelines/web-app"
+	targetName   = "projects/my-project/locations/us-central1/targets/prod"
+)
+
+// applyServer serves the existing targets, and records the targets that are created or updated,
+// and the update masks.
+type applyServer struct {
+	test.FakeCloudDeployServer
+	mu          sync.Mutex
+	targets     map[string]*deploypb.Target
+	requests    []string
+	updateMasks map[string][]string
+}
+
+func (s *applyServer) GetTarget(ctx context.Context, req *deploypb.GetTargetRequest) (*deploypb.Target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target, ok := s.targets[req.Name]; ok {
+		return target, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "%s not found", req.Name)
+}
+
+func (s *applyServer) CreateTarget(ctx context.Context, req *deploypb.CreateTargetRequest) (*longrunningpb.Operation, error) {
+	s.record("create", req.Target.Name, req.ValidateOnly)
+	return s.FakeCloudDeployServer.CreateTarget(ctx, req)
+}
+
+func (s *applyServer) UpdateTarget(ctx context.Context, req *deploypb.UpdateTargetRequest) (*longrunningpb.Operation, error) {
+	s.record("update", req.Target.Name, req.ValidateOnly)
+	s.recordMask(req.Target.Name, req.UpdateMask.GetPaths())
+	return s.FakeCloudDeployServer.UpdateTarget(ctx, req)
+}
+
+func (s *applyServer) UpdateDeliveryPipeline(ctx context.Context, req *deploypb.UpdateDeliveryPipelineRequest) (*longrunningpb.Operation, error) {
+	s.record("update", req.DeliveryPipeline.Name, req.ValidateOnly)
+	s.recordMask(req.DeliveryPipeline.Name, req.UpdateMask.GetPaths())
+	return s.FakeCloudDeployServer.UpdateDeliveryPipeline(ctx, req)
+}
+
+func (s *applyServer) record(action, name string, validateOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if validateOnly {
+		action = "validate " + action
+	}
+	s.requests = append(s.requests, action+" "+name)
+}
+
+func (s *applyServer) recordMask(name string, paths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.updateMasks == nil {
+		s.updateMasks = map[string][]string{}
+	}
+	s.updateMasks[name] = paths
+}
+
+func TestApply(t *testing.T) {
+	tcs := []struct {
+		name             string
+		resources        string
+		dryRun           bool
+		targets          map[string]*deploypb.Target
+		expectedRequests []string
+		expectedMasks    map[string][]string
+	}{
+		{
+			name:             "new target",
+			expectedRequests: []string{"update " + pipelineName, "create " + targetName},
+			expectedMasks:    map[string][]string{pipelineName: {"description", "serial_pipeline"}},
+		}, {
+			name: "unchanged target",
+			targets: map[string]*deploypb.Target{
+				targetName: {
+					Name:            targetName,
+					Description:     "production cluster",
+					RequireApproval: true,
+					TargetId:        "prod",
+					Uid:             "test-uid",
+					Etag:            "test-etag",
+					CreateTime:      timestamppb.Now(),
+					ExecutionConfigs: []*deploypb.ExecutionConfig{{
+						Usages: []deploypb.ExecutionConfig_ExecutionEnvironmentUsage{deploypb.ExecutionConfig_RENDER},
+					}},
+				},
+			},
+			expectedRequests: []string{"update " + pipelineName},
+			expectedMasks:    map[string][]string{pipelineName: {"description", "serial_pipeline"}},
+		}, {
+			name: "changed target",
+			targets: map[string]*deploypb.Target{
+				targetName: {
+					Name:        targetName,
+					Description: "production cluster",
+					Uid:         "test-uid",
+				},
+			},
+			expectedRequests: []string{"update " + pipelineName, "update " + targetName},
+			expectedMasks: map[string][]string{
+				pipelineName: {"description", "serial_pipeline"},
+				targetName:   {"require_approval"},
+			},
+		}, {
+			name: "approval turned off",
+			resources: `apiVersion: deploy.cloud.google.com/v1
+kind: Target
+metadata:
+  name: prod
+description: production cluster
+requireApproval: false
+`,
+			targets: map[string]*deploypb.Target{
+				targetName: {
+					Name:            targetName,
+					Description:     "production cluster",
+					RequireApproval: true,
+					Uid:             "test-uid",
+				},
+			},
+			expectedRequests: []string{"update " + targetName},
+			expectedMasks:    map[string][]string{targetName: {"require_approval"}},
+		}, {
+			name:             "dry run",
+			dryRun:           true,
+			expectedRequests: []string{"validate update " + pipelineName, "validate create " + targetName},
+			expectedMasks:    map[string][]string{pipelineName: {"description", "serial_pipeline"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := &applyServer{targets: tc.targets}
+			cdClient := test.CreateCloudDeployClientWithServer(t, ctx, server)
+			resources := tc.resources
+			if resources == "" {
+				resources = applyResources
+			}
+			flags := &config.ApplyConfiguration{
+				File:      writeResources(t, resources),
+				Region:    "us-central1",
+				ProjectId: "my-project",
+				DryRun:    tc.dryRun,
+			}
+
+			if err := Apply(ctx, cdClient, flags); err != nil {
+				t.Fatalf("unexpected error calling Apply(): %s", err)
+			}
+			if diff := cmp.Diff(tc.expectedRequests, server.requests); diff != "" {
+				t.Errorf("mismatched requests (-want +got): %s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedMasks, server.updateMasks); diff != "" {
+				t.Errorf("mismatched update masks (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	current := &deploypb.Target{
+		Name:        targetName,
+		Description: "production cluster",
+		Uid:         "test-uid",
+		Etag:        "test-etag",
+		ExecutionConfigs: []*deploypb.ExecutionConfig{{
+			Usages: []deploypb.ExecutionConfig_ExecutionEnvironmentUsage{deploypb.ExecutionConfig_RENDER},
+		}},
+		DeploymentTarget: &deploypb.Target_Gke{Gke: &deploypb.GkeCluster{Cluster: "prod-cluster", InternalIp: true}},
+	}
+	desired := &deploypb.Target{
+		Name:             targetName,
+		Description:      "production cluster",
+		DeploymentTarget: &deploypb.Target_Gke{Gke: &deploypb.GkeCluster{Cluster: "prod-cluster"}},
+	}
+	if changes := changedFields(current, desired, nil); len(changes) != 0 {
+		t.Errorf("unexpected changes of the fields set by the server: %v", changes)
+	}
+
+	desired.Description = "prod cluster"
+	desired.RequireApproval = true
+	desired.Labels = map[string]string{"team": "web", "env": "prod"}
+	desired.DeploymentTarget = &deploypb.Target_Gke{Gke: &deploypb.GkeCluster{Cluster: "prod-cluster-2"}}
+	desired.ExecutionConfigs = []*deploypb.ExecutionConfig{{
+		Usages:           []deploypb.ExecutionConfig_ExecutionEnvironmentUsage{deploypb.ExecutionConfig_DEPLOY},
+		ExecutionTimeout: durationpb.New(time.Hour),
+	}}
+	changes := changedFields(current, desired, nil)
+	expectedChanges := []fieldChange{
+		{path: "description", current: `"production cluster"`, desired: `"prod cluster"`},
+		{path: "labels", desired: `{"env": "prod", "team": "web"}`},
+		{path: "require_approval", desired: "true"},
+		{path: "gke.cluster", current: `"prod-cluster"`, desired: `"prod-cluster-2"`},
+		{path: "execution_configs", current: "[{usages: [RENDER]}]", desired: "[{usages: [DEPLOY], execution_timeout: 1h0m0s}]"},
+	}
+	if diff := cmp.Diff(expectedChanges, changes, cmp.AllowUnexported(fieldChange{})); diff != "" {
+		t.Errorf("mismatched changes (-want +got): %s", diff)
+	}
+
+	expectedDiff := `  ~ description: "production cluster" -> "prod cluster"
+  + labels: {"env": "prod", "team": "web"}
+  + require_approval: true
+  ~ gke.cluster: "prod-cluster" -> "prod-cluster-2"
+  ~ execution_configs: [{usages: [RENDER]}] -> [{usages: [DEPLOY], execution_timeout: 1h0m0s}]
+`
+	if diff := cmp.Diff(expectedDiff, formatChanges(changes)); diff != "" {
+		t.Errorf("mismatched diff (-want +got): %s", diff)
+	}
+	if current.Uid != "test-uid" {
+		t.Errorf("changedFields() modified the current resource")
+	}
+}
+
+func TestChangedFields_ZeroValues(t *testing.T) {
+	current := &deploypb.Target{
+		Name:             targetName,
+		RequireApproval:  true,
+		Labels:           map[string]string{"team": "web"},
+		DeploymentTarget: &deploypb.Target_Gke{Gke: &deploypb.GkeCluster{Cluster: "prod-cluster", InternalIp: true}},
+	}
+	desired := &deploypb.Target{
+		Name:             targetName,
+		DeploymentTarget: &deploypb.Target_Gke{Gke: &deploypb.GkeCluster{Cluster: "prod-cluster"}},
+	}
+	written := map[string]bool{"require_approval": true, "labels": true, "gke": true, "gke.cluster": true,
+		"gke.internal_ip": true, "description": true}
+
+	expectedChanges := []fieldChange{
+		{path: "labels", current: `{"team": "web"}`, desired: "{}"},
+		{path: "require_approval", current: "true", desired: "false"},
+		{path: "gke.internal_ip", current: "true", desired: "false"},
+	}
+	changes := changedFields(current, desired, written)
+	if diff := cmp.Diff(expectedChanges, changes, cmp.AllowUnexported(fieldChange{})); diff != "" {
+		t.Errorf("mismatched changes (-want +got): %s", diff)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/goccy/go-yaml"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const apiVersion = "deploy.cloud.google.com/v1"
+
+// The kinds of the resources that can be applied.
+const (
+	KindDeliveryPipeline = "DeliveryPipeline"
+	KindTarget           = "Target"
+	KindAutomation       = "Automation"
+	KindCustomTargetType = "CustomTargetType"
+)
+
+var kinds = []string{KindDeliveryPipeline, KindTarget, KindAutomation, KindCustomTargetType}
+
+// Resource is a Cloud Deploy resource declared in a file.
+type Resource struct {
+	Kind    string        // ex: Target
+	Name    string        // ex: projects/my-project/locations/us-central1/targets/prod
+	Parent  string        // ex: projects/my-project/locations/us-central1
+	Id      string        // ex: prod
+	Message proto.Message // ex: &deploypb.Target{Name: "projects/my-project/locations/us-central1/targets/prod"}
+	// Fields holds the paths of the fields written in the file, including the ones set to their
+	// zero value, such as requireApproval: false. The fields of nested messages are included, but
+	// not the fields of the elements of lists and maps.
+	Fields map[string]bool // ex: {"require_approval": true, "gke": true, "gke.cluster": true}
+}
+
+// ReadResources reads the resources of the multi-document YAML file, in the format of
+// gcloud deploy apply, in the region of the project.
+func ReadResources(path, projectId, region string) ([]*Resource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var resources []*Resource
+	names := map[string]bool{}
+	for i, document := range splitDocuments(data) {
+		var doc map[string]any
+		if err := yaml.Unmarshal(document, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing document %d of %s: %w", i+1, path, err)
+		}
+		if len(doc) == 0 {
+			continue
+		}
+
+		resource, err := parseResource(doc, projectId, region)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document %d of %s: %w", i+1, path, err)
+		}
+		if names[resource.Name] {
+			return nil, fmt.Errorf("invalid document %d of %s: %s %s is declared more than once", i+1, path, resource.Kind, resource.Name)
+		}
+		names[resource.Name] = true
+		resources = append(resources, resource)
+	}
+
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resources found in %s", path)
+	}
+	return resources, nil
+}
+
+// splitDocuments splits the multi-document YAML at its --- separators. The documents are parsed
+// one by one, since the YAML decoder stops at a document that only contains comments.
+func splitDocuments(data []byte) [][]byte {
+	var documents [][]byte
+	var document []byte
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		if bytes.Equal(trimmed, []byte("---")) || bytes.HasPrefix(trimmed, []byte("--- ")) {
+			documents = append(documents, document)
+			document = nil
+			continue
+		}
+		document = append(document, line...)
+	}
+	return append(documents, document)
+}
+
+// parseResource converts the document to the resource of its kind. The metadata of the document
+// sets the name, annotations and labels of the resource, and its other fields are those of the
+// resource in the Cloud Deploy API.
+func parseResource(doc map[string]any, projectId, region string) (*Resource, error) {
+	if doc["apiVersion"] != apiVersion {
+		return nil, fmt.Errorf("unsupported apiVersion: %v, must be %s", doc["apiVersion"], apiVersion)
+	}
+	metadata, ok := doc["metadata"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("missing metadata")
+	}
+	id, _ := metadata["name"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("missing metadata.name")
+	}
+
+	fields := map[string]any{}
+	for key, value := range doc {
+		if key != "apiVersion" && key != "kind" && key != "metadata" {
+			fields[key] = value
+		}
+	}
+	for key, value := range metadata {
+		switch key {
+		case "name":
+		case "annotations", "labels":
+			fields[key] = value
+		default:
+			return nil, fmt.Errorf("unsupported metadata field: %s", key)
+		}
+	}
+
+	resource := &Resource{
+		Kind:   fmt.Sprint(doc["kind"]),
+		Parent: fmt.Sprintf("projects/%s/locations/%s", projectId, region),
+		Id:     id,
+	}
+	switch resource.Kind {
+	case KindDeliveryPipeline:
+		resource.Name = resource.Parent + "/deliveryPipelines/" + id
+		resource.Message = &deploypb.DeliveryPipeline{}
+	case KindTarget:
+		resource.Name = resource.Parent + "/targets/" + id
+		resource.Message = &deploypb.Target{}
+	case KindCustomTargetType:
+		resource.Name = resource.Parent + "/customTargetTypes/" + id
+		resource.Message = &deploypb.CustomTargetType{}
+	case KindAutomation:
+		// automations are named after their delivery pipeline
+		pipeline, automation, ok := strings.Cut(id, "/")
+		if !ok || pipeline == "" || automation == "" || strings.Contains(automation, "/") {
+			return nil, fmt.Errorf("invalid Automation name: %s, must be <delivery-pipeline>/<automation>", id)
+		}
+		resource.Parent += "/deliveryPipelines/" + pipeline
+		resource.Name = resource.Parent + "/automations/" + automation
+		resource.Id = automation
+		resource.Message = &deploypb.Automation{}
+		if err := convertSelector(fields); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind: %v, must be one of %s", doc["kind"], strings.Join(kinds, ", "))
+	}
+	if resource.Kind != KindAutomation && strings.Contains(id, "/") {
+		return nil, fmt.Errorf("invalid %s name: %s, only lower-case letters, numbers, and hyphens are allowed", resource.Kind, id)
+	}
+	fields["name"] = resource.Name
+
+	if err := convertDurations(fields, resource.Message.ProtoReflect().Descriptor()); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", resource.Kind, id, err)
+	}
+	resource.Fields = map[string]bool{}
+	addFieldPaths(resource.Fields, "", fields, resource.Message.ProtoReflect().Descriptor())
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", resource.Kind, id, err)
+	}
+	if err := protojson.Unmarshal(data, resource.Message); err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", resource.Kind, id, err)
+	}
+	return resource, nil
+}
+
+// addFieldPaths adds the paths of the fields of the message that are written in the document to
+// paths. The unknown fields are left to the errors of protojson.
+func addFieldPaths(paths map[string]bool, prefix string, fields map[string]any, md protoreflect.MessageDescriptor) {
+	for key, value := range fields {
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(key))
+		}
+		if fd == nil {
+			continue
+		}
+
+		path := prefix + string(fd.Name())
+		paths[path] = true
+		if m, ok := value.(map[string]any); ok && fd.Message() != nil && !fd.IsMap() && !fd.IsList() {
+			addFieldPaths(paths, path+".", m, fd.Message())
+		}
+	}
+}
+
+// convertSelector converts the selector of an automation from the list of targets written by
+// gcloud, such as [{target: {id: prod}}], to the selector of the API.
+func convertSelector(fields map[string]any) error {
+	selectors, ok := fields["selector"].([]any)
+	if !ok {
+		return nil
+	}
+
+	targets := []any{}
+	for _, selector := range selectors {
+		s, _ := selector.(map[string]any)
+		target, ok := s["target"]
+		if !ok || len(s) != 1 {
+			return fmt.Errorf("invalid Automation selector: %v, must be a list of target selectors", selector)
+		}
+		targets = append(targets, target)
+	}
+	fields["selector"] = map[string]any{"targets": targets}
+	return nil
+}
+
+// convertDurations converts the durations of the fields of the message, which can be written as
+// Go durations such as 10m, to the seconds of the JSON format of the API.
+func convertDurations(fields map[string]any, md protoreflect.MessageDescriptor) error {
+	durationName := (&durationpb.Duration{}).ProtoReflect().Descriptor().FullName()
+	for key, value := range fields {
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil || fd.Message() == nil || fd.IsMap() {
+			continue
+		}
+
+		if fd.Message().FullName() == durationName {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s, must be a duration such as 10m", key, s)
+			}
+			fields[key] = strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+			continue
+		}
+
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if m, ok := v.(map[string]any); ok {
+				if err := convertDurations(m, fd.Message()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const testResources = `apiVersion: deploy.cloud.google.com/v1
+kind: DeliveryPipeline
+metadata:
+  name: web-app
+  labels:
+    team: web
+description: main application pipeline
+serialPipeline:
+  stages:
+  - targetId: staging
+  - targetId: prod
+    profiles: [prod]
+---
+apiVersion: deploy.cloud.google.com/v1
+kind: Target
+metadata:
+  name: prod
+  annotations:
+    owner: web-team
+requireApproval: true
+gke:
+  cluster: projects/my-project/locations/us-central1/clusters/prod
+---
+# a document of comments only is skipped
+---
+apiVersion: deploy.cloud.google.com/v1
+kind: Automation
+metadata:
+  name: web-app/promote
+serviceAccount: deployer@my-project.iam.gserviceaccount.com
+selector:
+- target:
+    id: staging
+rules:
+- promoteReleaseRule:
+    id: promote-release
+    wait: 10m
+    destinationTargetId: "@next"
+---
+apiVersion: deploy.cloud.google.com/v1
+kind: CustomTargetType
+metadata:
+  name: terraform
+customActions:
+  renderAction: terraform-render
+  deployAction: terraform-deploy
+`
+
+func TestReadResources(t *testing.T) {
+	path := writeResources(t, testResources)
+	location := "projects/my-project/locations/us-central1"
+	expected := []*Resource{
+		{
+			Kind:   KindDeliveryPipeline,
+			Name:   location + "/deliveryPipelines/web-app",
+			Parent: location,
+			Id:     "web-app",
+			Message: &deploypb.DeliveryPipeline{
+				Name:        location + "/deliveryPipelines/web-app",
+				Description: "main application pipeline",
+				Labels:      map[string]string{"team": "web"},
+				Pipeline: &deploypb.DeliveryPipeline_SerialPipeline{
+					SerialPipeline: &deploypb.SerialPipeline{
+						Stages: []*deploypb.Stage{
+							{TargetId: "staging"},
+							{TargetId: "prod", Profiles: []string{"prod"}},
+						},
+					},
+				},
+			},
+			Fields: map[string]bool{"name": true, "labels": true, "description": true, "serial_pipeline": true,
+				"serial_pipeline.stages": true},
+		}, {
+			Kind:   KindTarget,
+			Name:   location + "/targets/prod",
+			Parent: location,
+			Id:     "prod",
+			Message: &deploypb.Target{
+				Name:            location + "/targets/prod",
+				Annotations:     map[string]string{"owner": "web-team"},
+				RequireApproval: true,
+				DeploymentTarget: &deploypb.Target_Gke{
+					Gke: &deploypb.GkeCluster{Cluster: "projects/my-project/locations/us-central1/clusters/prod"},
+				},
+			},
+			Fields: map[string]bool{"name": true, "annotations": true, "require_approval": true, "gke": true,
+				"gke.cluster": true},
+		}, {
+			Kind:   KindAutomation,
+			Name:   location + "/deliveryPipelines/web-app/automations/promote",
+			Parent: location + "/deliveryPipelines/web-app",
+			Id:     "promote",
+			Message: &deploypb.Automation{
+				Name:           location + "/deliveryPipelines/web-app/automations/promote",
+				ServiceAccount: "deployer@my-project.iam.gserviceaccount.com",
+				Selector: &deploypb.AutomationResourceSelector{
+					Targets: []*deploypb.TargetAttribute{{Id: "staging"}},
+				},
+				Rules: []*deploypb.AutomationRule{{
+					Rule: &deploypb.AutomationRule_PromoteReleaseRule{
+						PromoteReleaseRule: &deploypb.PromoteReleaseRule{
+							Id:                  "promote-release",
+							Wait:                durationpb.New(10 * time.Minute),
+							DestinationTargetId: "@next",
+						},
+					},
+				}},
+			},
+			Fields: map[string]bool{"name": true, "service_account": true, "selector": true, "selector.targets": true,
+				"rules": true},
+		}, {
+			Kind:   KindCustomTargetType,
+			Name:   location + "/customTargetTypes/terraform",
+			Parent: location,
+			Id:     "terraform",
+			Message: &deploypb.CustomTargetType{
+				Name: location + "/customTargetTypes/terraform",
+				Definition: &deploypb.CustomTargetType_CustomActions{
+					CustomActions: &deploypb.CustomTargetSkaffoldActions{
+						RenderAction: "terraform-render",
+						DeployAction: "terraform-deploy",
+					},
+				},
+			},
+			Fields: map[string]bool{"name": true, "custom_actions": true, "custom_actions.render_action": true,
+				"custom_actions.deploy_action": true},
+		},
+	}
+
+	resources, err := ReadResources(path, "my-project", "us-central1")
+	if err != nil {
+		t.Fatalf("unexpected error calling ReadResources(): %s", err)
+	}
+	if diff := cmp.Diff(expected, resources, protocmp.Transform()); diff != "" {
+		t.Errorf("mismatched resources (-want +got): %s", diff)
+	}
+}
+
+func TestReadResources_Fail(t *testing.T) {
+	tcs := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:        "no resources",
+			content:     "# nothing to apply\n",
+			expectedErr: "no resources found in %s",
+		}, {
+			name:        "unsupported apiVersion",
+			content:     "apiVersion: deploy.cloud.google.com/v2\nkind: Target\nmetadata:\n  name: prod\n",
+			expectedErr: "invalid document 1 of %s: unsupported apiVersion: deploy.cloud.google.com/v2, must be deploy.cloud.google.com/v1",
+		}, {
+			name:        "unsupported kind",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Release\nmetadata:\n  name: prod\n",
+			expectedErr: "invalid document 1 of %s: unsupported kind: Release, must be one of DeliveryPipeline, Target, Automation, CustomTargetType",
+		}, {
+			name:        "missing name",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Target\nmetadata:\n  labels:\n    team: web\n",
+			expectedErr: "invalid document 1 of %s: missing metadata.name",
+		}, {
+			name:        "unsupported metadata",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Target\nmetadata:\n  name: prod\n  namespace: web\n",
+			expectedErr: "invalid document 1 of %s: unsupported metadata field: namespace",
+		}, {
+			name:        "invalid automation name",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Automation\nmetadata:\n  name: promote\n",
+			expectedErr: "invalid document 1 of %s: invalid Automation name: promote, must be <delivery-pipeline>/<automation>",
+		}, {
+			name:        "invalid target name",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Target\nmetadata:\n  name: web/prod\n",
+			expectedErr: "invalid document 1 of %s: invalid Target name: web/prod, only lower-case letters, numbers, and hyphens are allowed",
+		}, {
+			name:        "invalid duration",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Automation\nmetadata:\n  name: web-app/promote\nrules:\n- promoteReleaseRule:\n    wait: soon\n",
+			expectedErr: "invalid document 1 of %s: invalid Automation web-app/promote: invalid wait: soon, must be a duration such as 10m",
+		}, {
+			name:        "duplicate resource",
+			content:     "apiVersion: deploy.cloud.google.com/v1\nkind: Target\nmetadata:\n  name: prod\n---\napiVersion: deploy.cloud.google.com/v1\nkind: Target\nmetadata:\n  name: prod\n",
+			expectedErr: "invalid document 2 of %s: Target projects/my-project/locations/us-central1/targets/prod is declared more than once",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeResources(t, tc.content)
+			_, err := ReadResources(path, "my-project", "us-central1")
+			if err == nil {
+				t.Fatalf("expected error calling ReadResources()")
+			}
+			if diff := cmp.Diff(fmt.Sprintf(tc.expectedErr, path), err.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestReadResources_UnknownField(t *testing.T) {
+	path := writeResources(t, "apiVersion: deploy.cloud.google.com/v1\nkind: Target\nmetadata:\n  name: prod\nrequireApprovals: true\n")
+	if _, err := ReadResources(path, "my-project", "us-central1"); err == nil {
+		t.Fatalf("expected error calling ReadResources() with an unknown field")
+	}
+}
+
+func writeResources(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clouddeploy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
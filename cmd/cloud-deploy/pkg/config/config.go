@@ -14,6 +14,8 @@
 
 package config
 
+import "time"
+
 // ReleaseConfiguration is used to configure the cloud deploy release.
 type ReleaseConfiguration struct {
 	DeliveryPipeline         string            // ex: web-app
@@ -27,6 +29,40 @@ type ReleaseConfiguration struct {
 	SkaffoldVersion          string            // ex: 2.10
 	SkaffoldFile             string            // ex: ./skaffold.yaml
 	Images                   map[string]string // ex: {image1=path/to/image1:v1,image2=path/to/image2:v1}
+	BuildArtifacts           string            // ex: ./artifacts.json
+	Annotations              map[string]string // ex: {annotation1:val1,annotation2:val2}
+	Labels                   map[string]string // ex: {label1:val1,label2:val2}
+	DeployParameters         map[string]string // ex: {param1:val1,param2:val2}
 	InitialRolloutAnotations map[string]string // ex: {annotation1:val1,annotation2:val2}
 	InitialRolloutLabels     map[string]string // ex: {label1:val1,label2:val2}
+	RolloutId                string            // ex: test-release-to-test-0001
+	RolloutDescription       string            // ex: a description of the rollout
+	SkipInitialRollout       bool              // ex: true
+	RenderTimeout            time.Duration     // ex: 30m
+	Wait                     bool              // ex: true
+	WaitTimeout              time.Duration     // ex: 30m
+}
+
+// RolloutConfiguration is used to act on the rollouts of a cloud deploy release.
+type RolloutConfiguration struct {
+	DeliveryPipeline string            // ex: web-app
+	Region           string            // ex: us-central1
+	ProjectId        string            // ex: my-project
+	Release          string            // ex: test-release
+	Rollout          string            // ex: test-release-to-test-0001
+	ToTarget         string            // ex: prod
+	PhaseId          string            // ex: stable
+	JobId            string            // ex: verify
+	Annotations      map[string]string // ex: {annotation1:val1,annotation2:val2}
+	Labels           map[string]string // ex: {label1:val1,label2:val2}
+	Wait             bool              // ex: true
+	WaitTimeout      time.Duration     // ex: 30m
+}
+
+// ApplyConfiguration is used to apply a file of cloud deploy resources.
+type ApplyConfiguration struct {
+	File      string // ex: ./clouddeploy.yaml
+	Region    string // ex: us-central1
+	ProjectId string // ex: my-project
+	DryRun    bool   // ex: true
 }
@@ -15,11 +15,10 @@
 package gcs
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -28,15 +27,11 @@ import (
 	"cloud.google.com/go/deploy/apiv1/deploypb"
 	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"github.com/GoogleCloudBuild/cicd-images/internal/archive"
+	"github.com/GoogleCloudBuild/cicd-images/internal/gcloudignore"
 	"github.com/google/uuid"
 )
 
-const (
-	tmpTarPath    = "/tmp/cloud-deploy-tmp-tar.tgz"
-	gitIgnoreFile = ".gitignore"
-	gitFile       = ".git"
-)
-
 // SetSource sets the source for the release config and creates a default Cloud Storage bucket for staging
 func SetSource(ctx context.Context, pipelineUUID string, flags *config.ReleaseConfiguration, client *storage.Client, release *deploypb.Release) error {
 	source := flags.Source
@@ -64,19 +59,14 @@ func SetSource(ctx context.Context, pipelineUUID string, flags *config.ReleaseCo
 			return fmt.Errorf("local source: %s is none of local .zip, .tgz, .gz, or directory", source)
 		}
 
-		// upload
 		if info.Mode().IsDir() {
-			// create a tarball if source is a local directory
-			if err := createTarball(source, tmpTarPath); err != nil {
-				return fmt.Errorf("failed to create local tar: %w", err)
-			}
+			// the directory is archived straight into the object
 			object += ".tgz"
-			source = tmpTarPath
+			skaffoldConfigUri, err = uploadLocalDirectoryToGCS(ctx, source, bucket, object, flags.ProjectId, client)
 		} else {
 			object += filepath.Ext(source)
+			skaffoldConfigUri, err = uploadLocalArchiveToGCS(ctx, source, bucket, object, flags.ProjectId, client)
 		}
-
-		skaffoldConfigUri, err = uploadLocalArchiveToGCS(ctx, source, bucket, object, flags.ProjectId, client)
 		if err != nil {
 			return err
 		}
@@ -100,80 +90,97 @@ func uploadLocalArchiveToGCS(ctx context.Context, source, bucket, object, projec
 }
 
 func uploadTarball(ctx context.Context, gcsClient *storage.Client, object, bucket, fileToUpload string) error {
-	data, err := os.ReadFile(fileToUpload)
+	f, err := os.Open(fileToUpload)
 	if err != nil {
 		return fmt.Errorf("unable to read file to upload: %w", err)
 	}
+	defer f.Close()
+
+	return writeObject(ctx, gcsClient, object, bucket, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
+
+func uploadLocalDirectoryToGCS(ctx context.Context, source, bucket, object, projectId string, client *storage.Client) (string, error) {
+	if err := createBucketIfNotExist(ctx, bucket, projectId, client); err != nil {
+		return "", err
+	}
 
-	o := gcsClient.Bucket(bucket).Object(object)
-	wc := o.NewWriter(ctx)
+	fmt.Printf("Uploading local directory %s to gs://%s/%s \n", source, bucket, object)
+	err := writeObject(ctx, client, object, bucket, func(w io.Writer) error {
+		return writeSourceArchive(w, source)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to archive local directory: %w", err)
+	}
+
+	return fmt.Sprintf("gs://%s/%s", bucket, object), nil
+}
+
+// writeObject streams the data written by write into the object. The object is not created if
+// write fails.
+func writeObject(ctx context.Context, gcsClient *storage.Client, object, bucket string, write func(w io.Writer) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wc := gcsClient.Bucket(bucket).Object(object).NewWriter(ctx)
 	wc.ContentType = "application/x-tar"
 
-	if _, err := wc.Write(data); err != nil {
+	if err := write(wc); err != nil {
+		// cancelling the context before closing the writer aborts the upload
+		cancel()
+		wc.Close()
 		return fmt.Errorf("unable to write data to bucket %w", err)
 	}
 	if err := wc.Close(); err != nil {
 		return fmt.Errorf("unable to close bucket writer %w", err)
 	}
-
-	return err
+	return nil
 }
 
-func createTarball(folderToTarball, tarballPath string) error {
-	// Create a temp tarball file
-	tarballFile, err := os.Create(tarballPath)
+// writeSourceArchive writes the files of the directory that are not ignored by its .gcloudignore
+// file into w as a tar.gz archive. Entries are sorted, and have no modification time or owner, so
+// that identical sources produce identical archives.
+func writeSourceArchive(w io.Writer, dir string) error {
+	rules, err := gcloudignore.LoadOrDefault(dir)
 	if err != nil {
-		return err
+		return fmt.Errorf("error processing %v: %w", gcloudignore.FileName, err)
 	}
-	defer tarballFile.Close()
 
-	// create a tar writer
-	gzipWriter := gzip.NewWriter(tarballFile)
-	defer gzipWriter.Close()
-
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
-
-	err = filepath.Walk(folderToTarball, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	tarWriter, err := archive.NewWriter(w, archive.TarGzip)
+	if err != nil {
+		return err
+	}
+	tarWriter.Reproducible = true
 
-		header, err := tar.FileInfoHeader(info, "")
+	err = rules.Walk(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		relPath, err := filepath.Rel(folderToTarball, path)
+		relPath, err := filepath.Rel(dir, path)
 		if err != nil {
 			return err
 		}
 
-		// skip uploading .git and .gitignore files by default
-		// this is the default behavior of `gcloud deploy release create ...`
-		if relPath == gitIgnoreFile || strings.HasPrefix(relPath, gitFile) {
-			return nil
-		}
-		header.Name = relPath
-
-		// write the header to the tarball
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			data, err := os.Open(path)
+		if d.IsDir() {
+			info, err := d.Info()
 			if err != nil {
 				return err
 			}
-			if _, err := io.Copy(tarWriter, data); err != nil {
-				return err
-			}
+			return tarWriter.AddDir(info, filepath.ToSlash(relPath))
 		}
-
-		return nil
+		// symlinks and other special files are skipped
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return tarWriter.AddFile(path, filepath.ToSlash(relPath))
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return tarWriter.Close()
 }
 
 func copyRemoteGCS(ctx context.Context, source, destBucket, destObj, projectId string, client *storage.Client) (string, error) {
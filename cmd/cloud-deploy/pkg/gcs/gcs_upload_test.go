@@ -15,8 +15,14 @@
 package gcs
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -24,6 +30,7 @@ import (
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/test"
 	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 )
 
@@ -123,3 +130,109 @@ func TestSetSource_RemoteGCS(t *testing.T) {
 		t.Fatalf("unexpected error calling FetchReleasePipeline: %v", err.Error())
 	}
 }
+
+func TestWriteSourceArchive(t *testing.T) {
+	tcs := []struct {
+		name            string
+		files           map[string]string
+		expectedEntries []string
+	}{
+		{
+			name: "default rules",
+			files: map[string]string{
+				"skaffold.yaml":    "apiVersion: skaffold/v4beta7",
+				"app.go":           "package main",
+				".gitignore":       "*.log\n",
+				"debug.log":        "log",
+				".git/HEAD":        "ref: refs/heads/main",
+				".github/ci.yaml":  "on: push",
+				"k8s/service.yaml": "kind: Service",
+			},
+			expectedEntries: []string{".github/", ".github/ci.yaml", "app.go", "k8s/", "k8s/service.yaml", "skaffold.yaml"},
+		}, {
+			name: "gcloudignore",
+			files: map[string]string{
+				"skaffold.yaml":    "apiVersion: skaffold/v4beta7",
+				".gcloudignore":    "k8s/\n",
+				".gitignore":       "*.log\n",
+				"debug.log":        "log",
+				"k8s/service.yaml": "kind: Service",
+			},
+			expectedEntries: []string{".gcloudignore", ".gitignore", "debug.log", "skaffold.yaml"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+
+			var buf bytes.Buffer
+			if err := writeSourceArchive(&buf, dir); err != nil {
+				t.Fatalf("unexpected error calling writeSourceArchive(): %s", err)
+			}
+			if diff := cmp.Diff(tc.expectedEntries, archiveEntries(t, buf.Bytes())); diff != "" {
+				t.Errorf("mismatched archive entries (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteSourceArchive_Reproducible(t *testing.T) {
+	files := map[string]string{
+		"skaffold.yaml":    "apiVersion: skaffold/v4beta7",
+		"k8s/service.yaml": "kind: Service",
+	}
+	dir1 := t.TempDir()
+	writeFiles(t, dir1, files)
+	dir2 := t.TempDir()
+	writeFiles(t, dir2, files)
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir2, "skaffold.yaml"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf1, buf2 bytes.Buffer
+	if err := writeSourceArchive(&buf1, dir1); err != nil {
+		t.Fatalf("unexpected error calling writeSourceArchive(): %s", err)
+	}
+	if err := writeSourceArchive(&buf2, dir2); err != nil {
+		t.Fatalf("unexpected error calling writeSourceArchive(): %s", err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Errorf("archives of identical sources differ")
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func archiveEntries(t *testing.T, data []byte) []string {
+	t.Helper()
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	var entries []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, hdr.Name)
+	}
+}
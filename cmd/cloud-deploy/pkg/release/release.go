@@ -18,11 +18,13 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -33,9 +35,13 @@ import (
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/gcs"
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/rollout"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/skaffold"
 	"github.com/google/uuid"
 )
 
+// rolloutIdRegexp matches the valid rollout ids.
+var rolloutIdRegexp = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
 // CreateCloudDeployRelease is the main entry to create a Release
 func CreateCloudDeployRelease(ctx context.Context, cdClient *deploy.CloudDeployClient, gcsClient *storage.Client, flags *config.ReleaseConfiguration) error {
 	// TODO: Add implementation
@@ -49,6 +55,17 @@ func CreateCloudDeployRelease(ctx context.Context, cdClient *deploy.CloudDeployC
 		return err
 	}
 
+	// a release that failed to render cannot be rolled out
+	releaseName := fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s/releases/%s", flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release)
+	if err := waitForRender(ctx, cdClient, releaseName, flags.RenderTimeout); err != nil {
+		return err
+	}
+
+	if flags.SkipInitialRollout {
+		fmt.Println("Skipping the initial rollout")
+		return nil
+	}
+
 	// rollout to target
 	if err := rollout.CreateRollout(ctx, cdClient, flags); err != nil {
 		return err
@@ -57,6 +74,35 @@ func CreateCloudDeployRelease(ctx context.Context, cdClient *deploy.CloudDeployC
 	return nil
 }
 
+// ValidateInitialRolloutFlags validates the flags of the initial rollout of the release.
+func ValidateInitialRolloutFlags(flags *config.ReleaseConfiguration) error {
+	if flags.RolloutId != "" && !rolloutIdRegexp.MatchString(flags.RolloutId) {
+		return fmt.Errorf("invalid --rollout-id value: %s, it must start with a lower-case letter, contain only lower-case letters, numbers, and hyphens, and be at most 63 characters", flags.RolloutId)
+	}
+	if !flags.SkipInitialRollout {
+		return nil
+	}
+
+	initialRolloutFlags := []struct {
+		name string
+		set  bool
+	}{
+		{"--to-target", flags.ToTarget != ""},
+		{"--rollout-id", flags.RolloutId != ""},
+		{"--rollout-description", flags.RolloutDescription != ""},
+		{"--initial-rollout-phase-id", flags.InitialRolloutPhaseId != ""},
+		{"--initial-rollout-annotations", len(flags.InitialRolloutAnotations) > 0},
+		{"--initial-rollout-labels", len(flags.InitialRolloutLabels) > 0},
+		{"--wait", flags.Wait},
+	}
+	for _, f := range initialRolloutFlags {
+		if f.set {
+			return fmt.Errorf("%s cannot be used with --skip-initial-rollout", f.name)
+		}
+	}
+	return nil
+}
+
 // fetchReleasePipeline calls Cloud Deploy API to get the target Delivery Pipeline.
 // It returns the ID of the Delivery Pipeline is found, return error otherwise.
 func fetchReleasePipeline(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.ReleaseConfiguration) (string, error) {
@@ -73,8 +119,11 @@ func fetchReleasePipeline(ctx context.Context, cdClient *deploy.CloudDeployClien
 
 func createRelease(ctx context.Context, cdClient *deploy.CloudDeployClient, gcsClient *storage.Client, flags *config.ReleaseConfiguration, pipelineUUID string) error {
 	release := &deploypb.Release{
-		Name:        fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s/releases/%s", flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release),
-		Description: flags.Description,
+		Name:             fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s/releases/%s", flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release),
+		Description:      flags.Description,
+		Annotations:      flags.Annotations,
+		Labels:           flags.Labels,
+		DeployParameters: flags.DeployParameters,
 	}
 
 	if flags.SkaffoldVersion != "" {
@@ -85,15 +134,28 @@ func createRelease(ctx context.Context, cdClient *deploy.CloudDeployClient, gcsC
 		release.SkaffoldVersion = flags.SkaffoldVersion
 	}
 
+	images := flags.Images
+	if flags.BuildArtifacts != "" {
+		var err error
+		images, err = ReadBuildArtifacts(flags.BuildArtifacts)
+		if err != nil {
+			return err
+		}
+	}
+	if err := setSkaffoldFile(ctx, flags, release); err != nil {
+		return fmt.Errorf("failed to set skaffold file: %w", err)
+	}
+	// report the errors of the skaffold config before the source is uploaded
+	if err := validateSkaffoldConfig(flags.Source, release.SkaffoldConfigPath, images); err != nil {
+		return fmt.Errorf("invalid skaffold config: %w", err)
+	}
+
 	if err := gcs.SetSource(ctx, pipelineUUID, flags, gcsClient, release); err != nil {
 		return fmt.Errorf("failed to set source: %w", err)
 	}
-	if err := setImages(flags.Images, release); err != nil {
+	if err := setImages(images, release); err != nil {
 		return fmt.Errorf("failed to set images: %w", err)
 	}
-	if err := setSkaffoldFile(ctx, flags, release); err != nil {
-		return fmt.Errorf("failed to set skaffold file: %w", err)
-	}
 
 	req := &deploypb.CreateReleaseRequest{
 		Parent:    fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s", flags.ProjectId, flags.Region, flags.DeliveryPipeline),
@@ -138,6 +200,39 @@ func setImages(images map[string]string, releaseConfig *deploypb.Release) error
 	return nil
 }
 
+// skaffoldBuildArtifacts is the build artifacts file written by skaffold build --file-output.
+type skaffoldBuildArtifacts struct {
+	Builds []struct {
+		ImageName string `json:"imageName"`
+		Tag       string `json:"tag"`
+	} `json:"builds"`
+}
+
+// ReadBuildArtifacts reads the images of a skaffold build artifacts file into a map of image name
+// to tag, like the --images flag.
+func ReadBuildArtifacts(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build artifacts file: %w", err)
+	}
+	var artifacts skaffoldBuildArtifacts
+	if err := json.Unmarshal(data, &artifacts); err != nil {
+		return nil, fmt.Errorf("failed to parse build artifacts file %s: %w", path, err)
+	}
+
+	images := make(map[string]string, len(artifacts.Builds))
+	for _, build := range artifacts.Builds {
+		if build.ImageName == "" || build.Tag == "" {
+			return nil, fmt.Errorf("invalid build in build artifacts file %s: imageName and tag are required", path)
+		}
+		if _, ok := images[build.ImageName]; ok {
+			return nil, fmt.Errorf("duplicate image %s in build artifacts file %s", build.ImageName, path)
+		}
+		images[build.ImageName] = build.Tag
+	}
+	return images, nil
+}
+
 // setSkaffoldFile sets the release.SkaffoldConfigPath field or it returns error when failed
 func setSkaffoldFile(ctx context.Context, flags *config.ReleaseConfiguration, releaseConfig *deploypb.Release) error {
 	parsedSkaffoldFile := flags.SkaffoldFile
@@ -221,6 +316,16 @@ func validateSkaffoldFileExist(source, skaffoldFile string) error {
 	return nil
 }
 
+// validateSkaffoldConfig parses and checks the skaffold config of a local source directory. Archives
+// and Cloud Storage sources are not checked.
+func validateSkaffoldConfig(source, skaffoldFile string, images map[string]string) error {
+	if info, err := os.Stat(source); strings.HasPrefix(source, "gs://") || err != nil || !info.IsDir() {
+		fmt.Println("Skipping skaffold config validation: source is not a local directory")
+		return nil
+	}
+	return skaffold.Validate(source, skaffoldFile, images)
+}
+
 func validateSkaffoldIsInArchive(source, skaffoldFile string) error {
 	file, err := os.Open(source)
 	if err != nil {
@@ -313,31 +418,129 @@ func getCloudDeployConfig(ctx context.Context, projectId, region string, client
 	return config, nil
 }
 
-// parseDictString converts the image string to a map[string]string
+// ParseDictString converts a comma separated list of key=value pairs to a map[string]string.
+// Values, and keys, can be quoted with double or single quotes to contain commas, equal signs and
+// spaces, which are not allowed outside of quotes. A quote only opens a quoted key or value at its
+// start, elsewhere it is part of the key or value.
 // Ex:
 // image1=path/to/image1:v1,image2=path/to/image2:v1 =>
 // {"image1": "path/to/image1:v1", "image2": "path/to/image2:v1"}
+// note="a=b, c",owner=team =>
+// {"note": "a=b, c", "owner": "team"}
+// msg=it's,title="it's" =>
+// {"msg": "it's", "title": "it's"}
 func ParseDictString(input string) (map[string]string, error) {
 	if input == "" {
 		return nil, nil
 	}
 
-	if strings.Contains(input, " ") {
-		return nil, fmt.Errorf("invalid dict value: %s, the dict string should not contain space", input)
-	}
 	res := make(map[string]string)
-	pairs := strings.Split(input, ",")
-	for _, pair := range pairs {
-		kv := strings.Split(pair, "=")
-		if len(kv) != 2 {
-			return nil, fmt.Errorf("invalid key-value pair: %s", pair)
+	var key, current strings.Builder
+	var quote rune
+	hasKey := false
+	addPair := func(pair string) error {
+		if !hasKey {
+			return fmt.Errorf("invalid key-value pair: %s", pair)
 		}
+		if key.Len() == 0 {
+			return fmt.Errorf("invalid key-value pair: %s, the key should not be empty", pair)
+		}
+		res[key.String()] = current.String()
+		key.Reset()
+		current.Reset()
+		hasKey = false
+		return nil
+	}
 
-		key := kv[0]
-		val := kv[1]
-
-		res[key] = val
+	// pairStart and valueStart are the indexes where the current pair and the current key or
+	// value start
+	pairStart, valueStart := 0, 0
+	for i, c := range input {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case (c == '"' || c == '\'') && i == valueStart:
+			quote = c
+		case c == ' ':
+			return nil, fmt.Errorf("invalid dict value: %s, the dict string should not contain space outside of quotes", input)
+		case c == '=':
+			if hasKey {
+				return nil, fmt.Errorf("invalid key-value pair: %s, quote the value to use '='", input[pairStart:])
+			}
+			key.WriteString(current.String())
+			current.Reset()
+			hasKey = true
+			valueStart = i + 1
+		case c == ',':
+			if err := addPair(input[pairStart:i]); err != nil {
+				return nil, err
+			}
+			pairStart, valueStart = i+1, i+1
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("invalid dict value: %s, unterminated quote", input)
+	}
+	if err := addPair(input[pairStart:]); err != nil {
+		return nil, err
 	}
 
 	return res, nil
 }
+
+var (
+	// labelKeyRegexp and labelValueRegexp match the keys and values of Cloud Deploy labels, where
+	// international characters count as lower-case letters.
+	labelKeyRegexp   = regexp.MustCompile(`^[\p{Ll}\p{Lo}][\p{Ll}\p{Lo}\p{N}_-]{0,62}$`)
+	labelValueRegexp = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{0,63}$`)
+	// annotationNameRegexp matches the name of an annotation key, and annotationPrefixRegexp its
+	// optional DNS subdomain prefix.
+	annotationNameRegexp   = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,61}[a-zA-Z0-9])?$`)
+	annotationPrefixRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]{0,251}[a-z0-9])?$`)
+)
+
+// ValidateLabels checks the labels against the rules of Cloud Deploy: keys start with a lower-case
+// letter, and keys and values have at most 63 lower-case letters, numbers, underscores and hyphens.
+// International characters are allowed, as letters that have no case or are lower-case.
+func ValidateLabels(labels map[string]string) error {
+	for _, k := range sortedKeys(labels) {
+		if !labelKeyRegexp.MatchString(k) {
+			return fmt.Errorf("invalid label key: %s, it must start with a lower-case letter and contain at most 63 lower-case letters, numbers, underscores, and hyphens", k)
+		}
+		if !labelValueRegexp.MatchString(labels[k]) {
+			return fmt.Errorf("invalid value of label %s: %s, it must contain at most 63 lower-case letters, numbers, underscores, and hyphens", k, labels[k])
+		}
+	}
+	return nil
+}
+
+// ValidateAnnotations checks the annotation keys against the rules of Cloud Deploy: an optional
+// DNS subdomain prefix and a '/', followed by a name of at most 63 characters that begins and ends
+// with a letter or number, with '-', '_' and '.' in between.
+func ValidateAnnotations(annotations map[string]string) error {
+	for _, k := range sortedKeys(annotations) {
+		prefix, name, hasPrefix := strings.Cut(k, "/")
+		if !hasPrefix {
+			prefix, name = "", k
+		}
+		if (hasPrefix && !annotationPrefixRegexp.MatchString(prefix)) || !annotationNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid annotation key: %s, it must be an optional DNS subdomain prefix and '/', followed by at most 63 letters, numbers, '-', '_', and '.', beginning and ending with a letter or number", k)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -17,7 +17,9 @@ package release
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"cloud.google.com/go/deploy/apiv1/deploypb"
@@ -132,6 +134,31 @@ func TestParseDictString_Success(t *testing.T) {
 				"label2": "val2",
 			},
 		},
+		{
+			name:  "quoted values",
+			input: `note="a=b, c",query='x=1,y=2',empty=`,
+			expectedDict: map[string]string{
+				"note":  "a=b, c",
+				"query": "x=1,y=2",
+				"empty": "",
+			},
+		},
+		{
+			name:  "embedded quotes",
+			input: `msg=it's,title="it's",size=5'10"`,
+			expectedDict: map[string]string{
+				"msg":   "it's",
+				"title": "it's",
+				"size":  `5'10"`,
+			},
+		},
+		{
+			name:  "quoted key",
+			input: `"a,b"=c`,
+			expectedDict: map[string]string{
+				"a,b": "c",
+			},
+		},
 	}
 	for _, tc := range tcs {
 		res, err := ParseDictString(tc.input)
@@ -314,3 +341,188 @@ func TestSetSkaffoldFile_AbsolutePath_Success(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateInitialRolloutFlags_Failed(t *testing.T) {
+	tcs := []struct {
+		name        string
+		flags       *config.ReleaseConfiguration
+		expectedErr error
+	}{
+		{
+			name:  "invalid rollout id",
+			flags: &config.ReleaseConfiguration{RolloutId: "Rollout_1"},
+			expectedErr: fmt.Errorf("invalid --rollout-id value: Rollout_1, it must start with a lower-case letter, " +
+				"contain only lower-case letters, numbers, and hyphens, and be at most 63 characters"),
+		}, {
+			name:        "skip with rollout id",
+			flags:       &config.ReleaseConfiguration{SkipInitialRollout: true, RolloutId: "rollout-1"},
+			expectedErr: fmt.Errorf("--rollout-id cannot be used with --skip-initial-rollout"),
+		}, {
+			name:        "skip with phase id",
+			flags:       &config.ReleaseConfiguration{SkipInitialRollout: true, InitialRolloutPhaseId: "stable"},
+			expectedErr: fmt.Errorf("--initial-rollout-phase-id cannot be used with --skip-initial-rollout"),
+		}, {
+			name:        "skip with wait",
+			flags:       &config.ReleaseConfiguration{SkipInitialRollout: true, Wait: true},
+			expectedErr: fmt.Errorf("--wait cannot be used with --skip-initial-rollout"),
+		},
+	}
+
+	for _, tc := range tcs {
+		err := ValidateInitialRolloutFlags(tc.flags)
+		if err == nil {
+			t.Fatalf("expected error calling ValidateInitialRolloutFlags() for %s", tc.name)
+		}
+		if diff := cmp.Diff(tc.expectedErr.Error(), err.Error()); diff != "" {
+			t.Errorf("mismatched error: %s", diff)
+		}
+	}
+}
+
+func TestParseDictString_Failed(t *testing.T) {
+	tcs := []struct {
+		name        string
+		input       string
+		expectedErr error
+	}{
+		{
+			name:        "space",
+			input:       "key=a b",
+			expectedErr: fmt.Errorf("invalid dict value: key=a b, the dict string should not contain space outside of quotes"),
+		}, {
+			name:        "unquoted equal sign",
+			input:       "key=a=b",
+			expectedErr: fmt.Errorf("invalid key-value pair: key=a=b, quote the value to use '='"),
+		}, {
+			name:        "missing value",
+			input:       "key1=val1,key2",
+			expectedErr: fmt.Errorf("invalid key-value pair: key2"),
+		}, {
+			name:        "empty key",
+			input:       "=val",
+			expectedErr: fmt.Errorf("invalid key-value pair: =val, the key should not be empty"),
+		}, {
+			name:        "unterminated quote",
+			input:       `key="val`,
+			expectedErr: fmt.Errorf(`invalid dict value: key="val, unterminated quote`),
+		},
+	}
+	for _, tc := range tcs {
+		_, err := ParseDictString(tc.input)
+		if err == nil {
+			t.Fatalf("expected error calling ParseDictString() for %s", tc.name)
+		}
+		if diff := cmp.Diff(tc.expectedErr.Error(), err.Error()); diff != "" {
+			t.Errorf("mismatched error: %s", diff)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(map[string]string{"team": "web_app-1", "empty": "", "équipe": "données", "团队": "网站"}); err != nil {
+		t.Errorf("unexpected error calling ValidateLabels(): %s", err)
+	}
+
+	tcs := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{name: "upper-case key", labels: map[string]string{"Team": "web"}},
+		{name: "international upper-case key", labels: map[string]string{"Équipe": "web"}},
+		{name: "international upper-case value", labels: map[string]string{"team": "Données"}},
+		{name: "key starting with a number", labels: map[string]string{"1team": "web"}},
+		{name: "key too long", labels: map[string]string{strings.Repeat("a", 64): "web"}},
+		{name: "invalid value", labels: map[string]string{"team": "web.app"}},
+	}
+	for _, tc := range tcs {
+		if err := ValidateLabels(tc.labels); err == nil {
+			t.Errorf("expected error calling ValidateLabels() for %s", tc.name)
+		}
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	valid := map[string]string{
+		"owner":                     "Web Team",
+		"example.com/build.id":      "1234",
+		"deploy.cloud.google.com/x": "y",
+	}
+	if err := ValidateAnnotations(valid); err != nil {
+		t.Errorf("unexpected error calling ValidateAnnotations(): %s", err)
+	}
+
+	tcs := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{name: "name ending with a dot", annotations: map[string]string{"owner.": "web"}},
+		{name: "empty name", annotations: map[string]string{"example.com/": "web"}},
+		{name: "invalid prefix", annotations: map[string]string{"Example_com/owner": "web"}},
+		{name: "name too long", annotations: map[string]string{strings.Repeat("a", 64): "web"}},
+	}
+	for _, tc := range tcs {
+		if err := ValidateAnnotations(tc.annotations); err == nil {
+			t.Errorf("expected error calling ValidateAnnotations() for %s", tc.name)
+		}
+	}
+}
+
+func TestReadBuildArtifacts(t *testing.T) {
+	tcs := []struct {
+		name           string
+		content        string
+		expectedImages map[string]string
+		expectErr      bool
+	}{
+		{
+			name: "builds",
+			content: `{"builds":[
+				{"imageName":"gcr.io/p/app","tag":"gcr.io/p/app:v1@sha256:abc="},
+				{"imageName":"gcr.io/p/worker","tag":"gcr.io/p/worker:v1"}
+			]}`,
+			expectedImages: map[string]string{
+				"gcr.io/p/app":    "gcr.io/p/app:v1@sha256:abc=",
+				"gcr.io/p/worker": "gcr.io/p/worker:v1",
+			},
+		}, {
+			name:           "no builds",
+			content:        `{"builds":[]}`,
+			expectedImages: map[string]string{},
+		}, {
+			name:      "missing tag",
+			content:   `{"builds":[{"imageName":"gcr.io/p/app"}]}`,
+			expectErr: true,
+		}, {
+			name:      "duplicate image",
+			content:   `{"builds":[{"imageName":"app","tag":"app:v1"},{"imageName":"app","tag":"app:v2"}]}`,
+			expectErr: true,
+		}, {
+			name:      "invalid json",
+			content:   `builds: []`,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "artifacts.json")
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatalf("os.WriteFile() = %v", err)
+			}
+
+			images, err := ReadBuildArtifacts(path)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error calling ReadBuildArtifacts(), got %v", images)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error calling ReadBuildArtifacts(): %s", err)
+			}
+			if diff := cmp.Diff(tc.expectedImages, images); diff != "" {
+				t.Errorf("mismatched images calling ReadBuildArtifacts(): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	deploy "cloud.google.com/go/deploy/apiv1"
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+)
+
+// RenderPollInterval is the interval between two polls of a release that is rendering.
+var RenderPollInterval = 5 * time.Second
+
+// waitForRender polls the release until it is rendered for every target. It prints the failure
+// cause and the Cloud Build logs of each target that failed to render, and returns an error if any
+// did, or if the render does not complete within the timeout, if positive.
+func waitForRender(ctx context.Context, cdClient *deploy.CloudDeployClient, name string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(RenderPollInterval)
+	defer ticker.Stop()
+
+	fmt.Println("Waiting for the release to render...")
+	for {
+		release, err := cdClient.GetRelease(ctx, &deploypb.GetReleaseRequest{Name: name})
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timed out after %v waiting for release %s to render", timeout, name)
+			}
+			return fmt.Errorf("err getting release: %w", err)
+		}
+
+		switch release.RenderState {
+		case deploypb.Release_IN_PROGRESS:
+		case deploypb.Release_FAILED:
+			return renderFailure(release)
+		default:
+			fmt.Printf("Release render state: %s\n", release.RenderState)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v waiting for release %s to render", timeout, name)
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderFailure prints the render failure of each target of the release, and returns an error
+// naming them.
+func renderFailure(release *deploypb.Release) error {
+	targets := make([]string, 0, len(release.TargetRenders))
+	for target := range release.TargetRenders {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var failed []string
+	for _, target := range targets {
+		render := release.TargetRenders[target]
+		if render.RenderingState != deploypb.Release_TargetRender_FAILED {
+			continue
+		}
+		failed = append(failed, target)
+		fmt.Printf("Render of target %s failed: %s (%s)\n", target, render.FailureMessage, render.FailureCause)
+		if link := buildLogsLink(render.RenderingBuild); link != "" {
+			fmt.Printf("Logs of the render of target %s: %s\n", target, link)
+		}
+	}
+
+	if len(failed) == 0 {
+		return fmt.Errorf("release %s failed to render", release.Name)
+	}
+	return fmt.Errorf("release %s failed to render for target(s): %s", release.Name, strings.Join(failed, ", "))
+}
+
+// buildLogsLink returns the Cloud Console link to the logs of the build, named
+// projects/{project}/locations/{location}/builds/{build}, or "" if the name is not in that form.
+func buildLogsLink(build string) string {
+	parts := strings.Split(build, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "builds" {
+		return ""
+	}
+	return fmt.Sprintf("https://console.cloud.google.com/cloud-build/builds;region=%s/%s?project=%s", parts[3], parts[5], parts[1])
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package release
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+// releaseSequenceServer returns the releases in sequence, then the last one for every later poll.
+type releaseSequenceServer struct {
+	test.FakeCloudDeployServer
+	mu       sync.Mutex
+	releases []*deploypb.Release
+}
+
+func (s *releaseSequenceServer) GetRelease(ctx context.Context, req *deploypb.GetReleaseRequest) (*deploypb.Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.releases[0]
+	if len(s.releases) > 1 {
+		s.releases = s.releases[1:]
+	}
+	return r, nil
+}
+
+func TestWaitForRender(t *testing.T) {
+	RenderPollInterval = time.Millisecond
+	t.Cleanup(func() { RenderPollInterval = 5 * time.Second })
+
+	tcs := []struct {
+		name        string
+		releases    []*deploypb.Release
+		timeout     time.Duration
+		expectedErr string
+	}{
+		{
+			name: "succeeded",
+			releases: []*deploypb.Release{
+				{RenderState: deploypb.Release_IN_PROGRESS},
+				{RenderState: deploypb.Release_SUCCEEDED},
+			},
+		}, {
+			name: "failed",
+			releases: []*deploypb.Release{
+				{RenderState: deploypb.Release_IN_PROGRESS},
+				{
+					Name:        "test-release",
+					RenderState: deploypb.Release_FAILED,
+					TargetRenders: map[string]*deploypb.Release_TargetRender{
+						"prod": {
+							RenderingState: deploypb.Release_TargetRender_FAILED,
+							FailureCause:   deploypb.Release_TargetRender_EXECUTION_FAILED,
+							FailureMessage: "skaffold render failed",
+							RenderingBuild: "projects/123/locations/us-central1/builds/abc",
+						},
+						"staging": {
+							RenderingState: deploypb.Release_TargetRender_FAILED,
+						},
+						"test": {
+							RenderingState: deploypb.Release_TargetRender_SUCCEEDED,
+						},
+					},
+				},
+			},
+			expectedErr: "release test-release failed to render for target(s): prod, staging",
+		}, {
+			name: "timeout",
+			releases: []*deploypb.Release{
+				{RenderState: deploypb.Release_IN_PROGRESS},
+			},
+			timeout:     20 * time.Millisecond,
+			expectedErr: "timed out after 20ms waiting for release test-release to render",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			cdClient := test.CreateCloudDeployClientWithServer(t, ctx, &releaseSequenceServer{releases: tc.releases})
+
+			err := waitForRender(ctx, cdClient, "test-release", tc.timeout)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error calling waitForRender(): %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error calling waitForRender()")
+			}
+			if diff := cmp.Diff(tc.expectedErr, err.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildLogsLink(t *testing.T) {
+	tcs := []struct {
+		name         string
+		build        string
+		expectedLink string
+	}{
+		{
+			name:         "build name",
+			build:        "projects/123/locations/us-central1/builds/abc",
+			expectedLink: "https://console.cloud.google.com/cloud-build/builds;region=us-central1/abc?project=123",
+		}, {
+			name:  "no build",
+			build: "",
+		}, {
+			name:  "unexpected name",
+			build: "builds/abc",
+		},
+	}
+
+	for _, tc := range tcs {
+		if diff := cmp.Diff(tc.expectedLink, buildLogsLink(tc.build)); diff != "" {
+			t.Errorf("mismatched link for %s: %s", tc.name, diff)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"fmt"
+
+	deploy "cloud.google.com/go/deploy/apiv1"
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	ReleaseNameTemplate = "projects/%s/locations/%s/deliveryPipelines/%s/releases/%s"
+	RolloutNameTemplate = ReleaseNameTemplate + "/rollouts/%s"
+)
+
+// Promote creates a rollout of the release in the --to-target, or in the target of the pipeline
+// stage after the last one the release was successfully rolled out to, and waits for it with --wait.
+func Promote(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration) error {
+	releaseName := fmt.Sprintf(ReleaseNameTemplate, flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release)
+	release, err := cdClient.GetRelease(ctx, &deploypb.GetReleaseRequest{Name: releaseName})
+	if err != nil {
+		return fmt.Errorf("err getting release: %w", err)
+	}
+
+	toTargetId := flags.ToTarget
+	if toTargetId == "" {
+		deployed, err := succeededTargets(ctx, cdClient, releaseName)
+		if err != nil {
+			return err
+		}
+		toTargetId, err = getNextTargetId(release, deployed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return createRolloutInTarget(ctx, cdClient, release, toTargetId, &config.ReleaseConfiguration{
+		DeliveryPipeline:         flags.DeliveryPipeline,
+		Region:                   flags.Region,
+		ProjectId:                flags.ProjectId,
+		Release:                  flags.Release,
+		InitialRolloutPhaseId:    flags.PhaseId,
+		InitialRolloutAnotations: flags.Annotations,
+		InitialRolloutLabels:     flags.Labels,
+		Wait:                     flags.Wait,
+		WaitTimeout:              flags.WaitTimeout,
+	})
+}
+
+// Approve approves the rollout if approved is true, and rejects it otherwise. With --wait, an
+// approved rollout is then waited for.
+func Approve(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration, approved bool) error {
+	action := "Approving"
+	if !approved {
+		action = "Rejecting"
+	}
+	fmt.Printf("%s Cloud Deploy rollout: %s...\n", action, flags.Rollout)
+	_, err := cdClient.ApproveRollout(ctx, &deploypb.ApproveRolloutRequest{
+		Name:     rolloutName(flags),
+		Approved: approved,
+	})
+	if err != nil {
+		return fmt.Errorf("err approving rollout: %w", err)
+	}
+	if approved && flags.Wait {
+		return WaitForRollout(ctx, cdClient, rolloutName(flags), flags.WaitTimeout)
+	}
+	return nil
+}
+
+// Advance advances the rollout to the --phase-id, or to its first pending phase, and waits for the
+// rollout with --wait.
+func Advance(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration) error {
+	phaseId := flags.PhaseId
+	if phaseId == "" {
+		r, err := cdClient.GetRollout(ctx, &deploypb.GetRolloutRequest{Name: rolloutName(flags)})
+		if err != nil {
+			return fmt.Errorf("err getting rollout: %w", err)
+		}
+		phaseId, err = getNextPhaseId(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Advancing Cloud Deploy rollout: %s to phase %s...\n", flags.Rollout, phaseId)
+	_, err := cdClient.AdvanceRollout(ctx, &deploypb.AdvanceRolloutRequest{
+		Name:    rolloutName(flags),
+		PhaseId: phaseId,
+	})
+	if err != nil {
+		return fmt.Errorf("err advancing rollout: %w", err)
+	}
+	if flags.Wait {
+		return WaitForRollout(ctx, cdClient, rolloutName(flags), flags.WaitTimeout)
+	}
+	return nil
+}
+
+// Cancel cancels the rollout.
+func Cancel(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration) error {
+	fmt.Printf("Cancelling Cloud Deploy rollout: %s...\n", flags.Rollout)
+	_, err := cdClient.CancelRollout(ctx, &deploypb.CancelRolloutRequest{Name: rolloutName(flags)})
+	if err != nil {
+		return fmt.Errorf("err cancelling rollout: %w", err)
+	}
+	return nil
+}
+
+// RetryJob retries the job of the phase of the rollout, and waits for the rollout with --wait.
+func RetryJob(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration) error {
+	fmt.Printf("Retrying job %s in phase %s of Cloud Deploy rollout: %s...\n", flags.JobId, flags.PhaseId, flags.Rollout)
+	_, err := cdClient.RetryJob(ctx, &deploypb.RetryJobRequest{
+		Rollout: rolloutName(flags),
+		PhaseId: flags.PhaseId,
+		JobId:   flags.JobId,
+	})
+	if err != nil {
+		return fmt.Errorf("err retrying job: %w", err)
+	}
+	if flags.Wait {
+		return WaitForRollout(ctx, cdClient, rolloutName(flags), flags.WaitTimeout)
+	}
+	return nil
+}
+
+func rolloutName(flags *config.RolloutConfiguration) string {
+	return fmt.Sprintf(RolloutNameTemplate, flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release, flags.Rollout)
+}
+
+// succeededTargets returns the targets the release was successfully rolled out to.
+func succeededTargets(ctx context.Context, cdClient *deploy.CloudDeployClient, releaseName string) (map[string]bool, error) {
+	it := cdClient.ListRollouts(ctx, &deploypb.ListRolloutsRequest{Parent: releaseName})
+	targets := map[string]bool{}
+	for {
+		r, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error when iterating rollouts: %w", err)
+		}
+		if r.State == deploypb.Rollout_SUCCEEDED {
+			targets[r.TargetId] = true
+		}
+	}
+	return targets, nil
+}
+
+// getNextTargetId returns the target of the pipeline stage after the last one deployed to, or of
+// the first stage when the release was not deployed yet.
+func getNextTargetId(release *deploypb.Release, deployed map[string]bool) (string, error) {
+	stages := release.DeliveryPipelineSnapshot.GetSerialPipeline().GetStages()
+	if len(stages) == 0 {
+		return "", fmt.Errorf("no pipeline stages in the release %s", release.Name)
+	}
+
+	next := 0
+	for i, stage := range stages {
+		if deployed[stage.TargetId] {
+			next = i + 1
+		}
+	}
+	if next == len(stages) {
+		return "", fmt.Errorf("release %s is already deployed to the last target %s of the pipeline", release.Name, stages[len(stages)-1].TargetId)
+	}
+	return stages[next].TargetId, nil
+}
+
+// getNextPhaseId returns the first pending phase of the rollout.
+func getNextPhaseId(r *deploypb.Rollout) (string, error) {
+	for _, phase := range r.Phases {
+		if phase.State == deploypb.Phase_PENDING {
+			return phase.Id, nil
+		}
+	}
+	return "", fmt.Errorf("no pending phase to advance to in the rollout %s", r.Name)
+}
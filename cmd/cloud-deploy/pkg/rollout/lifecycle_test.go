@@ -0,0 +1,141 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRolloutLifecycle(t *testing.T) {
+	flags := &config.RolloutConfiguration{
+		ProjectId:        "id",
+		Region:           "global",
+		DeliveryPipeline: "test-pipeline",
+		Release:          "test-release",
+		Rollout:          "test-release-to-test-id-0001",
+		PhaseId:          "stable",
+		JobId:            "deploy",
+	}
+
+	ctx := context.Background()
+	cdClient := test.CreateCloudDeployClient(t, ctx)
+
+	if err := Promote(ctx, cdClient, flags); err != nil {
+		t.Errorf("unexpected error when calling Promote: %s", err)
+	}
+	if err := Approve(ctx, cdClient, flags, true); err != nil {
+		t.Errorf("unexpected error when calling Approve: %s", err)
+	}
+	if err := Approve(ctx, cdClient, flags, false); err != nil {
+		t.Errorf("unexpected error when calling Approve to reject: %s", err)
+	}
+	if err := Advance(ctx, cdClient, &config.RolloutConfiguration{Rollout: flags.Rollout}); err != nil {
+		t.Errorf("unexpected error when calling Advance without a phase: %s", err)
+	}
+	if err := Cancel(ctx, cdClient, flags); err != nil {
+		t.Errorf("unexpected error when calling Cancel: %s", err)
+	}
+	if err := RetryJob(ctx, cdClient, flags); err != nil {
+		t.Errorf("unexpected error when calling RetryJob: %s", err)
+	}
+}
+
+func TestGetNextTargetId(t *testing.T) {
+	release := &deploypb.Release{
+		Name: "test-release",
+		DeliveryPipelineSnapshot: &deploypb.DeliveryPipeline{
+			Pipeline: &deploypb.DeliveryPipeline_SerialPipeline{
+				SerialPipeline: &deploypb.SerialPipeline{
+					Stages: []*deploypb.Stage{
+						{TargetId: "test-id"},
+						{TargetId: "staging-id"},
+						{TargetId: "prod-id"},
+					},
+				},
+			},
+		},
+	}
+	tcs := []struct {
+		name             string
+		deployed         map[string]bool
+		expectedTargetId string
+		expectErr        bool
+	}{
+		{
+			name:             "not deployed",
+			deployed:         map[string]bool{},
+			expectedTargetId: "test-id",
+		}, {
+			name:             "deployed to first target",
+			deployed:         map[string]bool{"test-id": true},
+			expectedTargetId: "staging-id",
+		}, {
+			name:             "deployed to a later target only",
+			deployed:         map[string]bool{"staging-id": true},
+			expectedTargetId: "prod-id",
+		}, {
+			name:      "deployed to last target",
+			deployed:  map[string]bool{"test-id": true, "staging-id": true, "prod-id": true},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			targetId, err := getNextTargetId(release, tc.deployed)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error calling getNextTargetId(), got target %s", targetId)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error calling getNextTargetId(): %s", err)
+			}
+			if diff := cmp.Diff(tc.expectedTargetId, targetId); diff != "" {
+				t.Errorf("mismatched target id when calling getNextTargetId(): %s", diff)
+			}
+		})
+	}
+}
+
+func TestGetNextPhaseId(t *testing.T) {
+	r := &deploypb.Rollout{
+		Phases: []*deploypb.Phase{
+			{Id: "canary-25", State: deploypb.Phase_SUCCEEDED},
+			{Id: "canary-50", State: deploypb.Phase_PENDING},
+			{Id: "stable", State: deploypb.Phase_PENDING},
+		},
+	}
+	phaseId, err := getNextPhaseId(r)
+	if err != nil {
+		t.Fatalf("unexpected error calling getNextPhaseId(): %s", err)
+	}
+	if diff := cmp.Diff("canary-50", phaseId); diff != "" {
+		t.Errorf("mismatched phase id when calling getNextPhaseId(): %s", diff)
+	}
+
+	r.Phases[1].State = deploypb.Phase_SUCCEEDED
+	r.Phases[2].State = deploypb.Phase_IN_PROGRESS
+	if _, err := getNextPhaseId(r); err == nil {
+		t.Errorf("expected error calling getNextPhaseId() without a pending phase")
+	}
+}
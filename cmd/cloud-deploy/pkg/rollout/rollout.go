@@ -31,11 +31,25 @@ func CreateRollout(ctx context.Context, cdClient *deploy.CloudDeployClient, flag
 	if err != nil {
 		return err
 	}
-	finalRollOutId, err := generateRolloutId(ctx, cdClient, toTargetId, release, flags)
-	if err != nil {
+	return createRolloutInTarget(ctx, cdClient, release, toTargetId, flags)
+}
+
+// createRolloutInTarget creates a rollout of the release in the target, named by --rollout-id or
+// else after RolloutIdTemplate.
+func createRolloutInTarget(ctx context.Context, cdClient *deploy.CloudDeployClient, release *deploypb.Release, toTargetId string, flags *config.ReleaseConfiguration) error {
+	if err := validateStartingPhaseId(release, toTargetId, flags.InitialRolloutPhaseId); err != nil {
 		return err
 	}
 
+	finalRollOutId := flags.RolloutId
+	if finalRollOutId == "" {
+		var err error
+		finalRollOutId, err = generateRolloutId(ctx, cdClient, toTargetId, release, flags)
+		if err != nil {
+			return err
+		}
+	}
+
 	req := &deploypb.CreateRolloutRequest{
 		Parent:          fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s/releases/%s", flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release),
 		RolloutId:       finalRollOutId,
@@ -44,6 +58,7 @@ func CreateRollout(ctx context.Context, cdClient *deploy.CloudDeployClient, flag
 		Rollout: &deploypb.Rollout{
 			Name:        fmt.Sprintf("projects/%s/locations/%s/deliveryPipelines/%s/releases/%s/rollouts/%s", flags.ProjectId, flags.Region, flags.DeliveryPipeline, flags.Release, finalRollOutId),
 			TargetId:    toTargetId,
+			Description: flags.RolloutDescription,
 			Annotations: flags.InitialRolloutAnotations,
 			Labels:      flags.InitialRolloutLabels,
 		},
@@ -72,6 +87,9 @@ func CreateRollout(ctx context.Context, cdClient *deploy.CloudDeployClient, flag
 		fmt.Println("The rollout is pending approval...")
 	}
 
+	if flags.Wait {
+		return WaitForRollout(ctx, cdClient, req.Rollout.Name, flags.WaitTimeout)
+	}
 	return nil
 }
 
@@ -128,3 +146,44 @@ func generateRolloutId(ctx context.Context, cdClient *deploy.CloudDeployClient,
 
 	return "", fmt.Errorf("rollout name space exhausted in release %s. Use --rollout-id to specify rollout ID", release.Name)
 }
+
+// validateStartingPhaseId checks that the phase is a phase of the strategy of the target's stage in
+// the pipeline of the release. The phase is left for the API to check when the target is not a
+// stage of the pipeline.
+func validateStartingPhaseId(release *deploypb.Release, toTargetId, phaseId string) error {
+	if phaseId == "" {
+		return nil
+	}
+	for _, stage := range release.DeliveryPipelineSnapshot.GetSerialPipeline().GetStages() {
+		if stage.TargetId != toTargetId {
+			continue
+		}
+		phaseIds := strategyPhaseIds(stage.Strategy)
+		for _, id := range phaseIds {
+			if id == phaseId {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid starting phase: %s, the phases of target %s are: %s", phaseId, toTargetId, strings.Join(phaseIds, ", "))
+	}
+	return nil
+}
+
+// strategyPhaseIds returns the ids of the phases of a rollout with the deployment strategy.
+func strategyPhaseIds(strategy *deploypb.Strategy) []string {
+	canary := strategy.GetCanary()
+	if custom := canary.GetCustomCanaryDeployment(); custom != nil {
+		var phaseIds []string
+		for _, phase := range custom.PhaseConfigs {
+			phaseIds = append(phaseIds, phase.PhaseId)
+		}
+		return phaseIds
+	}
+
+	var phaseIds []string
+	for _, percentage := range canary.GetCanaryDeployment().GetPercentages() {
+		phaseIds = append(phaseIds, fmt.Sprintf("canary-%d", percentage))
+	}
+	// a standard strategy, like the default one, has the stable phase only
+	return append(phaseIds, "stable")
+}
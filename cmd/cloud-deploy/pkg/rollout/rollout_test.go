@@ -105,3 +105,85 @@ func TestGetToTargetId(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateStartingPhaseId(t *testing.T) {
+	release := &deploypb.Release{
+		DeliveryPipelineSnapshot: &deploypb.DeliveryPipeline{
+			Pipeline: &deploypb.DeliveryPipeline_SerialPipeline{
+				SerialPipeline: &deploypb.SerialPipeline{
+					Stages: []*deploypb.Stage{
+						{
+							TargetId: "test-id",
+						}, {
+							TargetId: "staging-id",
+							Strategy: &deploypb.Strategy{
+								DeploymentStrategy: &deploypb.Strategy_Canary{
+									Canary: &deploypb.Canary{
+										Mode: &deploypb.Canary_CanaryDeployment{
+											CanaryDeployment: &deploypb.CanaryDeployment{Percentages: []int32{25, 50}},
+										},
+									},
+								},
+							},
+						}, {
+							TargetId: "prod-id",
+							Strategy: &deploypb.Strategy{
+								DeploymentStrategy: &deploypb.Strategy_Canary{
+									Canary: &deploypb.Canary{
+										Mode: &deploypb.Canary_CustomCanaryDeployment{
+											CustomCanaryDeployment: &deploypb.CustomCanaryDeployment{
+												PhaseConfigs: []*deploypb.CustomCanaryDeployment_PhaseConfig{
+													{PhaseId: "first", Percentage: 10},
+													{PhaseId: "stable", Percentage: 100},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	tcs := []struct {
+		name        string
+		targetId    string
+		phaseId     string
+		expectedErr string
+	}{
+		{name: "no phase", targetId: "test-id"},
+		{name: "standard stable", targetId: "test-id", phaseId: "stable"},
+		{name: "canary phase", targetId: "staging-id", phaseId: "canary-50"},
+		{name: "custom canary phase", targetId: "prod-id", phaseId: "first"},
+		{name: "unknown target", targetId: "other-id", phaseId: "anything"},
+		{
+			name:        "standard canary phase",
+			targetId:    "test-id",
+			phaseId:     "canary-25",
+			expectedErr: "invalid starting phase: canary-25, the phases of target test-id are: stable",
+		}, {
+			name:        "canary unknown phase",
+			targetId:    "staging-id",
+			phaseId:     "canary-75",
+			expectedErr: "invalid starting phase: canary-75, the phases of target staging-id are: canary-25, canary-50, stable",
+		},
+	}
+
+	for _, tc := range tcs {
+		err := validateStartingPhaseId(release, tc.targetId, tc.phaseId)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error calling validateStartingPhaseId() for %s: %s", tc.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected error calling validateStartingPhaseId() for %s", tc.name)
+		}
+		if diff := cmp.Diff(tc.expectedErr, err.Error()); diff != "" {
+			t.Errorf("mismatched error: %s", diff)
+		}
+	}
+}
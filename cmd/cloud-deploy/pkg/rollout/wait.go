@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	deploy "cloud.google.com/go/deploy/apiv1"
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+)
+
+// PollInterval is the interval between two polls of a rollout that is waited for.
+var PollInterval = 10 * time.Second
+
+// WaitForRollout polls the rollout until it succeeds, and prints the state transitions of the
+// rollout, its phases and their jobs along the way. It returns an error when the rollout fails, is
+// cancelled, rejected or halted, or when it does not complete within the timeout, if positive. A
+// rollout that is pending approval, or whose next phase waits to be advanced such as a canary, is
+// returned without an error, as it only completes once approved or advanced.
+func WaitForRollout(ctx context.Context, cdClient *deploy.CloudDeployClient, name string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	w := &rolloutWatcher{cdClient: cdClient, states: map[string]string{}}
+	fmt.Printf("Waiting for Cloud Deploy rollout: %s...\n", name)
+	for {
+		r, err := cdClient.GetRollout(ctx, &deploypb.GetRolloutRequest{Name: name})
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timed out after %v waiting for rollout %s", timeout, name)
+			}
+			return fmt.Errorf("err getting rollout: %w", err)
+		}
+		w.report(ctx, r)
+
+		switch r.State {
+		case deploypb.Rollout_SUCCEEDED:
+			return nil
+		case deploypb.Rollout_FAILED, deploypb.Rollout_CANCELLED, deploypb.Rollout_APPROVAL_REJECTED, deploypb.Rollout_HALTED:
+			reason := r.FailureReason
+			if reason == "" {
+				reason = w.lastFailure
+			}
+			if reason == "" {
+				return fmt.Errorf("rollout %s is %s", name, r.State)
+			}
+			return fmt.Errorf("rollout %s is %s: %s", name, r.State, reason)
+		case deploypb.Rollout_PENDING_APPROVAL:
+			fmt.Println("Rollout is pending approval, approve it with 'rollout approve'")
+			return nil
+		case deploypb.Rollout_IN_PROGRESS:
+			if phase := phaseToAdvance(r); phase != nil {
+				fmt.Printf("Rollout is waiting to be advanced to phase %s, advance it with 'rollout advance'\n", phase.Id)
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v waiting for rollout %s, last state %s", timeout, name, r.State)
+		case <-time.After(PollInterval):
+		}
+	}
+}
+
+// rolloutWatcher prints the changes of state of a rollout between two polls.
+type rolloutWatcher struct {
+	cdClient *deploy.CloudDeployClient
+	// states holds the last state printed for the rollout, each phase and each job
+	states map[string]string
+	// lastFailure is the failure message of the last job that failed
+	lastFailure string
+}
+
+func (w *rolloutWatcher) report(ctx context.Context, r *deploypb.Rollout) {
+	if w.changed("rollout", r.State.String()) {
+		fmt.Printf("Rollout %s\n", r.State)
+	}
+	for _, phase := range r.Phases {
+		if w.changed("phase/"+phase.Id, phase.State.String()) {
+			fmt.Printf("Phase %s: %s\n", phase.Id, phase.State)
+		}
+		for _, job := range phaseJobs(phase) {
+			if !w.changed("job/"+phase.Id+"/"+job.Id, job.State.String()) {
+				continue
+			}
+			fmt.Printf("Job %s in phase %s: %s\n", job.Id, phase.Id, job.State)
+			if job.State == deploypb.Job_FAILED {
+				w.reportFailure(ctx, phase, job)
+			}
+		}
+	}
+}
+
+// changed records the state under the key and returns true if it differs from the previous one.
+func (w *rolloutWatcher) changed(key, state string) bool {
+	if w.states[key] == state {
+		return false
+	}
+	w.states[key] = state
+	return true
+}
+
+// reportFailure prints the failure of the run of the failed job.
+func (w *rolloutWatcher) reportFailure(ctx context.Context, phase *deploypb.Phase, job *deploypb.Job) {
+	if job.JobRun == "" {
+		return
+	}
+	jobRun, err := w.cdClient.GetJobRun(ctx, &deploypb.GetJobRunRequest{Name: job.JobRun})
+	if err != nil {
+		fmt.Printf("Unable to get the run of job %s in phase %s: %s\n", job.Id, phase.Id, err)
+		return
+	}
+	if failure := jobRunFailure(jobRun); failure != "" {
+		w.lastFailure = fmt.Sprintf("job %s in phase %s failed: %s", job.Id, phase.Id, failure)
+		fmt.Printf("Job %s in phase %s failed: %s\n", job.Id, phase.Id, failure)
+	}
+}
+
+// phaseToAdvance returns the phase that the rollout waits to be advanced to, which is the first
+// pending phase once the phases before it succeeded or were skipped, or nil if there is none.
+func phaseToAdvance(r *deploypb.Rollout) *deploypb.Phase {
+	succeeded := false
+	for _, phase := range r.Phases {
+		switch phase.State {
+		case deploypb.Phase_SUCCEEDED:
+			succeeded = true
+		case deploypb.Phase_SKIPPED:
+		case deploypb.Phase_PENDING:
+			if succeeded {
+				return phase
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// phaseJobs returns the jobs of the phase in the order they run.
+func phaseJobs(phase *deploypb.Phase) []*deploypb.Job {
+	var jobs []*deploypb.Job
+	if dj := phase.GetDeploymentJobs(); dj != nil {
+		for _, job := range []*deploypb.Job{dj.PredeployJob, dj.DeployJob, dj.VerifyJob, dj.PostdeployJob} {
+			if job != nil {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	if cj := phase.GetChildRolloutJobs(); cj != nil {
+		jobs = append(jobs, cj.CreateRolloutJobs...)
+		jobs = append(jobs, cj.AdvanceRolloutJobs...)
+	}
+	return jobs
+}
+
+// jobRunFailure returns the failure cause and message of the job run, if any.
+func jobRunFailure(jobRun *deploypb.JobRun) string {
+	var cause fmt.Stringer
+	var message string
+	switch {
+	case jobRun.GetDeployJobRun() != nil:
+		cause, message = jobRun.GetDeployJobRun().FailureCause, jobRun.GetDeployJobRun().FailureMessage
+	case jobRun.GetVerifyJobRun() != nil:
+		cause, message = jobRun.GetVerifyJobRun().FailureCause, jobRun.GetVerifyJobRun().FailureMessage
+	case jobRun.GetPredeployJobRun() != nil:
+		cause, message = jobRun.GetPredeployJobRun().FailureCause, jobRun.GetPredeployJobRun().FailureMessage
+	case jobRun.GetPostdeployJobRun() != nil:
+		cause, message = jobRun.GetPostdeployJobRun().FailureCause, jobRun.GetPostdeployJobRun().FailureMessage
+	default:
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", message, cause)
+}
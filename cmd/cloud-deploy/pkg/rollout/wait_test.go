@@ -0,0 +1,154 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/deploy/apiv1/deploypb"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/test"
+)
+
+// rolloutSequenceServer returns the rollouts in sequence, then the last one for every later poll.
+type rolloutSequenceServer struct {
+	test.FakeCloudDeployServer
+	mu       sync.Mutex
+	rollouts []*deploypb.Rollout
+	jobRun   *deploypb.JobRun
+}
+
+func (s *rolloutSequenceServer) GetRollout(ctx context.Context, req *deploypb.GetRolloutRequest) (*deploypb.Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rollouts[0]
+	if len(s.rollouts) > 1 {
+		s.rollouts = s.rollouts[1:]
+	}
+	return r, nil
+}
+
+func (s *rolloutSequenceServer) GetJobRun(ctx context.Context, req *deploypb.GetJobRunRequest) (*deploypb.JobRun, error) {
+	return s.jobRun, nil
+}
+
+func deployPhase(phaseState deploypb.Phase_State, jobState deploypb.Job_State) []*deploypb.Phase {
+	return []*deploypb.Phase{{
+		Id:    "stable",
+		State: phaseState,
+		Jobs: &deploypb.Phase_DeploymentJobs{
+			DeploymentJobs: &deploypb.DeploymentJobs{
+				DeployJob: &deploypb.Job{Id: "deploy", State: jobState, JobRun: "job-run"},
+			},
+		},
+	}}
+}
+
+func TestWaitForRollout(t *testing.T) {
+	PollInterval = time.Millisecond
+	t.Cleanup(func() { PollInterval = 10 * time.Second })
+
+	tcs := []struct {
+		name        string
+		rollouts    []*deploypb.Rollout
+		timeout     time.Duration
+		expectedErr string
+	}{
+		{
+			name: "succeeded",
+			rollouts: []*deploypb.Rollout{
+				{State: deploypb.Rollout_PENDING},
+				{State: deploypb.Rollout_IN_PROGRESS, Phases: deployPhase(deploypb.Phase_IN_PROGRESS, deploypb.Job_IN_PROGRESS)},
+				{State: deploypb.Rollout_SUCCEEDED, Phases: deployPhase(deploypb.Phase_SUCCEEDED, deploypb.Job_SUCCEEDED)},
+			},
+		},
+		{
+			name: "failed job",
+			rollouts: []*deploypb.Rollout{
+				{State: deploypb.Rollout_IN_PROGRESS, Phases: deployPhase(deploypb.Phase_IN_PROGRESS, deploypb.Job_IN_PROGRESS)},
+				{State: deploypb.Rollout_FAILED, Phases: deployPhase(deploypb.Phase_FAILED, deploypb.Job_FAILED)},
+			},
+			expectedErr: "rollout test-rollout is FAILED: job deploy in phase stable failed: deployment timed out (DEADLINE_EXCEEDED)",
+		},
+		{
+			name: "failure reason",
+			rollouts: []*deploypb.Rollout{
+				{State: deploypb.Rollout_CANCELLED, FailureReason: "cancelled by user"},
+			},
+			expectedErr: "rollout test-rollout is CANCELLED: cancelled by user",
+		},
+		{
+			name: "pending approval",
+			rollouts: []*deploypb.Rollout{
+				{State: deploypb.Rollout_PENDING},
+				{State: deploypb.Rollout_PENDING_APPROVAL},
+			},
+			timeout: time.Minute,
+		},
+		{
+			name: "canary waiting to be advanced",
+			rollouts: []*deploypb.Rollout{
+				{State: deploypb.Rollout_IN_PROGRESS, Phases: []*deploypb.Phase{
+					{Id: "canary-25", State: deploypb.Phase_IN_PROGRESS},
+					{Id: "stable", State: deploypb.Phase_PENDING},
+				}},
+				{State: deploypb.Rollout_IN_PROGRESS, Phases: []*deploypb.Phase{
+					{Id: "canary-25", State: deploypb.Phase_SUCCEEDED},
+					{Id: "stable", State: deploypb.Phase_PENDING},
+				}},
+			},
+			timeout: time.Minute,
+		},
+		{
+			name: "timeout",
+			rollouts: []*deploypb.Rollout{
+				{State: deploypb.Rollout_IN_PROGRESS, Phases: deployPhase(deploypb.Phase_IN_PROGRESS, deploypb.Job_IN_PROGRESS)},
+			},
+			timeout:     20 * time.Millisecond,
+			expectedErr: "timed out after 20ms waiting for rollout test-rollout",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			cdClient := test.CreateCloudDeployClientWithServer(t, ctx, &rolloutSequenceServer{
+				rollouts: tc.rollouts,
+				jobRun: &deploypb.JobRun{
+					JobRun: &deploypb.JobRun_DeployJobRun{
+						DeployJobRun: &deploypb.DeployJobRun{
+							FailureCause:   deploypb.DeployJobRun_DEADLINE_EXCEEDED,
+							FailureMessage: "deployment timed out",
+						},
+					},
+				},
+			})
+
+			err := WaitForRollout(ctx, cdClient, "test-rollout", tc.timeout)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error calling WaitForRollout(): %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expectedErr) {
+				t.Errorf("mismatched error calling WaitForRollout(): got %v, want %s", err, tc.expectedErr)
+			}
+		})
+	}
+}
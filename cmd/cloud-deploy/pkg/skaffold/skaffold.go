@@ -0,0 +1,358 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package skaffold parses skaffold configs locally, to report the errors Cloud Deploy would only
+// report once the release is rendered.
+package skaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Config is the part of a skaffold config that Cloud Deploy renders, for the v2 to v4 schemas.
+// See https://skaffold.dev/docs/references/yaml/
+type Config struct {
+	APIVersion string     `yaml:"apiVersion"`
+	Kind       string     `yaml:"kind"`
+	Metadata   Metadata   `yaml:"metadata"`
+	Requires   []Requires `yaml:"requires"`
+	Pipeline   `yaml:",inline"`
+	Profiles   []Profile `yaml:"profiles"`
+}
+
+// Metadata names a config, so that it can be required by name.
+type Metadata struct {
+	Name string `yaml:"name"`
+}
+
+// Requires is a dependency on the configs of another skaffold file.
+type Requires struct {
+	// Path is a skaffold file, or a directory with a skaffold.yaml file.
+	Path    string   `yaml:"path"`
+	Configs []string `yaml:"configs"`
+	// Git is a remote dependency, which cannot be checked locally.
+	Git any `yaml:"git"`
+	// GoogleCloudStorage is a remote dependency, which cannot be checked locally.
+	GoogleCloudStorage any `yaml:"googleCloudStorage"`
+}
+
+// Profile overrides the pipeline of a config.
+type Profile struct {
+	Name     string `yaml:"name"`
+	Pipeline `yaml:",inline"`
+}
+
+// Pipeline holds the manifests and deployers of a config or a profile.
+type Pipeline struct {
+	Manifests Manifests `yaml:"manifests"`
+	Deploy    Deploy    `yaml:"deploy"`
+}
+
+// Manifests are the manifests rendered by the v3 and v4 schemas.
+type Manifests struct {
+	RawYAML   []string   `yaml:"rawYaml"`
+	Kustomize *Kustomize `yaml:"kustomize"`
+	Helm      *Helm      `yaml:"helm"`
+	Kpt       []string   `yaml:"kpt"`
+}
+
+// Deploy are the deployers, which also hold the manifests in the v2 schema.
+type Deploy struct {
+	Kubectl   *Kubectl   `yaml:"kubectl"`
+	Kustomize *Kustomize `yaml:"kustomize"`
+	Helm      *Helm      `yaml:"helm"`
+	Kpt       any        `yaml:"kpt"`
+	CloudRun  any        `yaml:"cloudrun"`
+	// Docker deploys to a local docker daemon, and is not supported by Cloud Deploy.
+	Docker any `yaml:"docker"`
+}
+
+type Kubectl struct {
+	Manifests []string `yaml:"manifests"`
+}
+
+type Kustomize struct {
+	Paths []string `yaml:"paths"`
+}
+
+type Helm struct {
+	Releases []HelmRelease `yaml:"releases"`
+}
+
+type HelmRelease struct {
+	Name        string   `yaml:"name"`
+	ChartPath   string   `yaml:"chartPath"`
+	RemoteChart string   `yaml:"remoteChart"`
+	ValuesFiles []string `yaml:"valuesFiles"`
+}
+
+// unsupportedDeployers returns the deployers of the pipeline that Cloud Deploy does not support.
+func (p Pipeline) unsupportedDeployers() []string {
+	if p.Deploy.Docker != nil {
+		return []string{"docker"}
+	}
+	return nil
+}
+
+// rawManifests returns the patterns of the plain manifests of the pipeline, whose images can be
+// read without rendering them.
+func (p Pipeline) rawManifests() []string {
+	patterns := append([]string{}, p.Manifests.RawYAML...)
+	if p.Deploy.Kubectl != nil {
+		patterns = append(patterns, p.Deploy.Kubectl.Manifests...)
+	}
+	return patterns
+}
+
+// renderedPaths returns the kustomize, helm and kpt paths of the pipeline, whose manifests are
+// only known once rendered.
+func (p Pipeline) renderedPaths() []string {
+	var paths []string
+	for _, k := range []*Kustomize{p.Manifests.Kustomize, p.Deploy.Kustomize} {
+		if k != nil {
+			paths = append(paths, k.Paths...)
+		}
+	}
+	for _, h := range []*Helm{p.Manifests.Helm, p.Deploy.Helm} {
+		if h == nil {
+			continue
+		}
+		for _, r := range h.Releases {
+			if r.ChartPath != "" {
+				paths = append(paths, r.ChartPath)
+			}
+			paths = append(paths, r.ValuesFiles...)
+		}
+	}
+	return append(paths, p.Manifests.Kpt...)
+}
+
+// imageRegexp matches the image fields of manifests.
+var imageRegexp = regexp.MustCompile(`(?m)^\s*-?\s*image:\s*["']?([^\s"'#]+)`)
+
+// Validate parses the skaffold config at configPath, relative to the source directory, along with
+// the local configs it requires. It checks that the manifests, kustomize, helm and kpt paths exist,
+// that the deployers are supported by Cloud Deploy, and, when every manifest is a plain manifest,
+// that each of the images is referenced by a manifest. All the errors found are returned.
+func Validate(source, configPath string, images map[string]string) error {
+	if configPath == "" {
+		configPath = "skaffold.yaml"
+	}
+	v := &validator{source: source, loaded: map[string]bool{}}
+	v.load(filepath.Join(source, configPath), nil)
+	if v.configs == 0 && len(v.errs) == 0 {
+		v.errs = append(v.errs, fmt.Errorf("no skaffold config found in %s", configPath))
+	}
+
+	if len(images) > 0 {
+		if v.rendered {
+			fmt.Println("Skipping images check: the manifests are rendered by kustomize, helm or kpt")
+		} else {
+			v.checkImages(images)
+		}
+	}
+	return errors.Join(v.errs...)
+}
+
+// validator accumulates the configs and the errors found in them.
+type validator struct {
+	source string
+	// loaded holds the skaffold files already loaded, to load each file once
+	loaded map[string]bool
+	// configs is the number of configs loaded
+	configs int
+	// manifests holds the plain manifest files, and rendered is true if some manifests are rendered
+	manifests []string
+	rendered  bool
+	errs      []error
+}
+
+func (v *validator) errorf(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+// load parses the configs of the skaffold file named by names, or all of them if names is empty.
+func (v *validator) load(file string, names []string) {
+	file = filepath.Clean(file)
+	if v.loaded[file] {
+		return
+	}
+	v.loaded[file] = true
+
+	configs, err := parse(file)
+	if err != nil {
+		v.errs = append(v.errs, err)
+		return
+	}
+
+	found := map[string]bool{}
+	for _, c := range configs {
+		if len(names) > 0 && !slices.Contains(names, c.Metadata.Name) {
+			continue
+		}
+		found[c.Metadata.Name] = true
+		v.check(file, c)
+	}
+	for _, name := range names {
+		if !found[name] {
+			v.errorf("%s: required config %s not found", v.rel(file), name)
+		}
+	}
+}
+
+// parse returns the configs of the documents of the skaffold file.
+func parse(file string) ([]Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read skaffold file: %w", err)
+	}
+
+	var configs []Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var c Config
+		if err := dec.Decode(&c); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("could not parse skaffold file %s: %w", file, err)
+		}
+		configs = append(configs, c)
+	}
+	return configs, nil
+}
+
+// check checks the config of the skaffold file, and loads the configs it requires.
+func (v *validator) check(file string, c Config) {
+	v.configs++
+	name := v.rel(file)
+	if c.Metadata.Name != "" {
+		name += " (" + c.Metadata.Name + ")"
+	}
+	if c.Kind != "" && c.Kind != "Config" {
+		v.errorf("%s: unexpected kind %s, must be Config", name, c.Kind)
+	}
+
+	dir := filepath.Dir(file)
+	v.checkPipeline(name, dir, c.Pipeline)
+	for _, p := range c.Profiles {
+		v.checkPipeline(fmt.Sprintf("%s profile %s", name, p.Name), dir, p.Pipeline)
+	}
+
+	for _, r := range c.Requires {
+		if r.Git != nil || r.GoogleCloudStorage != nil || r.Path == "" {
+			continue
+		}
+		path := filepath.Join(dir, r.Path)
+		info, err := os.Stat(path)
+		if err != nil {
+			v.errorf("%s: required path %s does not exist in the source", name, r.Path)
+			continue
+		}
+		if info.IsDir() {
+			path = filepath.Join(path, "skaffold.yaml")
+		}
+		v.load(path, r.Configs)
+	}
+}
+
+func (v *validator) checkPipeline(name, dir string, p Pipeline) {
+	for _, deployer := range p.unsupportedDeployers() {
+		v.errorf("%s: the %s deployer is not supported by Cloud Deploy", name, deployer)
+	}
+
+	for _, pattern := range p.rawManifests() {
+		if isRemote(pattern) {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil || len(matches) == 0 {
+			v.errorf("%s: manifests %s do not exist in the source", name, pattern)
+			continue
+		}
+		v.manifests = append(v.manifests, matches...)
+	}
+
+	for _, path := range p.renderedPaths() {
+		v.rendered = true
+		if isRemote(path) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			v.errorf("%s: path %s does not exist in the source", name, path)
+		}
+	}
+}
+
+// checkImages checks that each of the images is referenced by one of the plain manifests.
+func (v *validator) checkImages(images map[string]string) {
+	referenced := map[string]bool{}
+	for _, file := range v.manifests {
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			v.errorf("could not read manifest %s: %s", v.rel(file), err)
+			continue
+		}
+		for _, m := range imageRegexp.FindAllSubmatch(data, -1) {
+			referenced[imageName(string(m[1]))] = true
+		}
+	}
+
+	keys := make([]string, 0, len(images))
+	for k := range images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !referenced[k] {
+			v.errorf("image %s is not referenced by any manifest", k)
+		}
+	}
+}
+
+// rel returns the path relative to the source, for the error messages.
+func (v *validator) rel(path string) string {
+	if rel, err := filepath.Rel(v.source, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// imageName returns the image reference without its tag or digest.
+func imageName(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+func isRemote(path string) bool {
+	return strings.Contains(path, "://")
+}
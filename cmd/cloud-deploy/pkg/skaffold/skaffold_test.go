@@ -0,0 +1,274 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeSource writes the files, keyed by path, into a source directory and returns it.
+func writeSource(t *testing.T, files map[string]string) string {
+	t.Helper()
+	source := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("os.MkdirAll() = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("os.WriteFile() = %v", err)
+		}
+	}
+	return source
+}
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: gcr.io/p/web:latest
+      - name: app
+        image: "gcr.io/p/app@sha256:abc"
+`
+
+func TestValidate_Success(t *testing.T) {
+	tcs := []struct {
+		name       string
+		files      map[string]string
+		configPath string
+		images     map[string]string
+	}{
+		{
+			name: "v2 kubectl",
+			files: map[string]string{
+				"skaffold.yaml": `apiVersion: skaffold/v2beta7
+kind: Config
+deploy:
+  kubectl:
+    manifests:
+    - k8s/*
+`,
+				"k8s/deployment.yaml": deployment,
+			},
+			images: map[string]string{"gcr.io/p/web": "gcr.io/p/web:v1", "gcr.io/p/app": "gcr.io/p/app:v1"},
+		}, {
+			name: "v4 multi-document with requires and profiles",
+			files: map[string]string{
+				"deploy/skaffold.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+metadata:
+  name: web
+requires:
+- path: ../shared
+  configs: [app]
+manifests:
+  rawYaml:
+  - k8s/deployment.yaml
+profiles:
+- name: prod
+  manifests:
+    rawYaml:
+    - k8s/prod.yaml
+---
+apiVersion: skaffold/v4beta7
+kind: Config
+metadata:
+  name: other
+deploy:
+  cloudrun: {}
+`,
+				"deploy/k8s/deployment.yaml": deployment,
+				"deploy/k8s/prod.yaml":       deployment,
+				"shared/skaffold.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+metadata:
+  name: app
+manifests:
+  rawYaml:
+  - service.yaml
+---
+apiVersion: skaffold/v4beta7
+kind: Config
+metadata:
+  name: ignored
+deploy:
+  docker: {}
+`,
+				"shared/service.yaml": "kind: Service\n",
+			},
+			configPath: "deploy/skaffold.yaml",
+			images:     map[string]string{"gcr.io/p/web": "gcr.io/p/web:v1"},
+		}, {
+			name: "rendered manifests skip images",
+			files: map[string]string{
+				"skaffold.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+manifests:
+  kustomize:
+    paths: [overlays/dev]
+  helm:
+    releases:
+    - name: app
+      chartPath: charts/app
+      valuesFiles: [values.yaml]
+    - name: remote
+      remoteChart: oci://example.com/chart
+`,
+				"overlays/dev/kustomization.yaml": "resources: []\n",
+				"charts/app/Chart.yaml":           "name: app\n",
+				"values.yaml":                     "replicas: 1\n",
+			},
+			images: map[string]string{"not-in-any-manifest": "tag"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			source := writeSource(t, tc.files)
+			if err := Validate(source, tc.configPath, tc.images); err != nil {
+				t.Errorf("unexpected error calling Validate(): %s", err)
+			}
+		})
+	}
+}
+
+func TestValidate_Failed(t *testing.T) {
+	tcs := []struct {
+		name         string
+		files        map[string]string
+		images       map[string]string
+		expectedErrs []string
+	}{
+		{
+			name: "missing paths",
+			files: map[string]string{
+				"skaffold.yaml": `apiVersion: skaffold/v2beta7
+kind: Config
+deploy:
+  kubectl:
+    manifests: [k8s/*]
+  kustomize:
+    paths: [overlays/prod]
+profiles:
+- name: prod
+  deploy:
+    helm:
+      releases:
+      - name: app
+        chartPath: charts/app
+`,
+			},
+			expectedErrs: []string{
+				"skaffold.yaml: manifests k8s/* do not exist in the source",
+				"skaffold.yaml: path overlays/prod does not exist in the source",
+				"skaffold.yaml profile prod: path charts/app does not exist in the source",
+			},
+		}, {
+			name: "unsupported deployer",
+			files: map[string]string{
+				"skaffold.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+metadata:
+  name: local
+deploy:
+  docker:
+    images: [app]
+`,
+			},
+			expectedErrs: []string{
+				"skaffold.yaml (local): the docker deployer is not supported by Cloud Deploy",
+			},
+		}, {
+			name: "unknown images",
+			files: map[string]string{
+				"skaffold.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+manifests:
+  rawYaml: [deployment.yaml]
+`,
+				"deployment.yaml": deployment,
+			},
+			images: map[string]string{"gcr.io/p/web": "v1", "gcr.io/p/worker": "v1", "web": "v1"},
+			expectedErrs: []string{
+				"image gcr.io/p/worker is not referenced by any manifest",
+				"image web is not referenced by any manifest",
+			},
+		}, {
+			name: "missing requires",
+			files: map[string]string{
+				"skaffold.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+requires:
+- path: missing
+- path: other.yaml
+  configs: [absent]
+`,
+				"other.yaml": `apiVersion: skaffold/v4beta7
+kind: Config
+metadata:
+  name: present
+`,
+			},
+			expectedErrs: []string{
+				"skaffold.yaml: required path missing does not exist in the source",
+				"other.yaml: required config absent not found",
+			},
+		}, {
+			name: "empty config",
+			files: map[string]string{
+				"skaffold.yaml": "# nothing to deploy\n",
+			},
+			expectedErrs: []string{
+				"no skaffold config found in skaffold.yaml",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			source := writeSource(t, tc.files)
+			err := Validate(source, "", tc.images)
+			if err == nil {
+				t.Fatalf("expected error calling Validate()")
+			}
+			if diff := cmp.Diff(tc.expectedErrs, strings.Split(err.Error(), "\n")); diff != "" {
+				t.Errorf("mismatched errors calling Validate(): %s", diff)
+			}
+		})
+	}
+}
+
+func TestImageName(t *testing.T) {
+	tcs := map[string]string{
+		"app":                              "app",
+		"gcr.io/p/app:v1":                  "gcr.io/p/app",
+		"gcr.io/p/app@sha256:abc":          "gcr.io/p/app",
+		"localhost:5000/app":               "localhost:5000/app",
+		"localhost:5000/app:v1@sha256:abc": "localhost:5000/app",
+	}
+	for ref, expected := range tcs {
+		if diff := cmp.Diff(expected, imageName(ref)); diff != "" {
+			t.Errorf("mismatched image name of %s: %s", ref, diff)
+		}
+	}
+}
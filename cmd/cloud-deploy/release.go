@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	deploy "cloud.google.com/go/deploy/apiv1"
 	"cloud.google.com/go/storage"
@@ -33,11 +34,16 @@ var (
 	initialRolloutAnnotationStr string
 	initialRolloutLabelStr      string
 	imagesStr                   string
+	annotationStr               string
+	labelStr                    string
+	deployParametersStr         string
 	userAgent                   string
 )
 
 const (
-	defaultSource = "."
+	defaultSource        = "."
+	defaultWaitTimeout   = time.Hour
+	defaultRenderTimeout = 30 * time.Minute
 )
 
 var releaseCmd = &cobra.Command{
@@ -50,21 +56,42 @@ var releaseCmd = &cobra.Command{
 			return fmt.Errorf("invalid --delivery-pipeline value: %s, only lower-case letters, numbers, and hyphens are allowed", flags.DeliveryPipeline)
 		}
 
-		flags.InitialRolloutAnotations, err = release.ParseDictString(initialRolloutAnnotationStr)
+		flags.InitialRolloutAnotations, err = parseDictFlag("initial-rollout-annotations", initialRolloutAnnotationStr, release.ValidateAnnotations)
 		if err != nil {
-			return fmt.Errorf("invalid --initial-rollout-annotations value: %w", err)
+			return err
+		}
+		flags.InitialRolloutLabels, err = parseDictFlag("initial-rollout-labels", initialRolloutLabelStr, release.ValidateLabels)
+		if err != nil {
+			return err
+		}
+		if imagesStr != "" && flags.BuildArtifacts != "" {
+			return fmt.Errorf("--images and --build-artifacts are mutually exclusive")
+		}
+		flags.Images, err = parseDictFlag("images", imagesStr, nil)
+		if err != nil {
+			return err
+		}
+		flags.Annotations, err = parseDictFlag("annotations", annotationStr, release.ValidateAnnotations)
+		if err != nil {
+			return err
 		}
-		flags.InitialRolloutLabels, err = release.ParseDictString(initialRolloutLabelStr)
+		flags.Labels, err = parseDictFlag("labels", labelStr, release.ValidateLabels)
 		if err != nil {
-			return fmt.Errorf("invalid --initial-rollout-labels value: %w", err)
+			return err
 		}
-		flags.Images, err = release.ParseDictString(imagesStr)
+		flags.DeployParameters, err = parseDictFlag("deploy-parameters", deployParametersStr, nil)
 		if err != nil {
-			return fmt.Errorf("invalid --images value: %w", err)
+			return err
 		}
 		if flags.Source == "" {
 			flags.Source = defaultSource
 		}
+		if err = release.ValidateInitialRolloutFlags(&flags); err != nil {
+			return err
+		}
+		if flags.WaitTimeout < 0 {
+			return fmt.Errorf("invalid --wait-timeout value: %s, must not be negative", flags.WaitTimeout)
+		}
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -96,14 +123,25 @@ func init() {
 	releaseCmd.PersistentFlags().StringVar(&flags.Source, "source", ".", "The source location containing skaffold.yaml")
 	releaseCmd.PersistentFlags().StringVar(&flags.Description, "description", "", "The description of the release")
 	releaseCmd.PersistentFlags().StringVar(&flags.InitialRolloutPhaseId, "initial-rollout-phase-id", "", "The phase to start the initial rollout at when creating the release")
+	releaseCmd.PersistentFlags().StringVar(&flags.RolloutId, "rollout-id", "", "The ID to assign to the initial rollout, defaults to <release>-to-<target>-<number>")
+	releaseCmd.PersistentFlags().StringVar(&flags.RolloutDescription, "rollout-description", "", "The description of the initial rollout")
+	releaseCmd.PersistentFlags().BoolVar(&flags.SkipInitialRollout, "skip-initial-rollout", false, "Skip creating the initial rollout, so that the release can be promoted later")
 	releaseCmd.PersistentFlags().StringVar(&flags.ToTarget, "to-target", "", "The target to deliver into upon release creation")
 	releaseCmd.PersistentFlags().StringVar(&flags.SkaffoldVersion, "skaffold-version", "", "The version of the Skaffold binary")
 	releaseCmd.PersistentFlags().StringVar(&flags.SkaffoldFile, "skaffold-file", "", "The path of the skaffold file absolute or relative to the source directory.")
 
 	releaseCmd.PersistentFlags().StringVar(&imagesStr, "images", "", "The images associated with the release")
+	releaseCmd.PersistentFlags().StringVar(&flags.BuildArtifacts, "build-artifacts", "", "Path to the build artifacts file written by skaffold build --file-output, whose images are associated with the release. Cannot be used with --images")
+	releaseCmd.PersistentFlags().StringVar(&annotationStr, "annotations", "", "Annotations to apply to the release, such as key1=val1,key2=\"val,2\"")
+	releaseCmd.PersistentFlags().StringVar(&labelStr, "labels", "", "Labels to apply to the release, such as key1=val1,key2=val2")
+	releaseCmd.PersistentFlags().StringVar(&deployParametersStr, "deploy-parameters", "", "Deploy parameters to apply to the release, such as key1=val1,key2=\"val,2\"")
 	releaseCmd.PersistentFlags().StringVar(&initialRolloutAnnotationStr, "initial-rollout-annotations", "", "Annotations to apply to the initial rollout when creating the release")
 	releaseCmd.PersistentFlags().StringVar(&initialRolloutLabelStr, "initial-rollout-labels", "", "Labels to apply to the initial rollout when creating the release")
 
+	releaseCmd.PersistentFlags().DurationVar(&flags.RenderTimeout, "render-timeout", defaultRenderTimeout, "The maximum time to wait for the release to render, before the initial rollout")
+	releaseCmd.PersistentFlags().BoolVar(&flags.Wait, "wait", false, "Wait for the initial rollout to complete, to be pending approval or to wait for an advance, and fail if it does not succeed")
+	releaseCmd.PersistentFlags().DurationVar(&flags.WaitTimeout, "wait-timeout", defaultWaitTimeout, "The maximum time to wait for the initial rollout with --wait")
+
 	releaseCmd.PersistentFlags().StringVar(&userAgent, "google-apis-user-agent", "", "The user-agent to be applied when calling Google APIs")
 
 	releaseCmd.MarkPersistentFlagRequired("delivery-pipeline")
@@ -111,3 +149,18 @@ func init() {
 	releaseCmd.MarkPersistentFlagRequired("project-id")
 	releaseCmd.MarkPersistentFlagRequired("name")
 }
+
+// parseDictFlag parses the value of the dict flag with release.ParseDictString, and checks the
+// result with validate if it is not nil.
+func parseDictFlag(name, value string, validate func(map[string]string) error) (map[string]string, error) {
+	dict, err := release.ParseDictString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s value: %w", name, err)
+	}
+	if validate != nil {
+		if err := validate(dict); err != nil {
+			return nil, fmt.Errorf("invalid --%s value: %w", name, err)
+		}
+	}
+	return dict, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	deploy "cloud.google.com/go/deploy/apiv1"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/config"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/release"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-deploy/pkg/rollout"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+var rolloutFlags config.RolloutConfiguration
+
+var (
+	rolloutAnnotationStr string
+	rolloutLabelStr      string
+)
+
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Manage the rollouts of a Cloud Deploy Release",
+	Long:  ``,
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote a Cloud Deploy Release to the next target of its pipeline",
+	Long:  ``,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if err = validateRolloutFlags(&rolloutFlags); err != nil {
+			return err
+		}
+		rolloutFlags.Annotations, err = parseDictFlag("annotations", rolloutAnnotationStr, release.ValidateAnnotations)
+		if err != nil {
+			return err
+		}
+		rolloutFlags.Labels, err = parseDictFlag("labels", rolloutLabelStr, release.ValidateLabels)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRolloutAction(rollout.Promote)
+	},
+}
+
+var approveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Approve a Cloud Deploy Rollout that is pending approval",
+	Long:  ``,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateRolloutFlags(&rolloutFlags)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRolloutAction(func(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration) error {
+			return rollout.Approve(ctx, cdClient, flags, true)
+		})
+	},
+}
+
+var rejectCmd = &cobra.Command{
+	Use:   "reject",
+	Short: "Reject a Cloud Deploy Rollout that is pending approval",
+	Long:  ``,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateRolloutFlags(&rolloutFlags)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRolloutAction(func(ctx context.Context, cdClient *deploy.CloudDeployClient, flags *config.RolloutConfiguration) error {
+			return rollout.Approve(ctx, cdClient, flags, false)
+		})
+	},
+}
+
+var advanceCmd = &cobra.Command{
+	Use:   "advance",
+	Short: "Advance a Cloud Deploy Rollout to its next phase",
+	Long:  ``,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateRolloutFlags(&rolloutFlags)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRolloutAction(rollout.Advance)
+	},
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel a Cloud Deploy Rollout",
+	Long:  ``,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateRolloutFlags(&rolloutFlags)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRolloutAction(rollout.Cancel)
+	},
+}
+
+var retryJobCmd = &cobra.Command{
+	Use:   "retry-job",
+	Short: "Retry a failed job of a Cloud Deploy Rollout",
+	Long:  ``,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateRolloutFlags(&rolloutFlags)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRolloutAction(rollout.RetryJob)
+	},
+}
+
+// runRolloutAction calls the action with a Cloud Deploy client and the rollout flags.
+func runRolloutAction(action func(context.Context, *deploy.CloudDeployClient, *config.RolloutConfiguration) error) error {
+	ctx := context.Background()
+	cdClient, err := deploy.NewCloudDeployClient(ctx, option.WithUserAgent(userAgent))
+	if err != nil {
+		return err
+	}
+	defer cdClient.Close()
+
+	return action(ctx, cdClient, &rolloutFlags)
+}
+
+func validateRolloutFlags(flags *config.RolloutConfiguration) error {
+	if strings.Contains(flags.DeliveryPipeline, "/") {
+		return fmt.Errorf("invalid --delivery-pipeline value: %s, only lower-case letters, numbers, and hyphens are allowed", flags.DeliveryPipeline)
+	}
+	if strings.Contains(flags.Release, "/") {
+		return fmt.Errorf("invalid --release value: %s, only lower-case letters, numbers, and hyphens are allowed", flags.Release)
+	}
+	if strings.Contains(flags.Rollout, "/") {
+		return fmt.Errorf("invalid --rollout value: %s, only lower-case letters, numbers, and hyphens are allowed", flags.Rollout)
+	}
+	if flags.WaitTimeout < 0 {
+		return fmt.Errorf("invalid --wait-timeout value: %s, must not be negative", flags.WaitTimeout)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(rolloutCmd)
+	rolloutCmd.AddCommand(promoteCmd, approveCmd, rejectCmd, advanceCmd, cancelCmd, retryJobCmd)
+
+	rolloutCmd.PersistentFlags().StringVar(&rolloutFlags.DeliveryPipeline, "delivery-pipeline", "", "The delivery pipeline associated with the release")
+	rolloutCmd.PersistentFlags().StringVar(&rolloutFlags.Region, "region", "", "The cloud region for the release")
+	rolloutCmd.PersistentFlags().StringVar(&rolloutFlags.ProjectId, "project-id", "", "The GCP project id")
+	rolloutCmd.PersistentFlags().StringVar(&rolloutFlags.Release, "release", "", "The name of the release")
+	rolloutCmd.PersistentFlags().StringVar(&userAgent, "google-apis-user-agent", "", "The user-agent to be applied when calling Google APIs")
+
+	promoteCmd.Flags().StringVar(&rolloutFlags.ToTarget, "to-target", "", "The target to promote the release to, defaults to the target after the last one the release was successfully rolled out to")
+	promoteCmd.Flags().StringVar(&rolloutFlags.PhaseId, "starting-phase-id", "", "The phase to start the rollout at")
+	promoteCmd.Flags().StringVar(&rolloutAnnotationStr, "annotations", "", "Annotations to apply to the rollout")
+	promoteCmd.Flags().StringVar(&rolloutLabelStr, "labels", "", "Labels to apply to the rollout")
+
+	for _, cmd := range []*cobra.Command{promoteCmd, approveCmd, advanceCmd, retryJobCmd} {
+		cmd.Flags().BoolVar(&rolloutFlags.Wait, "wait", false, "Wait for the rollout to complete, to be pending approval or to wait for an advance, and fail if it does not succeed")
+		cmd.Flags().DurationVar(&rolloutFlags.WaitTimeout, "wait-timeout", defaultWaitTimeout, "The maximum time to wait for the rollout with --wait")
+	}
+	for _, cmd := range []*cobra.Command{approveCmd, rejectCmd, advanceCmd, cancelCmd, retryJobCmd} {
+		cmd.Flags().StringVar(&rolloutFlags.Rollout, "rollout", "", "The name of the rollout")
+		cmd.MarkFlagRequired("rollout")
+	}
+	advanceCmd.Flags().StringVar(&rolloutFlags.PhaseId, "phase-id", "", "The phase to advance the rollout to, defaults to its next pending phase")
+	retryJobCmd.Flags().StringVar(&rolloutFlags.PhaseId, "phase-id", "", "The phase of the job to retry")
+	retryJobCmd.Flags().StringVar(&rolloutFlags.JobId, "job-id", "", "The job to retry")
+	retryJobCmd.MarkFlagRequired("phase-id")
+	retryJobCmd.MarkFlagRequired("job-id")
+
+	rolloutCmd.MarkPersistentFlagRequired("delivery-pipeline")
+	rolloutCmd.MarkPersistentFlagRequired("region")
+	rolloutCmd.MarkPersistentFlagRequired("project-id")
+	rolloutCmd.MarkPersistentFlagRequired("release")
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -25,7 +27,13 @@ func CreateGCSClient(t *testing.T, objects []fakestorage.Object) *storage.Client
 
 func CreateCloudDeployClient(t *testing.T, ctx context.Context) *deploy.CloudDeployClient {
 	t.Helper()
-	fakeCloudDeployServer := &FakeCloudDeployServer{}
+	return CreateCloudDeployClientWithServer(t, ctx, &FakeCloudDeployServer{})
+}
+
+// CreateCloudDeployClientWithServer creates a client of the server, which can embed
+// FakeCloudDeployServer to override some of its methods.
+func CreateCloudDeployClientWithServer(t *testing.T, ctx context.Context, fakeCloudDeployServer deploypb.CloudDeployServer) *deploy.CloudDeployClient {
+	t.Helper()
 	l, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		t.Fatal(err)
@@ -120,3 +128,119 @@ func (f *FakeCloudDeployServer) GetConfig(ctx context.Context, req *deploypb.Get
 		},
 	}, nil
 }
+
+func (f *FakeCloudDeployServer) GetRollout(ctx context.Context, req *deploypb.GetRolloutRequest) (*deploypb.Rollout, error) {
+	return &deploypb.Rollout{
+		Name:     req.Name,
+		TargetId: "test-id",
+		Phases: []*deploypb.Phase{
+			{
+				Id:    "canary-25",
+				State: deploypb.Phase_SUCCEEDED,
+			}, {
+				Id:    "stable",
+				State: deploypb.Phase_PENDING,
+			},
+		},
+	}, nil
+}
+
+func (f *FakeCloudDeployServer) ApproveRollout(ctx context.Context, req *deploypb.ApproveRolloutRequest) (*deploypb.ApproveRolloutResponse, error) {
+	return &deploypb.ApproveRolloutResponse{}, nil
+}
+
+func (f *FakeCloudDeployServer) AdvanceRollout(ctx context.Context, req *deploypb.AdvanceRolloutRequest) (*deploypb.AdvanceRolloutResponse, error) {
+	return &deploypb.AdvanceRolloutResponse{}, nil
+}
+
+func (f *FakeCloudDeployServer) CancelRollout(ctx context.Context, req *deploypb.CancelRolloutRequest) (*deploypb.CancelRolloutResponse, error) {
+	return &deploypb.CancelRolloutResponse{}, nil
+}
+
+func (f *FakeCloudDeployServer) RetryJob(ctx context.Context, req *deploypb.RetryJobRequest) (*deploypb.RetryJobResponse, error) {
+	return &deploypb.RetryJobResponse{}, nil
+}
+
+func (f *FakeCloudDeployServer) CreateDeliveryPipeline(ctx context.Context, req *deploypb.CreateDeliveryPipelineRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.DeliveryPipeline",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) UpdateDeliveryPipeline(ctx context.Context, req *deploypb.UpdateDeliveryPipelineRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.DeliveryPipeline",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) GetTarget(ctx context.Context, req *deploypb.GetTargetRequest) (*deploypb.Target, error) {
+	return nil, status.Errorf(codes.NotFound, "%s not found", req.Name)
+}
+
+func (f *FakeCloudDeployServer) CreateTarget(ctx context.Context, req *deploypb.CreateTargetRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.Target",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) UpdateTarget(ctx context.Context, req *deploypb.UpdateTargetRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.Target",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) GetAutomation(ctx context.Context, req *deploypb.GetAutomationRequest) (*deploypb.Automation, error) {
+	return nil, status.Errorf(codes.NotFound, "%s not found", req.Name)
+}
+
+func (f *FakeCloudDeployServer) CreateAutomation(ctx context.Context, req *deploypb.CreateAutomationRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.Automation",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) UpdateAutomation(ctx context.Context, req *deploypb.UpdateAutomationRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.Automation",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) GetCustomTargetType(ctx context.Context, req *deploypb.GetCustomTargetTypeRequest) (*deploypb.CustomTargetType, error) {
+	return nil, status.Errorf(codes.NotFound, "%s not found", req.Name)
+}
+
+func (f *FakeCloudDeployServer) CreateCustomTargetType(ctx context.Context, req *deploypb.CreateCustomTargetTypeRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.CustomTargetType",
+			}}}, nil
+}
+
+func (f *FakeCloudDeployServer) UpdateCustomTargetType(ctx context.Context, req *deploypb.UpdateCustomTargetTypeRequest) (*longrunningpb.Operation, error) {
+	return &longrunningpb.Operation{
+		Done: true,
+		Result: &longrunningpb.Operation_Response{
+			Response: &anypb.Any{
+				TypeUrl: "google.cloud.deploy.v1.CustomTargetType",
+			}}}, nil
+}
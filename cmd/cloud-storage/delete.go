@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/prune"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+var (
+	olderThan time.Duration
+	keepLast  int
+	byFolder  bool
+)
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete stale objects from GCS",
+	Long: "Delete the objects under a prefix that match the optional glob. With --older-than and --keep-last, " +
+		"only the objects, or folders with --by-folder, that are older and beyond the newest ones to keep are " +
+		"deleted.",
+	PreRunE: func(_ *cobra.Command, _ []string) error {
+		return validateDeleteFlags(source, glob, olderThan, keepLast)
+	},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		ctx := context.Background()
+		client, err := storage.NewClient(ctx, option.WithUserAgent(userAgent), option.WithQuotaProject(projID))
+		if err != nil {
+			return err
+		}
+		p := prune.Pruner{
+			Concurrency: concurrency,
+			Retry:       transfer.Retry{Retries: retries, Timeout: timeout},
+			OlderThan:   olderThan,
+			KeepLast:    keepLast,
+			ByFolder:    byFolder,
+		}
+		results, err := Delete(ctx, stiface.AdaptClient(client), source, glob, p, dryRun)
+		if err != nil || dryRun {
+			return err
+		}
+
+		if err := writeResultsFile(resultsFile, results); err != nil {
+			return err
+		}
+
+		successCount, failCount, uniqueErrors := summarizeResults(results)
+		printSummary("delete", len(results), successCount, failCount, uniqueErrors)
+		return checkFailures("delete", len(results), failCount, maxFailures)
+	},
+}
+
+// Delete lists the objects to delete under the source and deletes them, or only prints them when
+// dryRun is set.
+func Delete(ctx context.Context, client stiface.Client, source, glob string, p prune.Pruner,
+	dryRun bool) ([]transfer.Results, error) {
+	bucket, prefix, _ := strings.Cut(source, "/")
+	fmt.Printf("Parsed source into bucketName: %v and prefix: %v\n", bucket, prefix)
+	bh := client.Bucket(bucket)
+	inputs, err := p.Plan(ctx, bh, prefix, glob)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		for _, input := range inputs {
+			fmt.Printf("Delete: %v\n", input.ObjectName)
+		}
+		fmt.Printf("Delete plan: %d to delete\n", len(inputs))
+		return nil, nil
+	}
+	return p.DeleteObjects(inputs, bh), nil
+}
+
+func validateDeleteFlags(source, glob string, olderThan time.Duration, keepLast int) error {
+	if olderThan < 0 {
+		return fmt.Errorf("--older-than cannot be negative")
+	}
+	if keepLast < 0 {
+		return fmt.Errorf("--keep-last cannot be negative")
+	}
+	_, prefix, _ := strings.Cut(source, "/")
+	if strings.Trim(prefix, "/") == "" && glob == "" && olderThan == 0 && keepLast == 0 {
+		return fmt.Errorf("refusing to delete every object of the bucket, provide a prefix, a glob, " +
+			"--older-than or --keep-last")
+	}
+	return nil
+}
+
+// nolint: gochecknoinits
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.PersistentFlags().StringVarP(&source, "source", "s", "", "Name of the bucket to delete objects "+
+		"from. Can be in the format of either <bucketName> or <bucketName>/<prefix>. If a prefix is provided "+
+		"only objects under the prefix are deleted.")
+	deleteCmd.PersistentFlags().StringVarP(&glob, "glob", "g", "", "Glob pattern matched against the object "+
+		"names relative to the prefix. A '**' matches across folders.")
+	deleteCmd.PersistentFlags().DurationVar(&olderThan, "older-than", 0, "Only delete the objects created "+
+		"longer than this ago, such as '720h'.")
+	deleteCmd.PersistentFlags().IntVar(&keepLast, "keep-last", 0, "Keep the newest objects, or folders with "+
+		"--by-folder, whatever their age.")
+	deleteCmd.PersistentFlags().BoolVar(&byFolder, "by-folder", false, "Apply --older-than and --keep-last to "+
+		"each folder directly under the prefix as a whole, by the age of its newest object, so that the objects "+
+		"of a build are kept or deleted together.")
+	deleteCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the objects that would be deleted "+
+		"without deleting them.")
+	deleteCmd.PersistentFlags().StringVarP(&projID, "project-id", "p", "", "The google cloud project ID that will "+
+		"be used for quota or billing purposes. If set the caller must have 'serviceusage.services.use' permissions.")
+	deleteCmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", ConcurrencyDefault, "Number of objects to "+
+		"simultaneously delete, defaults to 100.")
+	deleteCmd.PersistentFlags().StringVarP(&userAgent, "google-apis-user-agent", "u", "", "The user-agent to be "+
+		"applied when calling Google APIs")
+
+	deleteCmd.PersistentFlags().IntVar(&retries, "retries", RetriesDefault, "Number of times a delete is "+
+		"retried after a retryable error such as a timeout, a 429 or a 5xx response. Retries back off "+
+		"exponentially. Defaults to 3.")
+	deleteCmd.PersistentFlags().DurationVar(&timeout, "timeout", time.Second*transfer.Timeout, "Timeout for a "+
+		"single delete attempt, defaults to 50s.")
+	deleteCmd.PersistentFlags().IntVar(&maxFailures, "max-failures", 0, "Number of objects that may fail to "+
+		"be deleted before the step fails. Defaults to 0, which fails the step on any error. Set to -1 to never "+
+		"fail the step.")
+	deleteCmd.PersistentFlags().StringVar(&resultsFile, "results-file", "", "Path of a file to write the JSON "+
+		"result of every attempted delete to.")
+
+	_ = deleteCmd.MarkPersistentFlagRequired("source")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/prune"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+func TestDelete_Success(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "bucketName", Name: "prefix/a.log"}, Content: []byte("a")},
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "bucketName", Name: "prefix/b.tar"}, Content: []byte("b")},
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "bucketName", Name: "other/c.log"}, Content: []byte("c")},
+	})
+	defer server.Stop()
+	client := stiface.AdaptClient(server.Client())
+	p := prune.Pruner{Concurrency: 100}
+
+	// a dry run deletes nothing
+	got, err := Delete(context.Background(), client, "bucketName/prefix", "*.log", p, true)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if got != nil {
+		t.Errorf("Delete() with dry run = %v, want no results", got)
+	}
+	if _, err := server.GetObject("bucketName", "prefix/a.log"); err != nil {
+		t.Errorf("dry run deleted prefix/a.log: %v", err)
+	}
+
+	want := []transfer.Results{{ObjectName: "prefix/a.log", Success: true}}
+	got, err = Delete(context.Background(), client, "bucketName/prefix", "*.log", p, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Delete(ctx, c, 'bucketName/prefix', '*.log', p, false) diff (-want +got):\n%s", diff)
+	}
+	if _, err := server.GetObject("bucketName", "prefix/a.log"); err == nil {
+		t.Error("prefix/a.log was not deleted")
+	}
+}
+
+func TestValidateDeleteFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		glob        string
+		olderThan   time.Duration
+		keepLast    int
+		expectedErr error
+	}{
+		{
+			name:        "WholeBucket",
+			source:      "bucketName/",
+			expectedErr: fmt.Errorf("refusing to delete every object of the bucket, provide a prefix, a glob, --older-than or --keep-last"),
+		},
+		{
+			name:        "NegativeOlderThan",
+			source:      "bucketName/prefix",
+			olderThan:   -time.Hour,
+			expectedErr: fmt.Errorf("--older-than cannot be negative"),
+		},
+		{
+			name:        "NegativeKeepLast",
+			source:      "bucketName/prefix",
+			keepLast:    -1,
+			expectedErr: fmt.Errorf("--keep-last cannot be negative"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateDeleteFlags(test.source, test.glob, test.olderThan, test.keepLast)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
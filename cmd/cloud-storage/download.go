@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/download"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+var source string
+
+// downloadCmd represents the download command
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download objects from GCS",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		ctx := context.Background()
+		client, err := storage.NewClient(ctx, option.WithUserAgent(userAgent), option.WithQuotaProject(projID))
+		if err != nil {
+			return err
+		}
+		results, err := Download(ctx, stiface.AdaptClient(client), source, path, glob, concurrency,
+			transfer.Retry{Retries: retries, Timeout: timeout})
+		if err != nil {
+			return err
+		}
+
+		if err := writeResultsFile(resultsFile, results); err != nil {
+			return err
+		}
+
+		successCount, failCount, uniqueErrors := summarizeResults(results)
+		printSummary("download", len(results), successCount, failCount, uniqueErrors)
+		return checkFailures("download", len(results), failCount, maxFailures)
+	},
+}
+
+func Download(ctx context.Context, client stiface.Client, source, path, glob string, concurrency int, retry transfer.Retry) ([]transfer.Results, error) {
+	bucket, prefix, _ := strings.Cut(source, "/")
+	fmt.Printf("Parsed source into bucketName: %v and prefix: %v\n", bucket, prefix)
+	bh := client.Bucket(bucket)
+	di, err := download.ProcessPrefix(ctx, bh, prefix, glob, path)
+	if err != nil {
+		return nil, err
+	}
+	d := download.Downloader{
+		Concurrency: concurrency,
+		Retry:       retry,
+	}
+
+	results := d.DownloadObjects(di, bh)
+	return results, nil
+}
+
+// nolint: gochecknoinits
+func init() {
+	rootCmd.AddCommand(downloadCmd)
+
+	downloadCmd.PersistentFlags().StringVarP(&source, "source", "s", "", "Name of the bucket source. Can be in the "+
+		"format of either <bucketName> or <bucketName>/<prefix>. If a prefix is provided only objects under the "+
+		"prefix are downloaded, and the prefix is removed from the local file names. If the prefix names a single "+
+		"object, only that object is downloaded.")
+	downloadCmd.PersistentFlags().StringVarP(&path, "path", "f", "", "Path to the local folder the objects are "+
+		"downloaded into. Missing folders are created. Defaults to the current directory.")
+	downloadCmd.PersistentFlags().StringVarP(&projID, "project-id", "p", "", "The google cloud project ID that will "+
+		"be used for quota or billing purposes. If set the caller must have 'serviceusage.services.use' permissions.")
+	downloadCmd.PersistentFlags().StringVarP(&glob, "glob", "g", "", "Glob pattern matched against the object "+
+		"names relative to the prefix. A '**' matches across folders.")
+	downloadCmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", ConcurrencyDefault, "Number of objects to "+
+		"simultaneously download, defaults to 100.")
+	downloadCmd.PersistentFlags().StringVarP(&userAgent, "google-apis-user-agent", "u", "", "The user-agent to be "+
+		"applied when calling Google APIs")
+
+	downloadCmd.PersistentFlags().IntVar(&retries, "retries", RetriesDefault, "Number of times a download is "+
+		"retried after a retryable error such as a timeout, a 429 or a 5xx response. Retries back off "+
+		"exponentially. Defaults to 3.")
+	downloadCmd.PersistentFlags().DurationVar(&timeout, "timeout", time.Second*transfer.Timeout, "Timeout for a "+
+		"single download attempt, defaults to 50s.")
+	downloadCmd.PersistentFlags().IntVar(&maxFailures, "max-failures", 0, "Number of objects that may fail to "+
+		"download before the step fails. Defaults to 0, which fails the step on any error. Set to -1 to never fail "+
+		"the step.")
+	downloadCmd.PersistentFlags().StringVar(&resultsFile, "results-file", "", "Path of a file to write the JSON "+
+		"result of every attempted download to.")
+
+	_ = downloadCmd.MarkPersistentFlagRequired("source")
+}
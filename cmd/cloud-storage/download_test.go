@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+func TestDownload_Success(t *testing.T) {
+	data := []byte("this is some example data")
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "bucketName", Name: "prefix/testFile.txt"},
+			Content:     data,
+		},
+	})
+	defer server.Stop()
+	tempDir := t.TempDir()
+
+	want := []transfer.Results{
+		{
+			FilePath:   filepath.Join(tempDir, "testFile.txt"),
+			ObjectName: "prefix/testFile.txt",
+			Success:    true,
+		},
+	}
+	got, err := Download(context.Background(), stiface.AdaptClient(server.Client()), "bucketName/prefix", tempDir, "", 100, transfer.Retry{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Download(ctx, c, 'bucketName/prefix', tempDir, '', 100) diff (-want +got):\n%s", diff)
+	}
+
+	content, err := os.ReadFile(want[0].FilePath)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%v) = %v", want[0].FilePath, err)
+	}
+	if diff := cmp.Diff(string(data), string(content)); diff != "" {
+		t.Errorf("downloaded content diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+type Downloader struct {
+	Concurrency int
+	// Retry bounds each download attempt, and sets how many times it is retried after a
+	// retryable error.
+	transfer.Retry
+}
+
+type DownloadInput struct {
+	ObjectName string
+	FilePath   string
+}
+
+// DownloadObjects will download each DownloadInput from the provided bucket. It will perform the
+// downloads concurrently up to the Downloader.Concurrency limit. Results are accumulated into a
+// transfer.Results array and returned when everything completes. It's possible that individual
+// downloads can have an error, and the caller can check transfer.Results.Success and
+// transfer.Results.Message for status and any error message
+func (d Downloader) DownloadObjects(inputs []DownloadInput, bucket stiface.BucketHandle) []transfer.Results {
+	results := make([]transfer.Results, len(inputs))
+	transfer.ForEachConcurrently(len(inputs), d.Concurrency, func(i int) {
+		results[i] = d.downloadFile(inputs[i], bucket)
+	})
+	return results
+}
+
+const GzipContentEncoding = "gzip"
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// downloadFile will download the object named in the DownloadInput into the FilePath of the
+// DownloadInput, creating any missing parent directories. Each attempt is bounded by the
+// Downloader's timeout and retried after a retryable error.
+func (d Downloader) downloadFile(input DownloadInput, bucket stiface.BucketHandle) transfer.Results {
+	result := transfer.Results{FilePath: input.FilePath, ObjectName: input.ObjectName}
+	err := d.WithRetries(func() error {
+		return d.downloadAttempt(input, bucket)
+	})
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// downloadAttempt makes a single attempt at downloading the object. Objects stored with a gzip
+// content-encoding are fetched as stored, checked against the object's CRC32C, and decompressed
+// on the way to disk. The object is read at the generation its attributes were fetched for, so a
+// concurrent overwrite fails the read instead of mixing the checksum of one generation with the
+// content of another. The object is written to a temporary file that replaces the target only
+// once the checksum matches, so a failed attempt leaves any existing file untouched.
+func (d Downloader) downloadAttempt(input DownloadInput, bucket stiface.BucketHandle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.AttemptTimeout())
+	defer cancel()
+
+	o := bucket.Object(input.ObjectName)
+	attrs, err := o.Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("ObjectHandle.Attrs: %w", err)
+	}
+
+	// read the object as stored so the checksum can be compared against the stored CRC32C
+	rc, err := o.Generation(attrs.Generation).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("ObjectHandle.NewReader: %w", err)
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(filepath.Dir(input.FilePath), os.ModePerm); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	// download next to the target, so an existing file is only replaced once the download is
+	// verified, and the rename stays on the same file system
+	f, err := os.CreateTemp(filepath.Dir(input.FilePath), "."+filepath.Base(input.FilePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := copyObject(f, rc, attrs.ContentEncoding, attrs.CRC32C); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(fileMode(input.FilePath)); err != nil {
+		f.Close()
+		return fmt.Errorf("File.Chmod: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("File.Close: %w", err)
+	}
+	if err := os.Rename(f.Name(), input.FilePath); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+	return nil
+}
+
+// fileMode returns the permissions of the file being replaced, or the default permissions of a
+// new file if there is none.
+func fileMode(filePath string) os.FileMode {
+	if info, err := os.Stat(filePath); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+// copyObject copies the raw object bytes from r into w, decompressing them if the object has a
+// gzip content-encoding. The CRC32C of the raw bytes is validated against the expected checksum.
+func copyObject(w io.Writer, r io.Reader, contentEncoding string, expectedCRC32C uint32) error {
+	hash := crc32.New(crc32cTable)
+	src := io.TeeReader(r, hash)
+
+	if contentEncoding == GzipContentEncoding {
+		gr, err := gzip.NewReader(src)
+		if err != nil {
+			return fmt.Errorf("gzip.NewReader: %w", err)
+		}
+		if _, err := io.Copy(w, gr); err != nil {
+			return fmt.Errorf("io.Copy: %w", err)
+		}
+		if err := gr.Close(); err != nil {
+			return fmt.Errorf("gzip.Reader.Close: %w", err)
+		}
+		// consume anything trailing the gzip stream so it is included in the checksum
+		if _, err := io.Copy(io.Discard, src); err != nil {
+			return fmt.Errorf("io.Copy: %w", err)
+		}
+	} else if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+
+	if got := hash.Sum32(); got != expectedCRC32C {
+		return fmt.Errorf("crc32c mismatch: got %d, want %d", got, expectedCRC32C)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/googleapi"
+)
+
+const testBucket = "test-bucket"
+
+func createBucketHandle(t *testing.T, objects []fakestorage.Object) stiface.BucketHandle {
+	t.Helper()
+	server := fakestorage.NewServer(objects)
+	t.Cleanup(server.Stop)
+	return createBucketHandleFromServer(server)
+}
+
+func createBucketHandleFromServer(server *fakestorage.Server) stiface.BucketHandle {
+	return stiface.AdaptClient(server.Client()).Bucket(testBucket)
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(data); err != nil {
+		t.Fatalf("failed to gzip data: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("failed to gzip data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadObjects_Success(t *testing.T) {
+	data := []byte("this is some example data")
+	b := createBucketHandle(t, []fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "plain.txt"},
+			Content:     data,
+		},
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "a/gzipped.txt", ContentEncoding: GzipContentEncoding},
+			Content:     gzipData(t, data),
+		},
+	})
+	tempDir := t.TempDir()
+	inputs := []DownloadInput{
+		{ObjectName: "plain.txt", FilePath: filepath.Join(tempDir, "plain.txt")},
+		{ObjectName: "a/gzipped.txt", FilePath: filepath.Join(tempDir, "a", "gzipped.txt")},
+	}
+
+	want := []transfer.Results{
+		{FilePath: inputs[0].FilePath, ObjectName: inputs[0].ObjectName, Success: true},
+		{FilePath: inputs[1].FilePath, ObjectName: inputs[1].ObjectName, Success: true},
+	}
+
+	d := Downloader{Concurrency: 2}
+	got := d.DownloadObjects(inputs, b)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DownloadObjects(inputs, b) diff (-want +got):\n%s", diff)
+	}
+
+	for _, input := range inputs {
+		content, err := os.ReadFile(input.FilePath)
+		if err != nil {
+			t.Fatalf("os.ReadFile(%v) = %v", input.FilePath, err)
+		}
+		if !bytes.Equal(content, data) {
+			t.Errorf("content of %v = %q, want %q", input.FilePath, content, data)
+		}
+	}
+}
+
+func TestDownloadObjects_MissingObject_Fail(t *testing.T) {
+	b := createBucketHandle(t, []fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "exists.txt"}},
+	})
+	filePath := filepath.Join(t.TempDir(), "missing.txt")
+
+	d := Downloader{Concurrency: 1}
+	got := d.DownloadObjects([]DownloadInput{{ObjectName: "missing.txt", FilePath: filePath}}, b)
+	if got[0].Success {
+		t.Errorf("DownloadObjects() expected failure for missing object")
+	}
+	if !strings.HasPrefix(got[0].Message, "ObjectHandle.Attrs") {
+		t.Errorf("DownloadObjects() message = %q, want prefix 'ObjectHandle.Attrs'", got[0].Message)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("expected no local file to be created for a failed download")
+	}
+}
+
+func TestDownloadObjects_ChecksumMismatch_KeepsExistingFile(t *testing.T) {
+	b := createBucketHandle(t, []fakestorage.Object{{
+		ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "corrupt.txt", Crc32c: "AAAAAA=="},
+		Content:     []byte("new data"),
+	}})
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "corrupt.txt")
+	if err := os.WriteFile(filePath, []byte("old data"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+
+	d := Downloader{Concurrency: 1}
+	got := d.DownloadObjects([]DownloadInput{{ObjectName: "corrupt.txt", FilePath: filePath}}, b)
+	if !strings.Contains(strings.ToLower(got[0].Message), "crc") {
+		t.Errorf("DownloadObjects() message = %q, want a checksum mismatch", got[0].Message)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%v) = %v", filePath, err)
+	}
+	if string(content) != "old data" {
+		t.Errorf("content of %v = %q, want the existing file to be kept", filePath, content)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("os.ReadDir(%v) = %v", dir, err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be removed, found %d files", len(entries))
+	}
+}
+
+// flakyBucket fails the first failures attempts at reading the attributes of an object, and
+// records the generations objects are read at.
+type flakyBucket struct {
+	stiface.BucketHandle
+	attempts    *int
+	failures    int
+	generations *[]int64
+}
+
+type flakyObject struct {
+	stiface.ObjectHandle
+	bucket flakyBucket
+}
+
+func (b flakyBucket) Object(name string) stiface.ObjectHandle {
+	return flakyObject{ObjectHandle: b.BucketHandle.Object(name), bucket: b}
+}
+
+func (o flakyObject) Attrs(ctx context.Context) (*storage.ObjectAttrs, error) {
+	*o.bucket.attempts++
+	if *o.bucket.attempts <= o.bucket.failures {
+		return nil, &googleapi.Error{Code: 503, Message: "backend unavailable"}
+	}
+	return o.ObjectHandle.Attrs(ctx)
+}
+
+func (o flakyObject) Generation(gen int64) stiface.ObjectHandle {
+	*o.bucket.generations = append(*o.bucket.generations, gen)
+	return o.ObjectHandle.Generation(gen)
+}
+
+func TestDownloadObjects_Retries(t *testing.T) {
+	tests := []struct {
+		name             string
+		retries          int
+		failures         int
+		expectedAttempts int
+		expectedSuccess  bool
+	}{
+		{name: "SucceedsAfterRetry", retries: 3, failures: 2, expectedAttempts: 3, expectedSuccess: true},
+		{name: "RetriesExhausted", retries: 2, failures: 5, expectedAttempts: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakestorage.NewServer([]fakestorage.Object{{
+				ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "plain.txt", Generation: 42},
+				Content:     []byte("this is some example data"),
+			}})
+			t.Cleanup(server.Stop)
+			attempts := 0
+			var generations []int64
+			b := flakyBucket{
+				BucketHandle: createBucketHandleFromServer(server),
+				attempts:     &attempts,
+				failures:     test.failures,
+				generations:  &generations,
+			}
+
+			d := Downloader{Concurrency: 1, Retry: transfer.Retry{Retries: test.retries, RetryBackoff: time.Millisecond}}
+			filePath := filepath.Join(t.TempDir(), "plain.txt")
+			got := d.DownloadObjects([]DownloadInput{{ObjectName: "plain.txt", FilePath: filePath}}, b)
+			if got[0].Success != test.expectedSuccess {
+				t.Errorf("DownloadObjects() success = %v, want %v (message: %v)", got[0].Success, test.expectedSuccess, got[0].Message)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("DownloadObjects() attempts = %d, want %d", attempts, test.expectedAttempts)
+			}
+
+			var expectedGenerations []int64
+			if test.expectedSuccess {
+				expectedGenerations = []int64{42}
+			}
+			if diff := cmp.Diff(expectedGenerations, generations); diff != "" {
+				t.Errorf("DownloadObjects() read generations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCopyObject_ChecksumMismatch_Fail(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := copyObject(buf, strings.NewReader("some data"), "", 1234)
+	if err == nil || !strings.HasPrefix(err.Error(), "crc32c mismatch") {
+		t.Errorf("copyObject() error = %v, want crc32c mismatch", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/glob"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/iterator"
+)
+
+// relativeObjectName returns the name of the object relative to the prefix, and whether the
+// object lives under the prefix at all. The prefix is treated as a folder, so with a prefix of
+// "foo" the object "foo/bar.txt" is included as "bar.txt" but "foobar.txt" is not. An object
+// whose name equals the prefix is returned by its base name so a single object can be downloaded.
+func relativeObjectName(prefix, name string) (string, bool) {
+	if prefix == "" {
+		return name, true
+	}
+	if name == prefix {
+		return path.Base(name), true
+	}
+
+	folder := prefix
+	if !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+	if !strings.HasPrefix(name, folder) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(name, folder), true
+}
+
+// ProcessPrefix will list the objects in the bucket under the prefix and convert them into a
+// list of DownloadInput. Each DownloadInput represents a single object that will need to be
+// downloaded from GCS into the local path.
+// The pattern parameter is a glob that can be used to do selective filtering on the object names
+// relative to the prefix.
+func ProcessPrefix(ctx context.Context, bucket stiface.BucketHandle, prefix, pattern, localPath string) ([]DownloadInput, error) {
+	fmt.Printf("Prefix provided: %v with glob %v\n", prefix, pattern)
+
+	var matcher *regexp.Regexp
+	if pattern != "" {
+		var err error
+		matcher, err = glob.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var inputs []DownloadInput
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects with prefix %v: %w", prefix, err)
+		}
+
+		// skip folder placeholder objects
+		if strings.HasSuffix(attrs.Name, "/") {
+			continue
+		}
+
+		rel, ok := relativeObjectName(prefix, attrs.Name)
+		if !ok {
+			continue
+		}
+		if matcher != nil && !matcher.MatchString(rel) {
+			continue
+		}
+
+		filePath := filepath.Join(localPath, filepath.FromSlash(rel))
+		if !isWithinDir(localPath, filePath) {
+			return nil, fmt.Errorf("object %v would be written outside of %v", attrs.Name, localPath)
+		}
+
+		inputs = append(inputs, DownloadInput{ObjectName: attrs.Name, FilePath: filePath})
+	}
+
+	return inputs, nil
+}
+
+// isWithinDir reports whether the target path resolves to a location inside of dir.
+func isWithinDir(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+)
+
+// setupTestBucket will create a fake bucket with the following objects:
+//
+//	builds/a/foo.txt
+//	builds/b/bar.txt
+//	builds/file1.txt
+//	builds/file2.go
+//	buildsfoo.txt
+//	other/file3.txt
+func setupTestBucket(t *testing.T) *fakestorage.Server {
+	t.Helper()
+	var objects []fakestorage.Object
+	for _, name := range []string{"builds/a/foo.txt", "builds/b/bar.txt", "builds/file1.txt", "builds/file2.go",
+		"buildsfoo.txt", "other/file3.txt"} {
+		objects = append(objects, fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: name},
+			Content:     []byte(name),
+		})
+	}
+	server := fakestorage.NewServer(objects)
+	t.Cleanup(server.Stop)
+	return server
+}
+
+func TestProcessPrefix_Success(t *testing.T) {
+	tests := []struct {
+		name           string
+		prefix         string
+		glob           string
+		expectedResult []DownloadInput
+	}{
+		{
+			name:   "FolderPrefix",
+			prefix: "builds",
+			expectedResult: []DownloadInput{
+				{ObjectName: "builds/a/foo.txt", FilePath: filepath.Join("out", "a", "foo.txt")},
+				{ObjectName: "builds/b/bar.txt", FilePath: filepath.Join("out", "b", "bar.txt")},
+				{ObjectName: "builds/file1.txt", FilePath: filepath.Join("out", "file1.txt")},
+				{ObjectName: "builds/file2.go", FilePath: filepath.Join("out", "file2.go")},
+			},
+		},
+		{
+			name:   "SingleObject",
+			prefix: "other/file3.txt",
+			expectedResult: []DownloadInput{
+				{ObjectName: "other/file3.txt", FilePath: filepath.Join("out", "file3.txt")},
+			},
+		},
+		{
+			name:   "TopLevelGlob",
+			prefix: "builds/",
+			glob:   "*.txt",
+			expectedResult: []DownloadInput{
+				{ObjectName: "builds/file1.txt", FilePath: filepath.Join("out", "file1.txt")},
+			},
+		},
+		{
+			name:   "RecursiveGlob",
+			prefix: "builds",
+			glob:   "**/*.txt",
+			expectedResult: []DownloadInput{
+				{ObjectName: "builds/a/foo.txt", FilePath: filepath.Join("out", "a", "foo.txt")},
+				{ObjectName: "builds/b/bar.txt", FilePath: filepath.Join("out", "b", "bar.txt")},
+				{ObjectName: "builds/file1.txt", FilePath: filepath.Join("out", "file1.txt")},
+			},
+		},
+		{
+			name:   "CharacterClassGlob",
+			prefix: "builds",
+			glob:   "[ab]/*",
+			expectedResult: []DownloadInput{
+				{ObjectName: "builds/a/foo.txt", FilePath: filepath.Join("out", "a", "foo.txt")},
+				{ObjectName: "builds/b/bar.txt", FilePath: filepath.Join("out", "b", "bar.txt")},
+			},
+		},
+	}
+
+	server := setupTestBucket(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := createBucketHandleFromServer(server)
+			got, err := ProcessPrefix(context.Background(), b, test.prefix, test.glob, "out")
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if diff := cmp.Diff(test.expectedResult, got); diff != "" {
+				t.Errorf("ProcessPrefix(ctx, b, %q, %q, 'out') diff (-want +got):\n%s", test.prefix, test.glob, diff)
+			}
+		})
+	}
+}
+
+func TestProcessPrefix_InvalidGlob_Fail(t *testing.T) {
+	b := createBucketHandleFromServer(setupTestBucket(t))
+	if _, err := ProcessPrefix(context.Background(), b, "", "[abc", "out"); err == nil {
+		t.Errorf("ProcessPrefix() expected error for unterminated character class")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glob
+
+import "testing"
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		glob  string
+		name  string
+		match bool
+	}{
+		{glob: "*.txt", name: "file1.txt", match: true},
+		{glob: "*.txt", name: "a/foo.txt", match: false},
+		{glob: "**/*.txt", name: "file1.txt", match: true},
+		{glob: "**/*.txt", name: "a/b/foo.txt", match: true},
+		{glob: "assets/**", name: "assets/js/app.js", match: true},
+		{glob: "file?.go", name: "file3.go", match: true},
+		{glob: "[ab]/*", name: "c/foo.txt", match: false},
+		{glob: "[!ab]/*", name: "c/foo.txt", match: true},
+		{glob: "a+b.txt", name: "a+b.txt", match: true},
+	}
+	for _, test := range tests {
+		t.Run(test.glob+" "+test.name, func(t *testing.T) {
+			re, err := Compile(test.glob)
+			if err != nil {
+				t.Fatalf("Compile(%q) = %v", test.glob, err)
+			}
+			if got := re.MatchString(test.name); got != test.match {
+				t.Errorf("Compile(%q).MatchString(%q) = %v, want %v", test.glob, test.name, got, test.match)
+			}
+		})
+	}
+}
+
+func TestCompile_UnterminatedClass_Fail(t *testing.T) {
+	if _, err := Compile("[abc"); err == nil {
+		t.Errorf("Compile() expected error for unterminated character class")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prune selects the stale objects under a prefix, by glob, age and number of newer
+// objects to keep, and deletes them concurrently.
+package prune
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/glob"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/iterator"
+)
+
+type Pruner struct {
+	Concurrency int
+	// Retry bounds each delete attempt, and sets how many times it is retried after a retryable
+	// error.
+	transfer.Retry
+	// OlderThan only selects the objects created longer than this ago, when set.
+	OlderThan time.Duration
+	// KeepLast keeps the newest KeepLast candidates, whatever their age, when set.
+	KeepLast int
+	// ByFolder makes each folder directly under the prefix a single candidate, whose age is the
+	// age of its newest object, so that whole builds are kept or deleted together.
+	ByFolder bool
+	// Now is the time the ages are measured from, defaults to the current time.
+	Now time.Time
+}
+
+// candidate is an object, or a folder of objects when ByFolder is set, that may be deleted.
+type candidate struct {
+	name    string
+	created time.Time
+	inputs  []transfer.DeleteInput
+}
+
+// Plan lists the objects under the prefix and returns the ones to delete. The prefix is treated
+// as a folder, and the optional glob pattern is matched against the object names relative to it.
+// The matching objects, or folders, are ordered from newest to oldest: the first KeepLast are
+// kept, and the others are deleted if they are older than OlderThan.
+func (p Pruner) Plan(ctx context.Context, bucket stiface.BucketHandle, prefix, pattern string) ([]transfer.DeleteInput, error) {
+	var matcher *regexp.Regexp
+	if pattern != "" {
+		var err error
+		matcher, err = glob.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	candidates := map[string]*candidate{}
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects with prefix %v: %w", prefix, err)
+		}
+
+		rel := strings.TrimPrefix(attrs.Name, prefix)
+		if matcher != nil && !matcher.MatchString(rel) {
+			continue
+		}
+
+		key := rel
+		if p.ByFolder {
+			key, _, _ = strings.Cut(rel, "/")
+		}
+		c := candidates[key]
+		if c == nil {
+			c = &candidate{name: key}
+			candidates[key] = c
+		}
+		c.inputs = append(c.inputs, transfer.DeleteInput{ObjectName: attrs.Name, Generation: attrs.Generation})
+		if attrs.Created.After(c.created) {
+			c.created = attrs.Created
+		}
+	}
+
+	ordered := make([]*candidate, 0, len(candidates))
+	for _, c := range candidates {
+		ordered = append(ordered, c)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].created.Equal(ordered[j].created) {
+			return ordered[i].created.After(ordered[j].created)
+		}
+		return ordered[i].name > ordered[j].name
+	})
+
+	now := p.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var inputs []transfer.DeleteInput
+	for i, c := range ordered {
+		if i < p.KeepLast {
+			continue
+		}
+		if p.OlderThan > 0 && c.created.After(now.Add(-p.OlderThan)) {
+			continue
+		}
+		inputs = append(inputs, c.inputs...)
+	}
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].ObjectName < inputs[j].ObjectName })
+	return inputs, nil
+}
+
+// DeleteObjects will delete each DeleteInput from the provided bucket. It will perform the
+// deletes concurrently up to the Pruner.Concurrency limit. Results are accumulated into a
+// transfer.Results array and returned when everything completes. It's possible that individual
+// deletes can have an error, and the caller can check transfer.Results.Success and
+// transfer.Results.Message for status and any error message. Deletes are retried with
+// Pruner.Retry, and an object overwritten since it was listed is not deleted.
+func (p Pruner) DeleteObjects(inputs []transfer.DeleteInput, bucket stiface.BucketHandle) []transfer.Results {
+	return transfer.DeleteObjects(inputs, bucket, p.Concurrency, p.Retry)
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prune
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/googleapi"
+)
+
+const testBucket = "bucketName"
+
+var now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// setup creates a server with objects created the given number of days before now.
+func setup(t *testing.T, ages map[string]int) (*fakestorage.Server, stiface.BucketHandle) {
+	t.Helper()
+
+	var objects []fakestorage.Object
+	for name, days := range ages {
+		objects = append(objects, fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: testBucket,
+				Name:       name,
+				Created:    now.AddDate(0, 0, -days),
+			},
+			Content: []byte(name),
+		})
+	}
+	server := fakestorage.NewServer(objects)
+	t.Cleanup(server.Stop)
+	return server, stiface.AdaptClient(server.Client()).Bucket(testBucket)
+}
+
+func TestPlan(t *testing.T) {
+	ages := map[string]int{
+		"builds/1/app.tar":  30,
+		"builds/1/app.log":  30,
+		"builds/2/app.tar":  10,
+		"builds/2/app.log":  10,
+		"builds/3/app.tar":  1,
+		"builds/3/app.log":  1,
+		"builds/latest.txt": 0,
+		"buildsother/x.tar": 30,
+		"releases/1.tar":    30,
+	}
+	tests := []struct {
+		name    string
+		pruner  Pruner
+		prefix  string
+		pattern string
+		want    []string
+	}{
+		{
+			name:   "Prefix",
+			prefix: "builds",
+			want: []string{"builds/1/app.log", "builds/1/app.tar", "builds/2/app.log", "builds/2/app.tar",
+				"builds/3/app.log", "builds/3/app.tar", "builds/latest.txt"},
+		},
+		{
+			name:    "Glob",
+			prefix:  "builds",
+			pattern: "**/*.log",
+			want:    []string{"builds/1/app.log", "builds/2/app.log", "builds/3/app.log"},
+		},
+		{
+			name:   "OlderThan",
+			pruner: Pruner{OlderThan: 7 * 24 * time.Hour},
+			prefix: "builds",
+			want:   []string{"builds/1/app.log", "builds/1/app.tar", "builds/2/app.log", "builds/2/app.tar"},
+		},
+		{
+			name:    "KeepLast",
+			pruner:  Pruner{KeepLast: 2},
+			prefix:  "builds",
+			pattern: "*/app.tar",
+			want:    []string{"builds/1/app.tar"},
+		},
+		{
+			name:   "KeepLastByFolder",
+			pruner: Pruner{KeepLast: 2, ByFolder: true},
+			prefix: "builds/",
+			want:   []string{"builds/1/app.log", "builds/1/app.tar", "builds/2/app.log", "builds/2/app.tar"},
+		},
+		{
+			name:   "KeepLastAndOlderThan",
+			pruner: Pruner{KeepLast: 1, OlderThan: 20 * 24 * time.Hour, ByFolder: true},
+			prefix: "builds",
+			want:   []string{"builds/1/app.log", "builds/1/app.tar"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, bucket := setup(t, ages)
+			test.pruner.Now = now
+
+			inputs, err := test.pruner.Plan(context.Background(), bucket, test.prefix, test.pattern)
+			if err != nil {
+				t.Fatalf("Plan() = %v", err)
+			}
+			var got []string
+			for _, input := range inputs {
+				got = append(got, input.ObjectName)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Plan() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeleteObjects(t *testing.T) {
+	server, bucket := setup(t, map[string]int{"a.txt": 1, "b.txt": 1, "c.txt": 1})
+	p := Pruner{Concurrency: 2, Now: now}
+	inputs, err := p.Plan(context.Background(), bucket, "", "[ab].txt")
+	if err != nil {
+		t.Fatalf("Plan() = %v", err)
+	}
+
+	want := []transfer.Results{
+		{ObjectName: "a.txt", Success: true},
+		{ObjectName: "b.txt", Success: true},
+	}
+	got := p.DeleteObjects(inputs, bucket)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DeleteObjects() diff (-want +got):\n%s", diff)
+	}
+
+	objects, _, err := server.ListObjectsWithOptions(testBucket, fakestorage.ListOptions{})
+	if err != nil {
+		t.Fatalf("server.ListObjectsWithOptions() = %v", err)
+	}
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	if diff := cmp.Diff([]string{"c.txt"}, names); diff != "" {
+		t.Errorf("remaining objects diff (-want +got):\n%s", diff)
+	}
+}
+
+type bucketMock struct {
+	stiface.BucketHandle
+	oMock *objectMock
+}
+
+type objectMock struct {
+	stiface.ObjectHandle
+	err error
+}
+
+func (m bucketMock) Object(_ string) stiface.ObjectHandle {
+	return m.oMock
+}
+
+func (m *objectMock) If(_ storage.Conditions) stiface.ObjectHandle {
+	return m
+}
+
+func (m *objectMock) Delete(_ context.Context) error {
+	return m.err
+}
+
+func TestDeleteObjects_Fail(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		expectedMsg string
+	}{
+		{
+			name:        "Overwritten",
+			err:         &googleapi.Error{Code: http.StatusPreconditionFailed},
+			expectedMsg: "object was overwritten after it was listed, not deleted",
+		},
+		{
+			name:        "Error",
+			err:         errors.New("permission denied"),
+			expectedMsg: "ObjectHandle.Delete: permission denied",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := bucketMock{oMock: &objectMock{err: test.err}}
+			inputs := []transfer.DeleteInput{{ObjectName: "a.txt", Generation: 1}}
+
+			want := []transfer.Results{{ObjectName: "a.txt", Message: test.expectedMsg}}
+			got := Pruner{Concurrency: 1}.DeleteObjects(inputs, b)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("DeleteObjects() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import "sync"
+
+// ForEachConcurrently calls fn for every index in [0, n), running up to concurrency calls at
+// once, and returns when all the calls complete.
+func ForEachConcurrently(n, concurrency int, fn func(i int)) {
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, max(concurrency, 1))
+
+	for i := 0; i < n; i++ {
+		semaphore <- struct{}{}
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	var running, peak int
+	called := make([]bool, 10)
+
+	ForEachConcurrently(len(called), 3, func(i int) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		called[i] = true
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	for i, ok := range called {
+		if !ok {
+			t.Errorf("ForEachConcurrently() did not call fn(%d)", i)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("ForEachConcurrently() peak concurrency = %d, want at most 3", peak)
+	}
+}
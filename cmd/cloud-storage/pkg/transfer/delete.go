@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/googleapi"
+)
+
+// DeleteInput is an object to delete.
+type DeleteInput struct {
+	ObjectName string
+	// Generation is the generation the object had when it was listed. The object is only deleted
+	// if it was not overwritten since, unless the generation is 0.
+	Generation int64
+}
+
+// DeleteObjects deletes the objects from the bucket concurrently up to the concurrency limit, and
+// returns a result for each object. Each delete is retried with retry.
+func DeleteObjects(inputs []DeleteInput, bucket stiface.BucketHandle, concurrency int, retry Retry) []Results {
+	results := make([]Results, len(inputs))
+	ForEachConcurrently(len(inputs), concurrency, func(i int) {
+		results[i] = deleteObject(inputs[i], bucket, retry)
+	})
+	return results
+}
+
+// deleteObject deletes the object if it still has the listed generation. A retry that finds the
+// object deleted succeeds, since the response of the previous attempt may have been lost after
+// the object was deleted.
+func deleteObject(input DeleteInput, bucket stiface.BucketHandle, retry Retry) Results {
+	result := Results{ObjectName: input.ObjectName}
+	o := bucket.Object(input.ObjectName)
+	if input.Generation != 0 {
+		o = o.If(storage.Conditions{GenerationMatch: input.Generation})
+	}
+
+	attempt := 0
+	err := retry.WithRetries(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), retry.AttemptTimeout())
+		defer cancel()
+		err := o.Delete(ctx)
+		if attempt > 0 && errors.Is(err, storage.ErrObjectNotExist) {
+			err = nil
+		}
+		attempt++
+		return err
+	})
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			result.Message = "object was overwritten after it was listed, not deleted"
+			return result
+		}
+		result.Message = fmt.Sprintf("ObjectHandle.Delete: %v", err)
+		return result
+	}
+	result.Success = true
+	return result
+}
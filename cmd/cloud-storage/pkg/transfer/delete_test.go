@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/googleapi"
+)
+
+// deleteBucketMock serves objects that return the errors in order from their Delete calls, and
+// records the generation conditions of the deletes.
+type deleteBucketMock struct {
+	stiface.BucketHandle
+	errs       map[string][]error
+	conditions map[string]storage.Conditions
+}
+
+type deleteObjectMock struct {
+	stiface.ObjectHandle
+	name   string
+	bucket *deleteBucketMock
+}
+
+func (b *deleteBucketMock) Object(name string) stiface.ObjectHandle {
+	return deleteObjectMock{name: name, bucket: b}
+}
+
+func (o deleteObjectMock) If(conds storage.Conditions) stiface.ObjectHandle {
+	o.bucket.conditions[o.name] = conds
+	return o
+}
+
+func (o deleteObjectMock) Delete(context.Context) error {
+	errs := o.bucket.errs[o.name]
+	if len(errs) == 0 {
+		return nil
+	}
+	o.bucket.errs[o.name] = errs[1:]
+	return errs[0]
+}
+
+func TestDeleteObjects(t *testing.T) {
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	bucket := &deleteBucketMock{
+		errs: map[string][]error{
+			"deleted.txt":     {unavailable, storage.ErrObjectNotExist},
+			"missing.txt":     {storage.ErrObjectNotExist},
+			"overwritten.txt": {&googleapi.Error{Code: http.StatusPreconditionFailed}},
+		},
+		conditions: map[string]storage.Conditions{},
+	}
+	inputs := []DeleteInput{
+		{ObjectName: "a.txt", Generation: 1},
+		{ObjectName: "deleted.txt", Generation: 2},
+		{ObjectName: "missing.txt"},
+		{ObjectName: "overwritten.txt", Generation: 3},
+	}
+
+	want := []Results{
+		{ObjectName: "a.txt", Success: true},
+		{ObjectName: "deleted.txt", Success: true},
+		{ObjectName: "missing.txt", Message: "ObjectHandle.Delete: storage: object doesn't exist"},
+		{ObjectName: "overwritten.txt", Message: "object was overwritten after it was listed, not deleted"},
+	}
+	got := DeleteObjects(inputs, bucket, 1, Retry{Retries: 2, RetryBackoff: time.Millisecond})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DeleteObjects() diff (-want +got):\n%s", diff)
+	}
+
+	wantConditions := map[string]storage.Conditions{
+		"a.txt":           {GenerationMatch: 1},
+		"deleted.txt":     {GenerationMatch: 2},
+		"overwritten.txt": {GenerationMatch: 3},
+	}
+	if diff := cmp.Diff(wantConditions, bucket.conditions); diff != "" {
+		t.Errorf("delete conditions diff (-want +got):\n%s", diff)
+	}
+}
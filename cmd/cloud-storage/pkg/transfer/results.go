@@ -0,0 +1,35 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+// Results is the result of the upload, download, copy or delete of a single object. The caller
+// can check Success and Message for the status and any error message.
+type Results struct {
+	FilePath   string `json:"file_path,omitempty"`
+	ObjectName string `json:"object_name"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message,omitempty"`
+	// Status is upload.StatusAlreadyExists or upload.StatusIdentical when the file was not uploaded
+	// because of the upload preconditions, and empty otherwise.
+	Status string `json:"status,omitempty"`
+	// Generation and CRC32C (base64 encoded, as in the GCS JSON API) describe the object the file
+	// was uploaded to. Digest is the sha256 of the local file when upload.Uploader.RecordDigests is
+	// set.
+	Generation int64  `json:"generation,omitempty"`
+	CRC32C     string `json:"crc32c,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	// SignedURL is an expiring link to the object when upload.Uploader.Signer is set.
+	SignedURL string `json:"signed_url,omitempty"`
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transfer holds what the uploads, downloads and deletes of objects have in common: their
+// results, the timeout and retries of each attempt, and running them concurrently.
+package transfer
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Timeout is the default timeout, in seconds, of a single attempt at transferring an object.
+const Timeout = 50
+
+const (
+	RetryBackoffDefault = time.Second
+	MaxRetryBackoff     = 32 * time.Second
+)
+
+// Retry bounds each attempt at transferring an object, and retries the attempts that fail with a
+// retryable error.
+type Retry struct {
+	// Retries is the number of times an attempt is retried after a retryable error.
+	Retries int
+	// RetryBackoff is the wait before the first retry, defaults to RetryBackoffDefault.
+	RetryBackoff time.Duration
+	// Timeout bounds each attempt, defaults to Timeout seconds.
+	Timeout time.Duration
+}
+
+// WithRetries calls fn until it succeeds, it fails with an error that is not retryable,
+// or it has been retried Retries times. The error of the last call is returned.
+func (r Retry) WithRetries(fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= r.Retries || !IsRetryable(err) {
+			return err
+		}
+		time.Sleep(r.Backoff(attempt))
+	}
+}
+
+// AttemptTimeout returns the configured timeout for a single attempt, or the default of Timeout
+// seconds if none is set.
+func (r Retry) AttemptTimeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return time.Second * Timeout
+}
+
+// Backoff returns how long to wait before the retry following the given attempt. The wait
+// doubles with every attempt up to MaxRetryBackoff, and is jittered to spread out retries
+// from concurrent transfers.
+func (r Retry) Backoff(attempt int) time.Duration {
+	d := r.RetryBackoff
+	if d <= 0 {
+		d = RetryBackoffDefault
+	}
+	for i := 0; i < attempt && d < MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxRetryBackoff {
+		d = MaxRetryBackoff
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)) //nolint:gosec // jitter does not need a secure source
+}
+
+// IsRetryable reports whether a failed attempt may succeed if tried again. Attempts that
+// hit the per-attempt timeout are retried along with the errors the storage client retries.
+func IsRetryable(err error) bool {
+	return storage.ShouldRetry(err) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	r := Retry{RetryBackoff: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 0, max: time.Second},
+		{attempt: 2, max: 4 * time.Second},
+		{attempt: 10, max: MaxRetryBackoff},
+	}
+	for _, test := range tests {
+		got := r.Backoff(test.attempt)
+		if got < test.max/2 || got > test.max {
+			t.Errorf("Backoff(%d) = %v, want between %v and %v", test.attempt, got, test.max/2, test.max)
+		}
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		retries          int
+		err              error
+		expectedAttempts int
+	}{
+		{name: "Success", retries: 3, expectedAttempts: 1},
+		{name: "RetryableErrorRetried", retries: 2, err: context.DeadlineExceeded, expectedAttempts: 3},
+		{name: "PermanentErrorNotRetried", retries: 3, err: errors.New("permanent"), expectedAttempts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := Retry{Retries: test.retries, RetryBackoff: time.Millisecond}
+			attempts := 0
+			err := r.WithRetries(func() error {
+				attempts++
+				return test.err
+			})
+			if !errors.Is(err, test.err) {
+				t.Errorf("WithRetries() = %v, want %v", err, test.err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("WithRetries() attempts = %d, want %d", attempts, test.expectedAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/GoogleCloudBuild/cicd-images/internal/archive"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+// UploadArchive streams the files that WalkPath would find under path into a single archive
+// object of the format, without a temporary file. The entries are relative to the path folder, or
+// the base name of the file when path is a file. The result holds the sha256 digest of the
+// archive. Since the archive is written in a single attempt, Uploader.Timeout bounds the whole
+// archive, and a retry archives the files again.
+func (u Uploader) UploadArchive(path, glob string, useIgnoreList bool, format archive.Format, objectName string,
+	bucket stiface.BucketHandle) transfer.Results {
+	result := transfer.Results{FilePath: path, ObjectName: objectName}
+
+	var attrs *storage.ObjectAttrs
+	var digest string
+	err := u.WithRetries(func() error {
+		var err error
+		attrs, digest, err = u.archiveAttempt(path, glob, useIgnoreList, format, objectName, bucket)
+		return err
+	})
+
+	if isPreconditionFailed(err) {
+		result.Status = StatusAlreadyExists
+		result.Message = alreadyExistsMessage
+		return result
+	}
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Success = true
+	result.Digest = digest
+	return u.recordObject(result, attrs)
+}
+
+// archiveAttempt makes a single attempt at writing the archive into the object, and returns the
+// attributes of the object and the digest of the archive.
+func (u Uploader) archiveAttempt(path, glob string, useIgnoreList bool, format archive.Format, objectName string,
+	bucket stiface.BucketHandle) (*storage.ObjectAttrs, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
+	defer cancel()
+
+	wc := u.destination(bucket, objectName).NewWriter(ctx)
+	if u.ChunkSize > 0 {
+		wc.SetChunkSize(u.ChunkSize)
+	}
+	wc.ObjectAttrs().ContentType = format.ContentType()
+	applyHeaders(wc.ObjectAttrs(), u.Headers)
+	applyPredefinedACL(wc.ObjectAttrs(), u.ACL)
+	applyStorageClass(wc.ObjectAttrs(), u.StorageClass)
+	u.applyProtection(wc.ObjectAttrs())
+
+	h := sha256.New()
+	aw, err := archive.NewWriter(io.MultiWriter(wc, h), format)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := addArchiveFiles(aw, path, glob, useIgnoreList); err != nil {
+		// cancelling the context before closing the writer aborts the upload
+		cancel()
+		wc.Close()
+		return nil, "", err
+	}
+	if err := aw.Close(); err != nil {
+		cancel()
+		wc.Close()
+		return nil, "", fmt.Errorf("error closing archive: %w", err)
+	}
+
+	if err := wc.Close(); err != nil {
+		return nil, "", fmt.Errorf("Writer.Close: %w", err)
+	}
+	return wc.Attrs(), encodeDigest(h), nil
+}
+
+// addArchiveFiles adds the files under path to the archive, with the same filtering as WalkPath.
+func addArchiveFiles(aw *archive.Writer, path, glob string, useIgnoreList bool) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error processing provided path: %v, %w", path, err)
+	}
+	if !fileInfo.IsDir() {
+		if glob != "" {
+			return fmt.Errorf("can only provide glob when path is a folder")
+		}
+		return aw.AddFile(path, filepath.Base(path))
+	}
+
+	return walkFiles(path, glob, useIgnoreList, func(file string) error {
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		if err := aw.AddFile(file, filepath.ToSlash(rel)); err != nil {
+			return fmt.Errorf("error archiving %v: %w", file, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/GoogleCloudBuild/cicd-images/internal/archive"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+func TestUploadArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		".gcloudignore": "*.log\n",
+		"a.txt":         "a data",
+		"debug.log":     "ignored",
+		"sub/b.txt":     "b data",
+	}
+	for name, data := range files {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("os.MkdirAll() = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+	}
+
+	server := fakestorage.NewServer([]fakestorage.Object{})
+	t.Cleanup(server.Stop)
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: testBucket})
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+	got := Uploader{Concurrency: 1}.UploadArchive(tempDir, "", true, archive.TarGzip, "source.tar.gz", bucket)
+
+	obj, err := server.GetObject(testBucket, "source.tar.gz")
+	if err != nil {
+		t.Fatalf("server.GetObject() = %v", err)
+	}
+	sum := sha256.Sum256(obj.Content)
+	want := transfer.Results{
+		FilePath:   tempDir,
+		ObjectName: "source.tar.gz",
+		Success:    true,
+		Digest:     "sha256:" + hex.EncodeToString(sum[:]),
+	}
+	if diff := cmp.Diff(want, got, ignoreObjectFields); diff != "" {
+		t.Errorf("UploadArchive() diff (-want +got):\n%s", diff)
+	}
+	if obj.ContentType != "application/gzip" {
+		t.Errorf("ContentType = %q, want %q", obj.ContentType, "application/gzip")
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(obj.Content))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() = %v", err)
+	}
+	entries := map[string]string{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar.Reader.Next() = %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("io.ReadAll() = %v", err)
+		}
+		entries[header.Name] = string(data)
+	}
+	wantEntries := map[string]string{
+		".gcloudignore": "*.log\n",
+		"a.txt":         "a data",
+		"sub/b.txt":     "b data",
+	}
+	if diff := cmp.Diff(wantEntries, entries); diff != "" {
+		t.Errorf("archive entries diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploadArchive_Fail(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{})
+	t.Cleanup(server.Stop)
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: testBucket})
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	got := Uploader{Concurrency: 1}.UploadArchive(missing, "", false, archive.Zip, "source.zip", bucket)
+	if got.Success || got.Message == "" {
+		t.Errorf("UploadArchive() of a missing path = %+v, want a failed result", got)
+	}
+	if _, err := server.GetObject(testBucket, "source.zip"); err == nil {
+		t.Errorf("server.GetObject() = nil, want no object for a failed archive")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/google/uuid"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+const (
+	// MaxComposeComponents is the maximum number of objects GCS can compose in a single request.
+	MaxComposeComponents = 32
+
+	// CompositeTmpPrefix is the prefix of the temporary part objects of parallel composite uploads.
+	CompositeTmpPrefix = "cloud-storage-tmp/parallel-composite-uploads/"
+)
+
+// useComposite reports whether a file of the given size is uploaded as a parallel composite upload.
+// Gzipped files are never split, since the parts would each become a separate gzip stream. Nor are
+// encrypted files, since the storage client cannot compose with a KMS or customer-supplied key.
+func (u Uploader) useComposite(filePath string, size int64) bool {
+	if u.KMSKeyName != "" || u.EncryptionKey != nil {
+		return false
+	}
+	return u.CompositeThreshold > 0 && !u.shouldGzip(filePath) && size >= u.CompositeThreshold
+}
+
+// compositeParts returns the number of parts a file of the given size is split into.
+func (u Uploader) compositeParts(size int64) int {
+	parts := u.CompositeParts
+	if parts <= 0 || parts > MaxComposeComponents {
+		parts = MaxComposeComponents
+	}
+	if int64(parts) > size {
+		parts = int(size)
+	}
+	return max(parts, 1)
+}
+
+// uploadComposite splits the file from the UploadInput into parts, uploads the parts as temporary
+// objects concurrently, and composes them into the object. The parts share the limit of
+// Uploader.Concurrency open writers with the other files being uploaded. Each part is retried on
+// its own, so a failure only restarts a single part. The temporary part objects are always
+// deleted.
+//
+// The sha256 of a file cannot be combined from the digests of its parts, so when RecordDigests is
+// set the digest is computed in a single pass over the file while the parts upload, along with its
+// CRC32C. The upload fails if the CRC32C does not match the composed object, so that the digest is
+// always that of the uploaded content.
+func (u Uploader) uploadComposite(input UploadInput, bucket stiface.BucketHandle,
+	info os.FileInfo) (*storage.ObjectAttrs, string, error) {
+	size := info.Size()
+	parts := u.compositeParts(size)
+	partSize := (size + int64(parts) - 1) / int64(parts)
+	tmpPrefix := fmt.Sprintf("%s%s/", CompositeTmpPrefix, uuid.NewString())
+
+	names := make([]string, parts)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%d", tmpPrefix, i)
+	}
+	defer u.deleteParts(names, bucket)
+
+	var digest string
+	var crc32c uint32
+	var digestErr error
+	digestDone := make(chan struct{})
+	go func() {
+		defer close(digestDone)
+		if u.RecordDigests {
+			digest, crc32c, digestErr = fileDigestAndCRC32C(input.FilePath)
+		}
+	}()
+
+	errs := make([]error, parts)
+	transfer.ForEachConcurrently(parts, u.Concurrency, func(i int) {
+		offset := int64(i) * partSize
+		length := min(partSize, size-offset)
+		errs[i] = u.WithRetries(func() error {
+			return u.uploadPart(input.FilePath, names[i], offset, length, bucket)
+		})
+	})
+	<-digestDone
+	if err := errors.Join(errs...); err != nil {
+		return nil, "", fmt.Errorf("parallel composite upload: %w", err)
+	}
+	if digestErr != nil {
+		return nil, "", digestErr
+	}
+
+	var attrs *storage.ObjectAttrs
+	err := u.WithRetries(func() error {
+		var err error
+		attrs, err = u.composeParts(input.FilePath, input.ObjectName, names, info, bucket)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if u.RecordDigests && attrs.CRC32C != crc32c {
+		return nil, "", fmt.Errorf("parallel composite upload: %v changed during the upload", input.FilePath)
+	}
+	return attrs, digest, nil
+}
+
+// fileDigestAndCRC32C returns the sha256 digest and the CRC32C of the file.
+func fileDigestAndCRC32C(filePath string) (string, uint32, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(io.MultiWriter(digest, crcHash), f); err != nil {
+		return "", 0, fmt.Errorf("io.Copy: %w", err)
+	}
+	return encodeDigest(digest), crcHash.Sum32(), nil
+}
+
+// uploadPart uploads length bytes of the file starting at offset into the named temporary object.
+func (u Uploader) uploadPart(filePath, name string, offset, length int64, bucket stiface.BucketHandle) (err error) {
+	defer u.acquireWriter()()
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	counter := u.Progress.counter()
+	defer func() { counter.rollback(err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
+	defer cancel()
+
+	wc := bucket.Object(name).NewWriter(ctx)
+	if u.ChunkSize > 0 {
+		wc.SetChunkSize(u.ChunkSize)
+	}
+	if _, err := io.Copy(wc, io.TeeReader(io.NewSectionReader(f, offset, length), counter)); err != nil {
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("Writer.Close: %w", err)
+	}
+	return nil
+}
+
+// composeParts composes the named temporary objects, in order, into the object. The headers, acl,
+// storage class, holds, retention, content type and modification time are applied to the composed
+// object.
+func (u Uploader) composeParts(filePath, objectName string, names []string, info os.FileInfo,
+	bucket stiface.BucketHandle) (*storage.ObjectAttrs, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
+	defer cancel()
+
+	srcs := make([]stiface.ObjectHandle, len(names))
+	for i, name := range names {
+		srcs[i] = bucket.Object(name)
+	}
+
+	c := u.destination(bucket, objectName).ComposerFrom(srcs...)
+	applyHeaders(c.ObjectAttrs(), u.Headers)
+	applyPredefinedACL(c.ObjectAttrs(), u.ACL)
+	applyStorageClass(c.ObjectAttrs(), u.StorageClass)
+	u.applyProtection(c.ObjectAttrs())
+	if err := u.applyContentType(c.ObjectAttrs(), filePath); err != nil {
+		return nil, err
+	}
+	if u.PreserveMtime {
+		applyMtime(c.ObjectAttrs(), info)
+	}
+
+	attrs, err := c.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Composer.Run: %w", err)
+	}
+	return attrs, nil
+}
+
+// deleteParts deletes the temporary part objects. Parts that were never uploaded are ignored.
+func (u Uploader) deleteParts(names []string, bucket stiface.BucketHandle) {
+	transfer.ForEachConcurrently(len(names), u.Concurrency, func(i int) {
+		ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
+		defer cancel()
+
+		err := bucket.Object(names[i]).Delete(ctx)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			fmt.Printf("Failed to delete temporary object %v: %v\n", names[i], err)
+		}
+	})
+}
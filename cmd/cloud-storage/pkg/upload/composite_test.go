@@ -0,0 +1,189 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/iterator"
+)
+
+func TestUploadObjects_Composite_Success(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "placeholder"}},
+	})
+	defer server.Stop()
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	path := filepath.Join(t.TempDir(), "large.bin")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	ui := []UploadInput{{FilePath: path, ObjectName: "large.bin"}}
+
+	u := Uploader{
+		Concurrency:        4,
+		Headers:            map[string]string{"content-type": "application/octet-stream"},
+		CompositeThreshold: 1024,
+		CompositeParts:     7,
+	}
+	want := []transfer.Results{{FilePath: path, ObjectName: "large.bin", Success: true}}
+	got := u.UploadObjects(ui, bucket)
+	if diff := cmp.Diff(want, got, ignoreObjectFields); diff != "" {
+		t.Fatalf("UploadObjects(ui, bucket) diff (-want +got):\n%s", diff)
+	}
+
+	ctx := context.Background()
+	r, err := bucket.Object("large.bin").NewReader(ctx)
+	if err != nil {
+		t.Fatalf("NewReader() = %v", err)
+	}
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll() = %v", err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Errorf("composed object content does not match the uploaded file")
+	}
+	if r.ContentType() != "application/octet-stream" {
+		t.Errorf("composed object content type = %v, want application/octet-stream", r.ContentType())
+	}
+
+	// the temporary parts are cleaned up
+	it := bucket.Objects(ctx, &storage.Query{Prefix: CompositeTmpPrefix})
+	if attrs, err := it.Next(); !errors.Is(err, iterator.Done) {
+		t.Errorf("expected no temporary objects to remain, found %v", attrs.Name)
+	}
+}
+
+func TestCompositeParts(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    int
+		size     int64
+		expected int
+	}{
+		{name: "Default", size: 1 << 30, expected: MaxComposeComponents},
+		{name: "Configured", parts: 8, size: 1 << 30, expected: 8},
+		{name: "CappedToComposeLimit", parts: 100, size: 1 << 30, expected: MaxComposeComponents},
+		{name: "CappedToSize", parts: 8, size: 3, expected: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := Uploader{CompositeParts: test.parts}
+			if got := u.compositeParts(test.size); got != test.expected {
+				t.Errorf("compositeParts(%d) = %d, want %d", test.size, got, test.expected)
+			}
+		})
+	}
+}
+
+// writerCountingBucket records the peak number of object writers open at once.
+type writerCountingBucket struct {
+	stiface.BucketHandle
+	mu   *sync.Mutex
+	open *int
+	peak *int
+}
+
+type writerCountingObject struct {
+	stiface.ObjectHandle
+	bucket writerCountingBucket
+}
+
+type writerCountingWriter struct {
+	stiface.Writer
+	bucket writerCountingBucket
+}
+
+func (b writerCountingBucket) Object(name string) stiface.ObjectHandle {
+	return writerCountingObject{ObjectHandle: b.BucketHandle.Object(name), bucket: b}
+}
+
+func (o writerCountingObject) NewWriter(ctx context.Context) stiface.Writer {
+	o.bucket.mu.Lock()
+	*o.bucket.open++
+	*o.bucket.peak = max(*o.bucket.peak, *o.bucket.open)
+	o.bucket.mu.Unlock()
+	return writerCountingWriter{Writer: o.ObjectHandle.NewWriter(ctx), bucket: o.bucket}
+}
+
+// ComposerFrom unwraps the sources, since the adapted handle only composes adapted handles.
+func (o writerCountingObject) ComposerFrom(srcs ...stiface.ObjectHandle) stiface.Composer {
+	unwrapped := make([]stiface.ObjectHandle, len(srcs))
+	for i, src := range srcs {
+		unwrapped[i] = src.(writerCountingObject).ObjectHandle
+	}
+	return o.ObjectHandle.ComposerFrom(unwrapped...)
+}
+
+func (w writerCountingWriter) Close() error {
+	// keep the writer open long enough for the other uploads to start theirs
+	time.Sleep(5 * time.Millisecond)
+	w.bucket.mu.Lock()
+	*w.bucket.open--
+	w.bucket.mu.Unlock()
+	return w.Writer.Close()
+}
+
+func TestUploadObjects_Composite_WriterLimit(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "placeholder"}},
+	})
+	defer server.Stop()
+	var open, peak int
+	bucket := writerCountingBucket{
+		BucketHandle: stiface.AdaptClient(server.Client()).Bucket(testBucket),
+		mu:           &sync.Mutex{},
+		open:         &open,
+		peak:         &peak,
+	}
+
+	tempDir := t.TempDir()
+	var ui []UploadInput
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(tempDir, fmt.Sprintf("large-%d.bin", i))
+		if err := os.WriteFile(path, bytes.Repeat([]byte("0123456789"), 1000), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+		ui = append(ui, UploadInput{FilePath: path, ObjectName: filepath.Base(path)})
+	}
+
+	u := Uploader{Concurrency: 3, CompositeThreshold: 1024, CompositeParts: 8}
+	for _, result := range u.UploadObjects(ui, bucket) {
+		if !result.Success {
+			t.Fatalf("UploadObjects() failed for %v: %v", result.FilePath, result.Message)
+		}
+	}
+	if peak > u.Concurrency {
+		t.Errorf("UploadObjects() peak open writers = %d, want at most %d", peak, u.Concurrency)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// ParseExtensions converts a comma separated list of file extensions, such as "html,.css, JS",
+// into a list of lower-case extensions without the leading dot.
+func ParseExtensions(val string) []string {
+	var out []string
+	for _, ext := range strings.Split(val, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			out = append(out, ext)
+		}
+	}
+	return out
+}
+
+// shouldGzip reports whether the file is gzipped when uploaded. If GzipExtensions is set, only
+// files with one of the extensions are gzipped, otherwise every file is gzipped if Gzip is set.
+func (u Uploader) shouldGzip(filePath string) bool {
+	if len(u.GzipExtensions) == 0 {
+		return u.Gzip
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), "."))
+	for _, e := range u.GzipExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// applyContentType sets the detected content type of the file on the object, unless detection is
+// disabled or a content-type header was provided.
+func (u Uploader) applyContentType(attrs *storage.ObjectAttrs, filePath string) error {
+	if !u.DetectContentType {
+		return nil
+	}
+	if _, ok := u.Headers["content-type"]; ok {
+		return nil
+	}
+
+	contentType, err := detectContentType(filePath)
+	if err != nil {
+		return err
+	}
+	attrs.ContentType = contentType
+	return nil
+}
+
+// detectContentType returns the content type registered for the file extension. When the extension
+// is unknown, the content type is sniffed from the start of the file.
+func detectContentType(filePath string) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(filePath)); contentType != "" {
+		return contentType, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("File.Read: %w", err)
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
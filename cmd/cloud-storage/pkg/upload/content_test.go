@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseExtensions(t *testing.T) {
+	want := []string{"html", "css", "js"}
+	got := ParseExtensions("html, .CSS,,js ")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseExtensions() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestShouldGzip(t *testing.T) {
+	tests := []struct {
+		name     string
+		uploader Uploader
+		path     string
+		want     bool
+	}{
+		{name: "GzipAll", uploader: Uploader{Gzip: true}, path: "image.png", want: true},
+		{name: "NoGzip", uploader: Uploader{Gzip: false}, path: "index.html", want: false},
+		{name: "ExtensionMatch", uploader: Uploader{GzipExtensions: []string{"html"}}, path: "dir/INDEX.HTML", want: true},
+		{name: "ExtensionNoMatch", uploader: Uploader{Gzip: true, GzipExtensions: []string{"html"}}, path: "image.png", want: false},
+		{name: "NoExtension", uploader: Uploader{GzipExtensions: []string{"html"}}, path: "LICENSE", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.uploader.shouldGzip(test.path); got != test.want {
+				t.Errorf("shouldGzip(%v) = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestUploadObjects_GzipExtensions_Success(t *testing.T) {
+	u, a, b, w, ui := setup(t)
+	u.Gzip = true
+	u.GzipExtensions = []string{"html"}
+
+	got := u.UploadObjects(ui, b)
+	if !got[0].Success {
+		t.Fatalf("UploadObjects(ui, b) failed: %v", got[0].Message)
+	}
+
+	// testFile.txt does not have a gzipped extension, so it is uploaded as-is
+	if got, want := string(w.data), "this is some example data"; got != want {
+		t.Errorf("data was modified. got = %v, want = %v", got, want)
+	}
+	if a.ContentEncoding != "" {
+		t.Errorf("ContentEncoding = %v, want empty", a.ContentEncoding)
+	}
+}
+
+func TestUploadObjects_DetectContentType_Success(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     string
+		headers  map[string]string
+		want     string
+	}{
+		{name: "Extension", fileName: "style.css", data: "body {}", want: "text/css; charset=utf-8"},
+		{name: "Sniffed", fileName: "page", data: "<html><body></body></html>", want: "text/html; charset=utf-8"},
+		{
+			name:     "Header",
+			fileName: "style.css",
+			data:     "body {}",
+			headers:  map[string]string{"content-type": "text/plain"},
+			want:     "text/plain",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, a, b, _, _ := setup(t)
+			u.DetectContentType = true
+			if test.headers != nil {
+				u.Headers = test.headers
+			}
+
+			path := filepath.Join(t.TempDir(), test.fileName)
+			if err := os.WriteFile(path, []byte(test.data), 0600); err != nil {
+				t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+			}
+
+			got := u.UploadObjects([]UploadInput{{FilePath: path, ObjectName: test.fileName}}, b)
+			if !got[0].Success {
+				t.Fatalf("UploadObjects() failed: %v", got[0].Message)
+			}
+			if a.ContentType != test.want {
+				t.Errorf("ContentType = %v, want %v", a.ContentType, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+// CopyInput is a server-side copy of an object into another object of the same bucket.
+type CopyInput struct {
+	SourceName string
+	ObjectName string
+}
+
+// CopyObjects copies each CopyInput within the bucket on the server side, keeping the metadata of
+// the source objects, with the same concurrency, retries and encryption as the uploads. It returns
+// a list of transfer.Results for the destination objects.
+func (u Uploader) CopyObjects(copies []CopyInput, bucket stiface.BucketHandle) []transfer.Results {
+	results := make([]transfer.Results, len(copies))
+	transfer.ForEachConcurrently(len(copies), u.Concurrency, func(i int) {
+		results[i] = u.copyObject(copies[i], bucket)
+	})
+	return results
+}
+
+func (u Uploader) copyObject(input CopyInput, bucket stiface.BucketHandle) transfer.Results {
+	result := transfer.Results{ObjectName: input.ObjectName}
+
+	var attrs *storage.ObjectAttrs
+	err := u.WithRetries(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
+		defer cancel()
+
+		c := u.destination(bucket, input.ObjectName).CopierFrom(u.object(bucket, input.SourceName))
+		if u.KMSKeyName != "" {
+			c.SetDestinationKMSKeyName(u.KMSKeyName)
+		}
+		var err error
+		attrs, err = c.Run(ctx)
+		return err
+	})
+	if err != nil {
+		result.Message = fmt.Sprintf("Copier.Run from %v: %v", input.SourceName, err)
+		return result
+	}
+
+	result.Success = true
+	result.Generation = attrs.Generation
+	result.CRC32C = EncodeCRC32C(attrs.CRC32C)
+	return result
+}
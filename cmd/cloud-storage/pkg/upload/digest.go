@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+)
+
+// recordObject completes the result of a successful upload with the generation and CRC32C of the
+// object, and a signed URL when a Signer is set.
+// The result fails if the URL cannot be produced, since it would be missing from the results.
+func (u Uploader) recordObject(result transfer.Results, attrs *storage.ObjectAttrs) transfer.Results {
+	if attrs != nil {
+		result.Generation = attrs.Generation
+		result.CRC32C = EncodeCRC32C(attrs.CRC32C)
+	}
+
+	if u.Signer != nil {
+		url, err := u.Signer.SignedURL(result.ObjectName)
+		if err != nil {
+			result.Success = false
+			result.Message = err.Error()
+			return result
+		}
+		result.SignedURL = url
+	}
+	return result
+}
+
+// FileDigest returns the sha256 digest of the file, in the "sha256:<hex>" format of the other
+// steps' provenance results.
+func FileDigest(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("io.Copy: %w", err)
+	}
+	return encodeDigest(h), nil
+}
+
+// newDigest returns the hash the file is written through during an upload attempt when
+// RecordDigests is set, and nil otherwise.
+func (u Uploader) newDigest() hash.Hash {
+	if !u.RecordDigests {
+		return nil
+	}
+	return sha256.New()
+}
+
+// encodeDigest returns the digest of the hash in the "sha256:<hex>" format, or an empty string for a
+// nil hash.
+func encodeDigest(h hash.Hash) string {
+	if h == nil {
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// EncodeCRC32C encodes the checksum as the base64 of its big-endian bytes, as in the GCS JSON API.
+func EncodeCRC32C(crc32c uint32) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, crc32c)
+	return base64.StdEncoding.EncodeToString(b)
+}
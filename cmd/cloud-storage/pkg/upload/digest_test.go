@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+// ignoreObjectFields ignores the fields assigned by the server when comparing results.
+var ignoreObjectFields = cmpopts.IgnoreFields(transfer.Results{}, "Generation", "CRC32C")
+
+func TestUploadObjects_RecordDigests(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "placeholder"}},
+	})
+	t.Cleanup(server.Stop)
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+	path := filepath.Join(t.TempDir(), "artifact.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	inputs := []UploadInput{{FilePath: path, ObjectName: "artifact.txt"}}
+
+	got := Uploader{Concurrency: 1, RecordDigests: true}.UploadObjects(inputs, bucket)
+	obj, err := server.GetObject(testBucket, "artifact.txt")
+	if err != nil {
+		t.Fatalf("server.GetObject() = %v", err)
+	}
+	want := []transfer.Results{{
+		FilePath:   path,
+		ObjectName: "artifact.txt",
+		Success:    true,
+		Generation: obj.Generation,
+		CRC32C:     obj.Crc32c,
+		Digest:     "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("UploadObjects() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploadObjects_Composite_RecordDigests(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "placeholder"}},
+	})
+	t.Cleanup(server.Stop)
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+	path := filepath.Join(t.TempDir(), "large.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("0123456789"), 1000), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	want, err := FileDigest(path)
+	if err != nil {
+		t.Fatalf("FileDigest() = %v", err)
+	}
+
+	u := Uploader{Concurrency: 4, RecordDigests: true, CompositeThreshold: 1024, CompositeParts: 4}
+	got := u.UploadObjects([]UploadInput{{FilePath: path, ObjectName: "large.bin"}}, bucket)
+	if !got[0].Success {
+		t.Fatalf("UploadObjects() failed: %v", got[0].Message)
+	}
+	if got[0].Digest != want {
+		t.Errorf("UploadObjects() digest = %v, want %v", got[0].Digest, want)
+	}
+}
+
+func TestFileDigest_Fail(t *testing.T) {
+	if _, err := FileDigest(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("FileDigest() of a missing file should fail")
+	}
+}
+
+func TestEncodeCRC32C(t *testing.T) {
+	// CRC32C of "hello world", as reported by the GCS JSON API
+	if got, want := EncodeCRC32C(0xc99465aa), "yZRlqg=="; got != want {
+		t.Errorf("EncodeCRC32C() = %v, want %v", got, want)
+	}
+}
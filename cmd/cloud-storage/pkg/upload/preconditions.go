@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// StatusAlreadyExists marks the result of a file that was not uploaded because the object
+	// already exists, or does not match the generation precondition.
+	StatusAlreadyExists = "already_exists"
+	// StatusIdentical marks the result of a file that was not uploaded because the object already
+	// exists with the same content, which counts as a success.
+	StatusIdentical = "identical"
+
+	alreadyExistsMessage = "object already exists or does not match the generation precondition"
+)
+
+// conditions returns the preconditions applied to every write, or nil if there are none. A
+// generation match of 0 is the same as requiring that the object does not exist.
+func (u Uploader) conditions() *storage.Conditions {
+	switch {
+	case u.NoClobber, u.IfGenerationMatch != nil && *u.IfGenerationMatch == 0:
+		return &storage.Conditions{DoesNotExist: true}
+	case u.IfGenerationMatch != nil:
+		return &storage.Conditions{GenerationMatch: *u.IfGenerationMatch}
+	default:
+		return nil
+	}
+}
+
+// destination returns the handle of the named object that is written to, with the encryption key
+// and preconditions of the Uploader.
+func (u Uploader) destination(bucket stiface.BucketHandle, name string) stiface.ObjectHandle {
+	o := u.object(bucket, name)
+	if conds := u.conditions(); conds != nil {
+		o = o.If(*conds)
+	}
+	return o
+}
+
+// isPreconditionFailed reports whether the write was rejected by its preconditions.
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// preconditionResult completes the result of an input whose write was rejected by its
+// preconditions. If SkipIdentical is set and the existing object has the same hash as the file,
+// the result is a success with StatusIdentical, otherwise it fails with StatusAlreadyExists.
+func (u Uploader) preconditionResult(input UploadInput, bucket stiface.BucketHandle, result transfer.Results) transfer.Results {
+	result.Status = StatusAlreadyExists
+	result.Message = alreadyExistsMessage
+	if !u.SkipIdentical {
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
+	defer cancel()
+
+	attrs, err := u.object(bucket, input.ObjectName).Attrs(ctx)
+	if err != nil {
+		result.Message = fmt.Sprintf("%s, ObjectHandle.Attrs: %v", alreadyExistsMessage, err)
+		return result
+	}
+	identical, err := u.isUnchanged(input.FilePath, attrs, SyncCompareChecksum)
+	if err != nil {
+		result.Message = fmt.Sprintf("%s, %v", alreadyExistsMessage, err)
+		return result
+	}
+	if identical {
+		result.Status = StatusIdentical
+		result.Success = true
+		result.Message = ""
+		// the file was not uploaded, so its digest is read from the file
+		if u.RecordDigests {
+			if result.Digest, err = FileDigest(input.FilePath); err != nil {
+				result.Success = false
+				result.Message = err.Error()
+				return result
+			}
+		}
+		return u.recordObject(result, attrs)
+	}
+	return result
+}
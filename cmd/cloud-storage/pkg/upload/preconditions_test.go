@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+func TestUploadObjects_Preconditions(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"new.txt":       "new data",
+		"identical.txt": "existing data",
+		"changed.txt":   "changed data",
+	}
+	var inputs []UploadInput
+	for _, name := range []string{"changed.txt", "identical.txt", "new.txt"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+		inputs = append(inputs, UploadInput{FilePath: path, ObjectName: name})
+	}
+
+	zero := int64(0)
+	tests := []struct {
+		name     string
+		uploader Uploader
+		want     []transfer.Results
+	}{
+		{
+			name:     "NoClobber",
+			uploader: Uploader{Concurrency: 1, NoClobber: true},
+			want: []transfer.Results{
+				{ObjectName: "changed.txt", Status: StatusAlreadyExists, Message: alreadyExistsMessage},
+				{ObjectName: "identical.txt", Status: StatusAlreadyExists, Message: alreadyExistsMessage},
+				{ObjectName: "new.txt", Success: true},
+			},
+		},
+		{
+			name:     "NoClobberSkipIdentical",
+			uploader: Uploader{Concurrency: 1, NoClobber: true, SkipIdentical: true},
+			want: []transfer.Results{
+				{ObjectName: "changed.txt", Status: StatusAlreadyExists, Message: alreadyExistsMessage},
+				{ObjectName: "identical.txt", Status: StatusIdentical, Success: true},
+				{ObjectName: "new.txt", Success: true},
+			},
+		},
+		{
+			name:     "GenerationZero",
+			uploader: Uploader{Concurrency: 1, IfGenerationMatch: &zero},
+			want: []transfer.Results{
+				{ObjectName: "changed.txt", Status: StatusAlreadyExists, Message: alreadyExistsMessage},
+				{ObjectName: "identical.txt", Status: StatusAlreadyExists, Message: alreadyExistsMessage},
+				{ObjectName: "new.txt", Success: true},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakestorage.NewServer([]fakestorage.Object{
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "changed.txt"},
+					Content:     []byte("existing data"),
+				},
+				{
+					ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "identical.txt"},
+					Content:     []byte("existing data"),
+				},
+			})
+			t.Cleanup(server.Stop)
+			bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+			for i := range test.want {
+				test.want[i].FilePath = inputs[i].FilePath
+			}
+			got := test.uploader.UploadObjects(inputs, bucket)
+			if diff := cmp.Diff(test.want, got, ignoreObjectFields); diff != "" {
+				t.Errorf("UploadObjects() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUploadObjects_GenerationMatch(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "artifact.txt"},
+			Content:     []byte("existing data"),
+		},
+	})
+	t.Cleanup(server.Stop)
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+	obj, err := server.GetObject(testBucket, "artifact.txt")
+	if err != nil {
+		t.Fatalf("server.GetObject() = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "artifact.txt")
+	if err := os.WriteFile(path, []byte("new data"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	inputs := []UploadInput{{FilePath: path, ObjectName: "artifact.txt"}}
+
+	stale := obj.Generation + 1
+	want := []transfer.Results{
+		{FilePath: path, ObjectName: "artifact.txt", Status: StatusAlreadyExists, Message: alreadyExistsMessage},
+	}
+	got := Uploader{Concurrency: 1, IfGenerationMatch: &stale}.UploadObjects(inputs, bucket)
+	if diff := cmp.Diff(want, got, ignoreObjectFields); diff != "" {
+		t.Errorf("UploadObjects() with stale generation diff (-want +got):\n%s", diff)
+	}
+
+	want = []transfer.Results{{FilePath: path, ObjectName: "artifact.txt", Success: true}}
+	got = Uploader{Concurrency: 1, IfGenerationMatch: &obj.Generation}.UploadObjects(inputs, bucket)
+	if diff := cmp.Diff(want, got, ignoreObjectFields); diff != "" {
+		t.Errorf("UploadObjects() with current generation diff (-want +got):\n%s", diff)
+	}
+}
@@ -16,116 +16,136 @@ package upload
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"strings"
 
-	ignore "github.com/sabhiram/go-gitignore"
-	"github.com/yargevad/filepathx"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/glob"
+	"github.com/GoogleCloudBuild/cicd-images/internal/gcloudignore"
 )
 
-// expandFolderPathWithGlob takes in a folder path and an optional glob string, and will perform
-// a glob expansion to return all files that match. A wildcard glob will be used if no glob is
-// provided.
-func expandFolderPathWithGlob(path, glob string) ([]string, error) {
-	if glob == "" {
-		glob = "**/*"
+// walkFiles walks the folder and calls fn with each file whose path relative to the folder matches
+// the glob pattern, as the files are found. A wildcard glob will be used if no pattern is provided.
+// If useIgnoreList is true, the .gcloudignore file at the root of the folder, or the gcloud default
+// rules when there is none, is processed, and ignored files and folders are skipped without being
+// walked.
+func walkFiles(folder, pattern string, useIgnoreList bool, fn func(path string) error) error {
+	if pattern == "" {
+		pattern = "**/*"
 	}
-
-	if !strings.HasSuffix(path, "/") {
-		path += "/"
+	matcher, err := glob.Compile(pattern)
+	if err != nil {
+		return err
 	}
 
-	return filepathx.Glob(path + glob)
-}
-
-// filterPaths will exclude all folders from the filepaths input.
-// Additionally, if useIgnoreList is true, the .gcloudignore list file will be processed,
-// and any filepaths that match will also be excluded.
-func filterPaths(filepaths []string, useIgnoreList bool) []string {
-	var outputList []string
-
-	var rules *ignore.GitIgnore
-
+	var rules *gcloudignore.Matcher
 	if useIgnoreList {
-		rules, _ = ignore.CompileIgnoreFile(".gcloudignore")
+		rules, err = gcloudignore.LoadOrDefault(folder)
+		if err != nil {
+			return fmt.Errorf("error processing %v: %w", gcloudignore.FileName, err)
+		}
 	}
 
-	for _, f := range filepaths {
-		fileInfo, _ := os.Stat(f)
-		if fileInfo.IsDir() {
-			continue
+	return rules.Walk(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
 		}
 
-		if rules != nil && rules.MatchesPath(f) {
-			fmt.Printf("Skipping file because it was on ignorelist: %v\n", f)
-			continue
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
 		}
+		if !matcher.MatchString(filepath.ToSlash(rel)) {
+			return nil
+		}
+		return fn(path)
+	})
+}
 
-		outputList = append(outputList, f)
+// buildUploadInput will construct the input to be passed to the Uploader for the file
+// under base. Each UploadInput contains both an original filepath string, and an ObjectName
+// string that the uploader will use when uploading to GCS. The ObjectName
+// will be the filepath unless the includeParent boolean is set to false, in which
+// case the base directory will be removed from the ObjectName
+func buildUploadInput(base, prefix, file string, includeParent bool) (UploadInput, error) {
+	if includeParent {
+		return UploadInput{FilePath: file, ObjectName: filepath.Join(prefix, file)}, nil
 	}
 
-	return outputList
+	objectName, err := filepath.Rel(base, file)
+	if err != nil {
+		return UploadInput{}, err
+	}
+	return UploadInput{FilePath: file, ObjectName: filepath.Join(prefix, objectName)}, nil
 }
 
-// buildUploadInput will construct the input to be passed to the Uploader.
-// Each UploadInput contains both an original filepath string, and an ObjectName
-// string that the uploader will use when uploading to GCS. The ObjectName
-// will be the filepath unless the includeParent boolean is set to false, in which
-// case the original parent directory from the path will be removed from the ObjectName
-func buildUploadInput(path, prefix string, filepaths []string, isDir, includeParent bool) ([]UploadInput, error) {
-	uploadInputs := make([]UploadInput, len(filepaths))
+// WalkPath will convert an input path (file or folder) into UploadInputs, with the same parameters
+// as ProcessPath. Rather than collecting them, fn is called with each UploadInput as the files are
+// found, so that uploads can start before a large folder has been fully walked and the whole tree
+// is never held in memory. The walk stops at the first error returned by fn.
+func WalkPath(path, prefix, glob string, useIgnoreList, includeParent bool, fn func(UploadInput) error) error {
+	fmt.Printf("Path provided: %v with glob %v\n", path, glob)
 
-	base := ""
-	if isDir {
-		base = path
-	} else {
-		base = filepath.Dir(path)
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error processing provided path: %v, %w", path, err)
 	}
 
-	for i, f := range filepaths {
-		uploadInputs[i].FilePath = f
-		if includeParent {
-			uploadInputs[i].ObjectName = filepath.Join(prefix, f)
-		} else {
-			objectName, err := filepath.Rel(base, f)
-			if err != nil {
-				return nil, err
-			}
-			uploadInputs[i].ObjectName = filepath.Join(prefix, objectName)
+	if !fileInfo.IsDir() {
+		if glob != "" {
+			return fmt.Errorf("can only provide glob when path is a folder")
+		}
+		input, err := buildUploadInput(filepath.Dir(path), prefix, path, includeParent)
+		if err != nil {
+			return err
 		}
+		return fn(input)
 	}
 
-	return uploadInputs, nil
+	return walkFiles(path, glob, useIgnoreList, func(file string) error {
+		input, err := buildUploadInput(path, prefix, file, includeParent)
+		if err != nil {
+			return err
+		}
+		return fn(input)
+	})
+}
+
+// CountPath adds the files that WalkPath would find to the totals of the Progress, without
+// building their UploadInputs, so that the totals are known ahead of a streamed upload.
+func CountPath(path, glob string, useIgnoreList bool, p *Progress) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error processing provided path: %v, %w", path, err)
+	}
+	if !fileInfo.IsDir() {
+		p.AddFile(path)
+		return nil
+	}
+	return walkFiles(path, glob, useIgnoreList, func(file string) error {
+		p.AddFile(file)
+		return nil
+	})
 }
 
 // ProcessPath will convert an input path (file or folder) into a list of UploadInput.
 // Each UploadInput object represents a single file that will need to be uploaded to GCS.
 // The prefix parameter will be the prefix for every GCS ObjectName
 // The glob parameter can be used alongside a folder path to do selective filtering.
-// The useIgnoreList parameter can be used to process a .gcloudignore file for additional filtering.
+// The useIgnoreList parameter can be used to process the .gcloudignore file at the root of a folder
+// path for additional filtering.
 // The includeParent parameter can be used to maintain or ignore the folder structure in the objects uploaded to GCS.
 func ProcessPath(path, prefix, glob string, useIgnoreList, includeParent bool) ([]UploadInput, error) {
-	fmt.Printf("Path provided: %v with glob %v\n", path, glob)
-
-	fileInfo, err := os.Stat(path)
+	var inputs []UploadInput
+	err := WalkPath(path, prefix, glob, useIgnoreList, includeParent, func(input UploadInput) error {
+		inputs = append(inputs, input)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error processing provided path: %v, %w", path, err)
-	}
-
-	if !fileInfo.IsDir() && glob != "" {
-		return nil, fmt.Errorf("can only provide glob when path is a folder")
-	}
-
-	if fileInfo.IsDir() {
-		fileList, err := expandFolderPathWithGlob(path, glob)
-		if err != nil {
-			return nil, err
-		}
-		fileList = filterPaths(fileList, useIgnoreList)
-		return buildUploadInput(path, prefix, fileList, true, includeParent)
-	} else {
-		fileList := []string{path}
-		return buildUploadInput(path, prefix, fileList, false, includeParent)
+		return nil, err
 	}
+	return inputs, nil
 }
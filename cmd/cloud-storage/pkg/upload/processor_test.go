@@ -229,21 +229,22 @@ func TestProcessPath_FolderWithIgnoreList_Success(t *testing.T) {
 	tempDir := setupTestDirectory(t)
 	defer os.RemoveAll(tempDir)
 
-	// create an gcloudignore file with the following data
+	// create an gcloudignore file at the root of the folder with the following data
+	// .gcloudignore
 	// *.go
 	// foo.txt
 	// c/*
 	// We expect this to do the following:
-	// 1) Skip all go files
-	// 2) Skip any foo.txt files, one exists in a/foo.txt
-	// 3) Skip all files in the c/ directory.
-	gcloudfile := ".gcloudignore"
-	data := []byte("*.go\nfoo.txt\nc/*")
+	// 1) Skip the .gcloudignore file itself
+	// 2) Skip all go files
+	// 3) Skip any foo.txt files, one exists in a/foo.txt
+	// 4) Skip all files in the c/ directory.
+	gcloudfile := filepath.Join(tempDir, ".gcloudignore")
+	data := []byte(".gcloudignore\n*.go\nfoo.txt\nc/*")
 	e := os.WriteFile(gcloudfile, data, 0600)
 	if e != nil {
 		t.Errorf("os.WriteFile(path, data, 0600) = %v", e)
 	}
-	defer os.Remove(gcloudfile)
 
 	want := []UploadInput{
 		{
@@ -322,3 +323,52 @@ func TestProcessPath_FolderWithGlobs_Success(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessPath_FolderWithIgnoreListIncludeAndNegation_Success(t *testing.T) {
+	tempDir := setupTestDirectory(t)
+	defer os.RemoveAll(tempDir)
+
+	// the .gitignore file is included, and ignores the a/ and c/ directories and all txt files
+	// except file2.txt. The negation cannot include a/foo.txt again because a/ is ignored.
+	files := map[string]string{
+		".gcloudignore": ".gcloudignore\n.gitignore\n#!include:.gitignore\n!file2.txt\n!foo.txt\n",
+		".gitignore":    "a/\n/c\n*.txt\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(data), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+	}
+
+	want := []UploadInput{
+		{
+			FilePath:   filepath.Join(tempDir, "file2.txt"),
+			ObjectName: "file2.txt",
+		},
+		{
+			FilePath:   filepath.Join(tempDir, "file3.go"),
+			ObjectName: "file3.go",
+		},
+	}
+
+	got, err := ProcessPath(tempDir, "", "", true, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ProcessPath(tempDir, '', '', true, false) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestProcessPath_FolderWithMissingInclude_Fail(t *testing.T) {
+	tempDir := setupTestDirectory(t)
+	defer os.RemoveAll(tempDir)
+
+	if err := os.WriteFile(filepath.Join(tempDir, ".gcloudignore"), []byte("#!include:.gitignore\n"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+
+	if _, err := ProcessPath(tempDir, "", "", true, false); err == nil {
+		t.Errorf("ProcessPath() expected error for missing included file")
+	}
+}
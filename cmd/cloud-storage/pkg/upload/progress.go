@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/inhies/go-bytesize"
+)
+
+// Progress counts the files and bytes of the uploads as they are written, and reports them
+// periodically. It is safe for concurrent use, and a nil Progress reports nothing.
+type Progress struct {
+	// Out receives the reports, defaults to os.Stdout.
+	Out io.Writer
+	// JSON reports machine-readable JSON lines instead of text.
+	JSON bool
+	// LogFiles reports every uploaded file with its size and duration.
+	LogFiles bool
+
+	filesTotal atomic.Int64
+	bytesTotal atomic.Int64
+	filesDone  atomic.Int64
+	bytesDone  atomic.Int64
+
+	start time.Time
+	mu    sync.Mutex
+}
+
+// ProgressReport is a snapshot of the progress of the uploads. The ETA is only known once some
+// bytes have been uploaded.
+type ProgressReport struct {
+	Type           string  `json:"type"`
+	FilesDone      int64   `json:"files_done"`
+	FilesTotal     int64   `json:"files_total"`
+	BytesDone      int64   `json:"bytes_done"`
+	BytesTotal     int64   `json:"bytes_total"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	ETASeconds     float64 `json:"eta_seconds,omitempty"`
+}
+
+// FileReport is the debug report of a single uploaded file.
+type FileReport struct {
+	Type            string  `json:"type"`
+	FilePath        string  `json:"file_path"`
+	ObjectName      string  `json:"object_name"`
+	Success         bool    `json:"success"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// NewProgress creates a Progress that measures the throughput from now.
+func NewProgress(out io.Writer, jsonLines, logFiles bool) *Progress {
+	return &Progress{Out: out, JSON: jsonLines, LogFiles: logFiles, start: time.Now()}
+}
+
+// AddFile adds the file to the totals. The file counts as empty if it cannot be read, the upload
+// reports the error.
+func (p *Progress) AddFile(filePath string) {
+	if p == nil {
+		return
+	}
+	p.filesTotal.Add(1)
+	if info, err := os.Stat(filePath); err == nil {
+		p.bytesTotal.Add(info.Size())
+	}
+}
+
+// Report returns a snapshot of the progress.
+func (p *Progress) Report() ProgressReport {
+	r := ProgressReport{
+		Type:       "progress",
+		FilesDone:  p.filesDone.Load(),
+		FilesTotal: p.filesTotal.Load(),
+		BytesDone:  p.bytesDone.Load(),
+		BytesTotal: p.bytesTotal.Load(),
+	}
+	elapsed := time.Since(p.start).Seconds()
+	r.ElapsedSeconds = elapsed
+	if elapsed > 0 {
+		r.BytesPerSecond = float64(r.BytesDone) / elapsed
+	}
+	if r.BytesPerSecond > 0 && r.BytesTotal > r.BytesDone {
+		r.ETASeconds = float64(r.BytesTotal-r.BytesDone) / r.BytesPerSecond
+	}
+	return r
+}
+
+func (r ProgressReport) String() string {
+	s := fmt.Sprintf("Progress: %d/%d files, %v/%v, %v/s", r.FilesDone, r.FilesTotal,
+		bytesize.New(float64(r.BytesDone)), bytesize.New(float64(r.BytesTotal)), bytesize.New(r.BytesPerSecond))
+	if r.ETASeconds > 0 {
+		s += fmt.Sprintf(", ETA %v", (time.Duration(r.ETASeconds) * time.Second).Round(time.Second))
+	}
+	return s
+}
+
+// Start reports the progress every interval until the returned stop function is called, which
+// reports it one last time. Nothing is reported if the interval is not positive.
+func (p *Progress) Start(interval time.Duration) (stop func()) {
+	if p == nil || interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.print(p.Report())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		p.print(p.Report())
+	}
+}
+
+// print writes a report as a line of text or JSON.
+func (p *Progress) print(report fmt.Stringer) {
+	out := p.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	line := report.String()
+	if p.JSON {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return
+		}
+		line = string(data)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(out, line)
+}
+
+func (r FileReport) String() string {
+	status := "Uploaded"
+	if !r.Success {
+		status = "Failed to upload"
+	}
+	return fmt.Sprintf("%v %v to %v: %v in %v", status, r.FilePath, r.ObjectName, bytesize.New(float64(r.Bytes)),
+		(time.Duration(r.DurationSeconds * float64(time.Second))).Round(time.Millisecond))
+}
+
+// fileDone counts the file as done, and logs it if LogFiles is set.
+func (p *Progress) fileDone(result transfer.Results, size int64, start time.Time) {
+	if p == nil {
+		return
+	}
+	p.filesDone.Add(1)
+	if p.LogFiles {
+		p.print(FileReport{
+			Type:            "file",
+			FilePath:        result.FilePath,
+			ObjectName:      result.ObjectName,
+			Success:         result.Success,
+			Bytes:           size,
+			DurationSeconds: time.Since(start).Seconds(),
+		})
+	}
+}
+
+// counter returns a counting writer for a single attempt at writing bytes of a file. The bytes of
+// a failed attempt are taken back with rollback, so that retries are not counted twice.
+func (p *Progress) counter() *byteCounter {
+	return &byteCounter{p: p}
+}
+
+// byteCounter is a writer that discards the bytes written to it and counts them.
+type byteCounter struct {
+	p *Progress
+	n int64
+}
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	if c.p != nil {
+		c.n += int64(len(b))
+		c.p.bytesDone.Add(int64(len(b)))
+	}
+	return len(b), nil
+}
+
+// rollback takes back the bytes counted by the attempt if it failed.
+func (c *byteCounter) rollback(err error) {
+	if err != nil && c.p != nil {
+		c.p.bytesDone.Add(-c.n)
+		c.n = 0
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/api/googleapi"
+)
+
+// sizeOfTestFile is the size of the file created by setup.
+const sizeOfTestFile = int64(len("this is some example data"))
+
+func TestUploadObjects_Progress(t *testing.T) {
+	u, _, b, _, ui := setup(t)
+	var out bytes.Buffer
+	u.Progress = NewProgress(&out, true, true)
+
+	got := u.UploadObjects(ui, b)
+	if !got[0].Success {
+		t.Fatalf("UploadObjects() failed: %v", got[0].Message)
+	}
+
+	want := ProgressReport{
+		Type:       "progress",
+		FilesDone:  1,
+		FilesTotal: 1,
+		BytesDone:  sizeOfTestFile,
+		BytesTotal: sizeOfTestFile,
+	}
+	ignoreTimes := cmpopts.IgnoreFields(ProgressReport{}, "BytesPerSecond", "ElapsedSeconds", "ETASeconds")
+	if diff := cmp.Diff(want, u.Progress.Report(), ignoreTimes); diff != "" {
+		t.Errorf("Report() diff (-want +got):\n%s", diff)
+	}
+
+	var report FileReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("json.Unmarshal(%v) = %v", out.String(), err)
+	}
+	wantFile := FileReport{
+		Type:       "file",
+		FilePath:   ui[0].FilePath,
+		ObjectName: ui[0].ObjectName,
+		Success:    true,
+		Bytes:      sizeOfTestFile,
+	}
+	if diff := cmp.Diff(wantFile, report, cmpopts.IgnoreFields(FileReport{}, "DurationSeconds")); diff != "" {
+		t.Errorf("file report diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploadObjects_ProgressRetriesCountedOnce(t *testing.T) {
+	u, _, _, _, ui := setup(t)
+	u.Retries = 3
+	u.RetryBackoff = time.Millisecond
+	u.Progress = NewProgress(&bytes.Buffer{}, false, false)
+
+	attempts := 0
+	b := flakyBucketMock{oMock: flakyObjectMock{
+		attempts: &attempts,
+		failures: 2,
+		closeErr: &googleapi.Error{Code: 503, Message: "backend unavailable"},
+	}}
+	if got := u.UploadObjects(ui, b); !got[0].Success {
+		t.Fatalf("UploadObjects() failed: %v", got[0].Message)
+	}
+
+	if got := u.Progress.Report().BytesDone; got != sizeOfTestFile {
+		t.Errorf("Report().BytesDone = %d, want %d", got, sizeOfTestFile)
+	}
+}
+
+func TestProgress_Start(t *testing.T) {
+	var out bytes.Buffer
+	p := NewProgress(&out, false, false)
+	p.filesTotal.Store(4)
+	p.bytesTotal.Store(4096)
+	p.filesDone.Store(1)
+	p.bytesDone.Store(1024)
+
+	stop := p.Start(time.Hour)
+	stop()
+
+	got := out.String()
+	if !strings.HasPrefix(got, "Progress: 1/4 files, 1.00KB/4.00KB, ") || !strings.Contains(got, "ETA ") {
+		t.Errorf("progress report = %q, want the files, bytes, throughput and ETA", got)
+	}
+}
+
+func TestProgress_Nil(t *testing.T) {
+	var p *Progress
+	p.AddFile("missing.txt")
+	p.Start(time.Second)()
+	p.fileDone(transfer.Results{}, 0, time.Now())
+}
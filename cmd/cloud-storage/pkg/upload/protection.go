@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+const (
+	// EncryptionKeySize is the size in bytes of a customer-supplied AES-256 encryption key.
+	EncryptionKeySize = 32
+
+	RetentionModeUnlocked = "Unlocked"
+	RetentionModeLocked   = "Locked"
+)
+
+// LoadEncryptionKey reads a base64 encoded AES-256 customer-supplied encryption key from the file,
+// or from the environment variable if no file is provided. A nil key is returned when neither is set.
+func LoadEncryptionKey(filePath, envVar string) ([]byte, error) {
+	var encoded string
+	switch {
+	case filePath != "":
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile: %w", err)
+		}
+		encoded = string(data)
+	case envVar != "":
+		var ok bool
+		encoded, ok = os.LookupEnv(envVar)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %v is not set", envVar)
+		}
+	default:
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not base64 encoded: %w", err)
+	}
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	return key, nil
+}
+
+// object returns the handle of the named object, using the customer-supplied encryption key if set.
+func (u Uploader) object(bucket stiface.BucketHandle, name string) stiface.ObjectHandle {
+	o := bucket.Object(name)
+	if u.EncryptionKey != nil {
+		o = o.Key(u.EncryptionKey)
+	}
+	return o
+}
+
+// applyProtection sets the KMS key, holds and retention of the Uploader on the object.
+func (u Uploader) applyProtection(attrs *storage.ObjectAttrs) {
+	if u.KMSKeyName != "" {
+		attrs.KMSKeyName = u.KMSKeyName
+	}
+	if u.EventBasedHold {
+		attrs.EventBasedHold = true
+	}
+	if u.TemporaryHold {
+		attrs.TemporaryHold = true
+	}
+	if !u.RetainUntil.IsZero() {
+		mode := u.RetentionMode
+		if mode == "" {
+			mode = RetentionModeUnlocked
+		}
+		attrs.Retention = &storage.ObjectRetention{Mode: mode, RetainUntil: u.RetainUntil}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+// keyObjectMock records the customer-supplied encryption key the object handle was given.
+type keyObjectMock struct {
+	objectMock
+	key *[]byte
+}
+
+func (m keyObjectMock) Key(key []byte) stiface.ObjectHandle {
+	*m.key = key
+	return m
+}
+
+type keyBucketMock struct {
+	stiface.BucketHandle
+	oMock keyObjectMock
+}
+
+func (m keyBucketMock) Object(_ string) stiface.ObjectHandle {
+	return m.oMock
+}
+
+func TestLoadEncryptionKey_Success(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, EncryptionKeySize)
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	keyPath := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyPath, []byte(encoded+"\n"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	t.Setenv("TEST_ENCRYPTION_KEY", encoded)
+
+	tests := []struct {
+		name     string
+		filePath string
+		envVar   string
+		want     []byte
+	}{
+		{name: "File", filePath: keyPath, want: key},
+		{name: "Env", envVar: "TEST_ENCRYPTION_KEY", want: key},
+		{name: "None"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := LoadEncryptionKey(test.filePath, test.envVar)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("LoadEncryptionKey() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadEncryptionKey_Fail(t *testing.T) {
+	t.Setenv("TEST_SHORT_KEY", base64.StdEncoding.EncodeToString([]byte("too short")))
+	t.Setenv("TEST_INVALID_KEY", "not base64!")
+
+	tests := []struct {
+		name    string
+		envVar  string
+		wantErr string
+	}{
+		{name: "Unset", envVar: "TEST_UNSET_KEY", wantErr: "environment variable TEST_UNSET_KEY is not set"},
+		{name: "Short", envVar: "TEST_SHORT_KEY", wantErr: "encryption key must be 32 bytes, got 9"},
+		{
+			name:    "Invalid",
+			envVar:  "TEST_INVALID_KEY",
+			wantErr: "encryption key is not base64 encoded: illegal base64 data at input byte 3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadEncryptionKey("", test.envVar)
+			if err == nil {
+				t.Fatalf("LoadEncryptionKey() expected error %v", test.wantErr)
+			}
+			if diff := cmp.Diff(test.wantErr, err.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestUploadObjects_Protection_Success(t *testing.T) {
+	u, a, b, _, ui := setup(t)
+	retainUntil := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	u.KMSKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	u.EventBasedHold = true
+	u.TemporaryHold = true
+	u.RetainUntil = retainUntil
+
+	got := u.UploadObjects(ui, b)
+	if !got[0].Success {
+		t.Fatalf("UploadObjects(ui, b) failed: %v", got[0].Message)
+	}
+
+	want := &storage.ObjectAttrs{
+		KMSKeyName:     "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+		EventBasedHold: true,
+		TemporaryHold:  true,
+		Retention:      &storage.ObjectRetention{Mode: RetentionModeUnlocked, RetainUntil: retainUntil},
+		Metadata:       map[string]string{},
+	}
+	if diff := cmp.Diff(want, a); diff != "" {
+		t.Errorf("object attrs diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploadObjects_EncryptionKey_Success(t *testing.T) {
+	u, _, _, w, ui := setup(t)
+	u.EncryptionKey = bytes.Repeat([]byte{7}, EncryptionKeySize)
+	u.CompositeThreshold = 1
+
+	var gotKey []byte
+	b := keyBucketMock{oMock: keyObjectMock{objectMock: objectMock{wMock: w}, key: &gotKey}}
+	got := u.UploadObjects(ui, b)
+	if !got[0].Success {
+		t.Fatalf("UploadObjects(ui, b) failed: %v", got[0].Message)
+	}
+	if !bytes.Equal(gotKey, u.EncryptionKey) {
+		t.Errorf("object key = %v, want %v", gotKey, u.EncryptionKey)
+	}
+	if string(w.data) != "this is some example data" {
+		t.Errorf("data = %q, want a single upload of the file", w.data)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/glob"
+	"github.com/goccy/go-yaml"
+)
+
+// ObjectOptions overrides the Uploader settings for a single UploadInput.
+type ObjectOptions struct {
+	// Headers are applied on top of the Uploader headers.
+	Headers      map[string]string
+	ACL          string
+	StorageClass string
+	// Gzip, when set, replaces the Uploader Gzip and GzipExtensions settings.
+	Gzip *bool
+}
+
+// Rule applies headers, an acl, a storage class and gzip settings to the objects whose name
+// matches the glob.
+type Rule struct {
+	Glob         string            `yaml:"glob"`
+	Headers      map[string]string `yaml:"headers"`
+	ACL          string            `yaml:"acl"`
+	StorageClass string            `yaml:"storageClass"`
+	Gzip         *bool             `yaml:"gzip"`
+
+	matcher *regexp.Regexp
+}
+
+// Rules is the content of a header rules file, such as:
+//
+//	rules:
+//	- glob: "assets/**"
+//	  headers:
+//	    cache-control: public, max-age=31536000, immutable
+//	- glob: "*.html"
+//	  headers:
+//	    cache-control: no-cache
+//	  gzip: true
+//
+// A glob without a '/' matches the base name of objects at any depth. Every matching rule is
+// applied in order, so later rules override the settings of earlier ones.
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadRules reads a YAML or JSON header rules file and compiles the globs of its rules.
+func LoadRules(filePath string) (*Rules, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	return ParseRules(data)
+}
+
+// ParseRules parses YAML or JSON header rules and compiles the globs of its rules.
+func ParseRules(data []byte) (*Rules, error) {
+	rules := &Rules{}
+	if err := yaml.UnmarshalWithOptions(data, rules, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("failed to parse header rules: %w", err)
+	}
+
+	for i := range rules.Rules {
+		r := &rules.Rules[i]
+		if r.Glob == "" {
+			return nil, fmt.Errorf("header rule %d is missing a glob", i)
+		}
+		matcher, err := glob.Compile(r.Glob)
+		if err != nil {
+			return nil, fmt.Errorf("header rule %d: %w", i, err)
+		}
+		r.matcher = matcher
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule applies to the object name, relative to the destination.
+func (r Rule) matches(name string) bool {
+	if !strings.Contains(r.Glob, "/") {
+		name = path.Base(name)
+	}
+	return r.matcher.MatchString(name)
+}
+
+// Apply sets the Options of each input from the rules matching its object name relative to the
+// destination prefix, see ApplyInput.
+func (r *Rules) Apply(inputs []UploadInput, prefix string) {
+	for i := range inputs {
+		r.ApplyInput(&inputs[i], prefix)
+	}
+}
+
+// ApplyInput sets the Options of the input from the rules matching its object name relative to the
+// destination prefix. An input matching no rule is left unchanged, as are all inputs when r is nil.
+func (r *Rules) ApplyInput(input *UploadInput, prefix string) {
+	if r == nil {
+		return
+	}
+
+	name := input.ObjectName
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		name = strings.TrimPrefix(name, prefix+"/")
+	}
+
+	var opts *ObjectOptions
+	for _, rule := range r.Rules {
+		if !rule.matches(name) {
+			continue
+		}
+		if opts == nil {
+			opts = &ObjectOptions{Headers: map[string]string{}}
+		}
+		maps.Copy(opts.Headers, rule.Headers)
+		if rule.ACL != "" {
+			opts.ACL = rule.ACL
+		}
+		if rule.StorageClass != "" {
+			opts.StorageClass = rule.StorageClass
+		}
+		if rule.Gzip != nil {
+			opts.Gzip = rule.Gzip
+		}
+	}
+	input.Options = opts
+}
+
+// forInput returns the Uploader with the Options of the input applied.
+func (u Uploader) forInput(input UploadInput) Uploader {
+	opts := input.Options
+	if opts == nil {
+		return u
+	}
+
+	if len(opts.Headers) > 0 {
+		headers := maps.Clone(u.Headers)
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		maps.Copy(headers, opts.Headers)
+		u.Headers = headers
+	}
+	if opts.ACL != "" {
+		u.ACL = opts.ACL
+	}
+	if opts.StorageClass != "" {
+		u.StorageClass = opts.StorageClass
+	}
+	if opts.Gzip != nil {
+		u.Gzip = *opts.Gzip
+		u.GzipExtensions = nil
+	}
+	return u
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testRules = `
+rules:
+- glob: "**"
+  headers:
+    cache-control: no-cache
+- glob: "assets/**"
+  headers:
+    cache-control: public, max-age=31536000, immutable
+  storageClass: STANDARD
+- glob: "*.png"
+  gzip: false
+  acl: publicRead
+`
+
+func TestParseRules_Fail(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "MissingGlob", rules: "rules:\n- headers:\n    cache-control: no-cache\n"},
+		{name: "InvalidGlob", rules: "rules:\n- glob: \"[abc\"\n"},
+		{name: "UnknownField", rules: "rules:\n- glob: \"*\"\n  header: {}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseRules([]byte(test.rules)); err == nil {
+				t.Errorf("ParseRules() expected error")
+			}
+		})
+	}
+}
+
+func TestRulesApply_Success(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	noGzip := false
+	inputs := []UploadInput{
+		{FilePath: "index.html", ObjectName: "site/index.html"},
+		{FilePath: "assets/app.js", ObjectName: "site/assets/app.js"},
+		{FilePath: "assets/img/logo.png", ObjectName: "site/assets/img/logo.png"},
+	}
+	want := []UploadInput{
+		{
+			FilePath:   "index.html",
+			ObjectName: "site/index.html",
+			Options:    &ObjectOptions{Headers: map[string]string{"cache-control": "no-cache"}},
+		},
+		{
+			FilePath:   "assets/app.js",
+			ObjectName: "site/assets/app.js",
+			Options: &ObjectOptions{
+				Headers:      map[string]string{"cache-control": "public, max-age=31536000, immutable"},
+				StorageClass: "STANDARD",
+			},
+		},
+		{
+			FilePath:   "assets/img/logo.png",
+			ObjectName: "site/assets/img/logo.png",
+			Options: &ObjectOptions{
+				Headers:      map[string]string{"cache-control": "public, max-age=31536000, immutable"},
+				ACL:          "publicRead",
+				StorageClass: "STANDARD",
+				Gzip:         &noGzip,
+			},
+		},
+	}
+
+	rules.Apply(inputs, "site/")
+	if diff := cmp.Diff(want, inputs); diff != "" {
+		t.Errorf("Apply() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUploadObjects_Rules_Success(t *testing.T) {
+	u, a, b, w, ui := setup(t)
+	u.Gzip = true
+	u.Headers = map[string]string{"cache-control": "no-store", "content-language": "en"}
+	noGzip := false
+	ui[0].Options = &ObjectOptions{
+		Headers:      map[string]string{"cache-control": "no-cache"},
+		ACL:          "publicRead",
+		StorageClass: "NEARLINE",
+		Gzip:         &noGzip,
+	}
+
+	got := u.UploadObjects(ui, b)
+	if !got[0].Success {
+		t.Fatalf("UploadObjects(ui, b) failed: %v", got[0].Message)
+	}
+
+	want := map[string]string{
+		"CacheControl":    "no-cache",
+		"ContentLanguage": "en",
+		"ContentEncoding": "",
+		"PredefinedACL":   "publicRead",
+		"StorageClass":    "NEARLINE",
+		"Data":            "this is some example data",
+	}
+	gotAttrs := map[string]string{
+		"CacheControl":    a.CacheControl,
+		"ContentLanguage": a.ContentLanguage,
+		"ContentEncoding": a.ContentEncoding,
+		"PredefinedACL":   a.PredefinedACL,
+		"StorageClass":    a.StorageClass,
+		"Data":            string(w.data),
+	}
+	if diff := cmp.Diff(want, gotAttrs); diff != "" {
+		t.Errorf("object attrs diff (-want +got):\n%s", diff)
+	}
+	// the Uploader headers are not modified by the rules of an input
+	if u.Headers["cache-control"] != "no-store" {
+		t.Errorf("Uploader headers were modified: %v", u.Headers)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+// MaxSignedURLTTL is the longest expiration allowed for a V4 signed URL.
+const MaxSignedURLTTL = 7 * 24 * time.Hour
+
+// Signer generates V4 signed URLs for the objects of a bucket. It signs either with the private
+// key of a service account, or through the IAM signBlob API on behalf of a service account.
+type Signer struct {
+	Bucket string
+	TTL    time.Duration
+
+	googleAccessID string
+	privateKey     []byte
+	signBytes      func([]byte) ([]byte, error)
+}
+
+// NewKeySigner creates a Signer from the JSON key file of a service account.
+func NewKeySigner(bucket string, ttl time.Duration, keyFile string) (*Signer, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key file: %w", err)
+	}
+	cfg, err := google.JWTConfigFromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing key file: %w", err)
+	}
+	return &Signer{Bucket: bucket, TTL: ttl, googleAccessID: cfg.Email, privateKey: cfg.PrivateKey}, nil
+}
+
+// NewIAMSigner creates a Signer that signs through the IAM signBlob API, with the ambient
+// credentials, on behalf of the service account. The credentials need the
+// iam.serviceAccounts.signBlob permission on the service account.
+func NewIAMSigner(ctx context.Context, bucket string, ttl time.Duration, serviceAccount string,
+	opts ...option.ClientOption) (*Signer, error) {
+	svc, err := iamcredentials.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("iamcredentials.NewService: %w", err)
+	}
+	name := "projects/-/serviceAccounts/" + serviceAccount
+
+	signBytes := func(b []byte) ([]byte, error) {
+		req := &iamcredentials.SignBlobRequest{Payload: base64.StdEncoding.EncodeToString(b)}
+		resp, err := svc.Projects.ServiceAccounts.SignBlob(name, req).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("error calling signBlob for %v: %w", serviceAccount, err)
+		}
+		return base64.StdEncoding.DecodeString(resp.SignedBlob)
+	}
+	return &Signer{Bucket: bucket, TTL: ttl, googleAccessID: serviceAccount, signBytes: signBytes}, nil
+}
+
+// SignedURL returns a V4 signed URL to GET the object, expiring after the TTL of the Signer.
+func (s *Signer) SignedURL(objectName string) (string, error) {
+	url, err := storage.SignedURL(s.Bucket, objectName, &storage.SignedURLOptions{
+		GoogleAccessID: s.googleAccessID,
+		PrivateKey:     s.privateKey,
+		SignBytes:      s.signBytes,
+		Method:         http.MethodGet,
+		Expires:        time.Now().Add(s.TTL),
+		Scheme:         storage.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error signing url for %v: %w", objectName, err)
+	}
+	return url, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+)
+
+const signingAccount = "signer@my-project.iam.gserviceaccount.com"
+
+func writeKeyFile(t *testing.T) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() = %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	data, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": signingAccount,
+		"private_key":  string(pemKey),
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	return path
+}
+
+// checkSignedURL verifies the V4 signed URL of the object, signed by signingAccount for an hour,
+// and returns its query.
+func checkSignedURL(t *testing.T, signedURL, objectName string) url.Values {
+	t.Helper()
+
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", signedURL, err)
+	}
+	if diff := cmp.Diff("/"+testBucket+"/"+objectName, u.Path); diff != "" {
+		t.Errorf("signed url path diff (-want +got):\n%s", diff)
+	}
+	q := u.Query()
+	if got := q.Get("X-Goog-Algorithm"); got != "GOOG4-RSA-SHA256" {
+		t.Errorf("X-Goog-Algorithm = %v, want GOOG4-RSA-SHA256", got)
+	}
+	// the expiration is relative to the signing time, which is after the Signer computed it
+	if got, _ := strconv.Atoi(q.Get("X-Goog-Expires")); got < 3590 || got > 3600 {
+		t.Errorf("X-Goog-Expires = %v, want about 3600", got)
+	}
+	if got := q.Get("X-Goog-Credential"); !strings.HasPrefix(got, signingAccount+"/") {
+		t.Errorf("X-Goog-Credential = %v, want the signing account", got)
+	}
+	if q.Get("X-Goog-Signature") == "" {
+		t.Error("signed url is missing X-Goog-Signature")
+	}
+	return q
+}
+
+func TestKeySigner(t *testing.T) {
+	s, err := NewKeySigner(testBucket, time.Hour, writeKeyFile(t))
+	if err != nil {
+		t.Fatalf("NewKeySigner() = %v", err)
+	}
+	got, err := s.SignedURL("dir/artifact.txt")
+	if err != nil {
+		t.Fatalf("SignedURL() = %v", err)
+	}
+	checkSignedURL(t, got, "dir/artifact.txt")
+}
+
+func TestKeySigner_Fail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+	if _, err := NewKeySigner(testBucket, time.Hour, path); err == nil {
+		t.Error("NewKeySigner() with an invalid key file should fail")
+	}
+}
+
+func TestIAMSigner(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"keyId":      "key",
+			"signedBlob": base64.StdEncoding.EncodeToString([]byte("signature")),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := NewIAMSigner(context.Background(), testBucket, time.Hour, signingAccount,
+		option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewIAMSigner() = %v", err)
+	}
+	got, err := s.SignedURL("artifact.txt")
+	if err != nil {
+		t.Fatalf("SignedURL() = %v", err)
+	}
+	q := checkSignedURL(t, got, "artifact.txt")
+	if want := "/v1/projects/-/serviceAccounts/" + signingAccount + ":signBlob"; gotPath != want {
+		t.Errorf("signBlob path = %v, want %v", gotPath, want)
+	}
+	if sig := q.Get("X-Goog-Signature"); sig != "7369676e6174757265" {
+		t.Errorf("X-Goog-Signature = %v, want the hex of the signBlob response", sig)
+	}
+}
+
+func TestUploadObjects_SignedURL(t *testing.T) {
+	u, _, b, _, ui := setup(t)
+	s, err := NewKeySigner(testBucket, time.Hour, writeKeyFile(t))
+	if err != nil {
+		t.Fatalf("NewKeySigner() = %v", err)
+	}
+	u.Signer = s
+
+	got := u.UploadObjects(ui, b)
+	for _, result := range got {
+		if !result.Success {
+			t.Fatalf("UploadObjects() failed: %v", result.Message)
+		}
+		checkSignedURL(t, result.SignedURL, result.ObjectName)
+	}
+}
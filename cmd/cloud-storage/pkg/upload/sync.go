@@ -0,0 +1,188 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5" //nolint:gosec // md5 is only used to compare against the GCS object hash
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	SyncCompareChecksum = "checksum"
+	SyncCompareMtime    = "mtime"
+
+	// MtimeMetadataKey is the custom metadata key holding the local modification time (in unix
+	// seconds) of an uploaded file. It is the same key used by gsutil.
+	MtimeMetadataKey = "goog-reserved-file-mtime"
+)
+
+// SyncPlan is the outcome of comparing local files against the objects under the destination.
+type SyncPlan struct {
+	// Upload holds the inputs that are new or have changed.
+	Upload []UploadInput
+	// Skip holds the inputs that are identical to the existing object.
+	Skip []UploadInput
+	// Delete holds the objects that have no matching local file, with their listed generation.
+	Delete []transfer.DeleteInput
+}
+
+// Print writes the plan in a human readable form.
+func (p SyncPlan) Print() {
+	for _, input := range p.Upload {
+		fmt.Printf("Upload: %v -> %v\n", input.FilePath, input.ObjectName)
+	}
+	for _, input := range p.Skip {
+		fmt.Printf("Skip (unchanged): %v\n", input.FilePath)
+	}
+	for _, input := range p.Delete {
+		fmt.Printf("Delete: %v\n", input.ObjectName)
+	}
+	fmt.Printf("Sync plan: %d to upload, %d unchanged, %d to delete\n", len(p.Upload), len(p.Skip), len(p.Delete))
+}
+
+// PlanSync lists the objects under syncRoot and compares them with the inputs. Inputs with no
+// existing object, or whose object differs, are planned for upload and the rest are skipped.
+// The compare parameter picks how files are compared: SyncCompareChecksum compares the hash of
+// the bytes that would be uploaded with the object's MD5 (or CRC32C for composite objects), and
+// SyncCompareMtime compares the modification time recorded in MtimeMetadataKey and the size.
+// If deleteExtra is true, objects under syncRoot that have no matching input are planned for deletion.
+func (u Uploader) PlanSync(ctx context.Context, inputs []UploadInput, bucket stiface.BucketHandle, syncRoot,
+	compare string, deleteExtra bool) (SyncPlan, error) {
+	if syncRoot != "" && !strings.HasSuffix(syncRoot, "/") {
+		syncRoot += "/"
+	}
+
+	remote := map[string]*storage.ObjectAttrs{}
+	it := bucket.Objects(ctx, &storage.Query{Prefix: syncRoot})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return SyncPlan{}, fmt.Errorf("error listing objects with prefix %v: %w", syncRoot, err)
+		}
+		remote[attrs.Name] = attrs
+	}
+
+	plan := SyncPlan{}
+	for _, input := range inputs {
+		attrs, ok := remote[input.ObjectName]
+		delete(remote, input.ObjectName)
+		if !ok {
+			plan.Upload = append(plan.Upload, input)
+			continue
+		}
+
+		unchanged, err := u.forInput(input).isUnchanged(input.FilePath, attrs, compare)
+		if err != nil {
+			return SyncPlan{}, err
+		}
+		if unchanged {
+			plan.Skip = append(plan.Skip, input)
+		} else {
+			plan.Upload = append(plan.Upload, input)
+		}
+	}
+
+	if deleteExtra {
+		for name, attrs := range remote {
+			// folder placeholder objects never have a local file
+			if strings.HasSuffix(name, "/") {
+				continue
+			}
+			plan.Delete = append(plan.Delete, transfer.DeleteInput{ObjectName: name, Generation: attrs.Generation})
+		}
+		sort.Slice(plan.Delete, func(i, j int) bool { return plan.Delete[i].ObjectName < plan.Delete[j].ObjectName })
+	}
+
+	return plan, nil
+}
+
+// isUnchanged reports whether the local file matches the existing object.
+func (u Uploader) isUnchanged(filePath string, attrs *storage.ObjectAttrs, compare string) (bool, error) {
+	switch compare {
+	case SyncCompareMtime:
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return false, fmt.Errorf("os.Stat: %w", err)
+		}
+		if attrs.Metadata[MtimeMetadataKey] != strconv.FormatInt(info.ModTime().Unix(), 10) {
+			return false, nil
+		}
+		// the object size is the compressed size when the file was gzipped
+		return u.shouldGzip(filePath) || attrs.Size == info.Size(), nil
+	case SyncCompareChecksum:
+		md5Sum, crc32c, err := u.localChecksums(filePath)
+		if err != nil {
+			return false, err
+		}
+		if len(attrs.MD5) > 0 {
+			return bytes.Equal(attrs.MD5, md5Sum), nil
+		}
+		return attrs.CRC32C == crc32c, nil
+	default:
+		return false, fmt.Errorf("unknown sync comparison: %v", compare)
+	}
+}
+
+// localChecksums computes the MD5 and CRC32C of the bytes that uploadFile would write for the
+// file. The gzip output is deterministic, so a gzipped file hashes the same way on every run.
+func (u Uploader) localChecksums(filePath string) ([]byte, uint32, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	md5Hash := md5.New() //nolint:gosec // see import
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	w := io.MultiWriter(md5Hash, crcHash)
+
+	if u.shouldGzip(filePath) {
+		gw := gzip.NewWriter(w)
+		if _, err := io.Copy(gw, f); err != nil {
+			return nil, 0, fmt.Errorf("io.Copy: %w", err)
+		}
+		if err := gw.Close(); err != nil {
+			return nil, 0, fmt.Errorf("gzip.Writer.Close: %w", err)
+		}
+	} else if _, err := io.Copy(w, f); err != nil {
+		return nil, 0, fmt.Errorf("io.Copy: %w", err)
+	}
+
+	return md5Hash.Sum(nil), crcHash.Sum32(), nil
+}
+
+// DeleteObjects deletes the objects from the bucket concurrently up to the Uploader.Concurrency
+// limit, returning a result for each object. An object overwritten since it was listed is not deleted.
+func (u Uploader) DeleteObjects(inputs []transfer.DeleteInput, bucket stiface.BucketHandle) []transfer.Results {
+	return transfer.DeleteObjects(inputs, bucket, u.Concurrency, u.Retry)
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+const testBucket = "test-bucket"
+
+// setupSync creates a local folder with unchanged.txt, changed.txt and new.txt, uploads
+// unchanged.txt and changed.txt under the sync/ prefix with the provided Uploader, then
+// modifies changed.txt and adds an extra object that has no local file.
+func setupSync(t *testing.T, u Uploader) (stiface.BucketHandle, []UploadInput) {
+	t.Helper()
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "sync/extra.txt"},
+			Content:     []byte("extra"),
+		},
+	})
+	t.Cleanup(server.Stop)
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+
+	tempDir := t.TempDir()
+	var inputs []UploadInput
+	for _, name := range []string{"changed.txt", "new.txt", "unchanged.txt"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte("original data for "+name), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+		inputs = append(inputs, UploadInput{FilePath: path, ObjectName: "sync/" + name})
+	}
+
+	for _, result := range u.UploadObjects([]UploadInput{inputs[0], inputs[2]}, bucket) {
+		if !result.Success {
+			t.Fatalf("failed to seed object %v: %v", result.ObjectName, result.Message)
+		}
+	}
+	if err := os.WriteFile(inputs[0].FilePath, []byte("modified data"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+
+	return bucket, inputs
+}
+
+func TestPlanSync_Success(t *testing.T) {
+	tests := []struct {
+		name        string
+		uploader    Uploader
+		compare     string
+		deleteExtra bool
+		wantDelete  []transfer.DeleteInput
+	}{
+		{
+			name:     "Checksum",
+			uploader: Uploader{Concurrency: 1},
+			compare:  SyncCompareChecksum,
+		},
+		{
+			name:     "ChecksumGzip",
+			uploader: Uploader{Concurrency: 1, Gzip: true},
+			compare:  SyncCompareChecksum,
+		},
+		{
+			name:     "Mtime",
+			uploader: Uploader{Concurrency: 1, PreserveMtime: true},
+			compare:  SyncCompareMtime,
+		},
+		{
+			name:        "DeleteExtra",
+			uploader:    Uploader{Concurrency: 1},
+			compare:     SyncCompareChecksum,
+			deleteExtra: true,
+			wantDelete:  []transfer.DeleteInput{{ObjectName: "sync/extra.txt"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bucket, inputs := setupSync(t, test.uploader)
+			if test.compare == SyncCompareMtime {
+				// make the modification detectable at a one second resolution
+				info, _ := os.Stat(inputs[2].FilePath)
+				later := info.ModTime().Add(2 * time.Second)
+				if err := os.Chtimes(inputs[0].FilePath, later, later); err != nil {
+					t.Fatalf("os.Chtimes() = %v", err)
+				}
+			}
+
+			want := SyncPlan{
+				Upload: []UploadInput{inputs[0], inputs[1]},
+				Skip:   []UploadInput{inputs[2]},
+				Delete: test.wantDelete,
+			}
+			got, err := test.uploader.PlanSync(context.Background(), inputs, bucket, "sync", test.compare, test.deleteExtra)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(transfer.DeleteInput{}, "Generation")); diff != "" {
+				t.Errorf("PlanSync() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeleteObjects_Success(t *testing.T) {
+	bucket, _ := setupSync(t, Uploader{Concurrency: 1})
+	u := Uploader{Concurrency: 2}
+
+	want := []transfer.Results{
+		{ObjectName: "sync/extra.txt", Success: true},
+		{ObjectName: "sync/missing.txt", Message: "ObjectHandle.Delete: storage: object doesn't exist"},
+	}
+	got := u.DeleteObjects([]transfer.DeleteInput{{ObjectName: "sync/extra.txt"}, {ObjectName: "sync/missing.txt"}}, bucket)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DeleteObjects() diff (-want +got):\n%s", diff)
+	}
+}
@@ -20,9 +20,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
 )
 
@@ -31,112 +34,273 @@ type Uploader struct {
 	Concurrency int
 	ACL         string
 	Headers     map[string]string
+	// Rules set the Options of the inputs whose object name matches, see Rules.Apply.
+	Rules *Rules
+	// StorageClass of the uploaded objects, defaults to the bucket default storage class.
+	StorageClass string
+	// KMSKeyName is the Cloud KMS key used to encrypt the objects (CMEK), in the format
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*.
+	KMSKeyName string
+	// EncryptionKey is a customer-supplied AES-256 key used to encrypt the objects (CSEK).
+	EncryptionKey []byte
+	// EventBasedHold and TemporaryHold place the respective hold on the objects.
+	EventBasedHold bool
+	TemporaryHold  bool
+	// RetainUntil, when set, retains the objects until the given time with the RetentionMode,
+	// which defaults to RetentionModeUnlocked. The bucket must have object retention enabled.
+	RetainUntil   time.Time
+	RetentionMode string
+	// NoClobber only uploads files whose object does not exist yet.
+	NoClobber bool
+	// IfGenerationMatch, when set, only uploads a file if its object has this generation. A
+	// generation of 0 is the same as NoClobber.
+	IfGenerationMatch *int64
+	// SkipIdentical counts a file rejected by NoClobber or IfGenerationMatch as a success when the
+	// existing object has the same hash as the file.
+	SkipIdentical bool
+	// GzipExtensions limits gzipping to the files with one of these extensions, such as "html".
+	// When empty, Gzip applies to every file. Gzipped files are always stored compressed: unlike
+	// 'gsutil cp -j', there is no transport-only compression, which the storage client lacks.
+	GzipExtensions []string
+	// DetectContentType sets the content-type of each object from the file extension, or from
+	// the file content if the extension is unknown, unless a content-type header is provided.
+	DetectContentType bool
+	// Retry bounds each upload attempt, and sets how many times it is retried after a retryable
+	// error.
+	transfer.Retry
+	// ChunkSize is the size of each chunk of a resumable upload. A failed chunk is retried
+	// without restarting the upload. Defaults to the client default of 16MiB.
+	ChunkSize int
+	// CompositeThreshold is the file size at or above which a file is split into parts that are
+	// uploaded in parallel and composed into the object. Disabled when 0 or when gzipping.
+	CompositeThreshold int64
+	// CompositeParts is the number of parts of a parallel composite upload, defaults to
+	// MaxComposeComponents.
+	CompositeParts int
+	// RecordDigests computes the sha256 digest of each uploaded file into transfer.Results.Digest.
+	RecordDigests bool
+	// Signer generates a signed URL for each uploaded object into transfer.Results.SignedURL.
+	Signer *Signer
+	// Progress counts the uploaded files and bytes as they are written, when set.
+	Progress *Progress
+	// PreserveMtime records the local modification time of each file in the object metadata
+	// under MtimeMetadataKey, so that later syncs can compare by modification time.
+	PreserveMtime bool
+
+	// writers limits the object writers open at once, across the files and the parts of their
+	// parallel composite uploads, to Concurrency. Each writer buffers up to ChunkSize.
+	writers chan struct{}
 }
 
 type UploadInput struct {
 	FilePath   string
 	ObjectName string
-}
-
-type UploadResults struct {
-	FilePath   string `json:"file_path"`
-	ObjectName string `json:"object_name"`
-	Success    bool   `json:"success"`
-	Message    string `json:"message,omitempty"`
+	// Options overrides the Uploader settings for this input, such as from matching header rules.
+	Options *ObjectOptions
 }
 
 // UploadObjects will upload each UploadInput into the provided bucket. It will perform the uploads
-// concurrently up to the Uploader.Concurrency limit. Results are accumulated into a UploadResults
+// concurrently up to the Uploader.Concurrency limit. Results are accumulated into a transfer.Results
 // array and returned when everything completes. It's possible that individual uploads can have an
-// error, and the caller can check UploadResults.Success and UploadResults.Message for status and
+// error, and the caller can check transfer.Results.Success and transfer.Results.Message for status and
 // any error message
-func (u Uploader) UploadObjects(inputs []UploadInput, bucket stiface.BucketHandle) []UploadResults {
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, u.Concurrency)
-	results := make([]UploadResults, len(inputs))
+func (u Uploader) UploadObjects(inputs []UploadInput, bucket stiface.BucketHandle) []transfer.Results {
+	for _, input := range inputs {
+		u.Progress.AddFile(input.FilePath)
+	}
 
-	for i, input := range inputs {
-		semaphore <- struct{}{}
-		wg.Add(1)
+	u = u.withWriterLimit()
+	results := make([]transfer.Results, len(inputs))
+	transfer.ForEachConcurrently(len(inputs), u.Concurrency, func(i int) {
+		results[i] = u.uploadFile(inputs[i], bucket)
+	})
+	return results
+}
 
-		go func(i int, input UploadInput, bucket stiface.BucketHandle) {
+// UploadStream will upload each UploadInput received from inputs into the provided bucket, running
+// up to Uploader.Concurrency uploads at once. The result of each upload is sent on the returned
+// channel as soon as it completes, so results are in completion order rather than input order.
+// The returned channel is closed once inputs is closed and all of its uploads have completed.
+// The files are not added to the totals of the Progress, as the caller knows them first.
+func (u Uploader) UploadStream(inputs <-chan UploadInput, bucket stiface.BucketHandle) <-chan transfer.Results {
+	u = u.withWriterLimit()
+	results := make(chan transfer.Results, u.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < max(u.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
 			defer wg.Done()
-			defer func() { <-semaphore }()
-			results[i] = u.uploadFile(input, bucket)
-		}(i, input, bucket)
+			for input := range inputs {
+				results <- u.uploadFile(input, bucket)
+			}
+		}()
 	}
 
-	wg.Wait()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 	return results
 }
 
-const Timeout = 50
+// withWriterLimit returns the Uploader with a limit of Concurrency object writers open at once.
+func (u Uploader) withWriterLimit() Uploader {
+	u.writers = make(chan struct{}, max(u.Concurrency, 1))
+	return u
+}
+
+// acquireWriter waits until an object writer may be opened within the limit of the Uploader, and
+// returns the func that releases it.
+func (u Uploader) acquireWriter() (release func()) {
+	if u.writers == nil {
+		return func() {}
+	}
+	u.writers <- struct{}{}
+	return func() { <-u.writers }
+}
+
 const GzipContentEncoding = "gzip"
 
 // uploadFile will upload the file from the UploadInput into the provided bucket.
 // The ObjectName from within the UploadInput will be used as the ObjectName
 // Headers, PredefinedACL and whether to gzip the file or not are all pulled
-// from the Uploader struct
-func (u Uploader) uploadFile(input UploadInput, bucket stiface.BucketHandle) UploadResults {
-	result := UploadResults{FilePath: input.FilePath}
-	ctx := context.Background()
+// from the Uploader struct, overridden by the Options of the UploadInput. Attempts that fail with a retryable error are retried
+// up to Uploader.Retries times with an exponential backoff.
+func (u Uploader) uploadFile(input UploadInput, bucket stiface.BucketHandle) (result transfer.Results) {
+	start := time.Now()
+	var size int64
+	defer func() { u.Progress.fileDone(result, size, start) }()
+
+	result = transfer.Results{FilePath: input.FilePath, ObjectName: input.ObjectName}
+	u = u.forInput(input)
+
+	info, err := os.Stat(input.FilePath)
+	if err != nil {
+		result.Message = fmt.Sprintf("os.Stat: %v", err)
+		return result
+	}
+	size = info.Size()
+
+	var attrs *storage.ObjectAttrs
+	var digest string
+	if u.useComposite(input.FilePath, info.Size()) {
+		attrs, digest, err = u.uploadComposite(input, bucket, info)
+	} else {
+		err = u.WithRetries(func() error {
+			var err error
+			attrs, digest, err = u.uploadAttempt(input, bucket)
+			return err
+		})
+	}
+
+	if isPreconditionFailed(err) {
+		return u.preconditionResult(input, bucket, result)
+	}
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Success = true
+	result.Digest = digest
+	return u.recordObject(result, attrs)
+}
+
+// uploadAttempt makes a single attempt at uploading the file from the UploadInput,
+// bounded by the Uploader timeout. The digest of the file is computed as it is uploaded when
+// RecordDigests is set.
+func (u Uploader) uploadAttempt(input UploadInput, bucket stiface.BucketHandle) (_ *storage.ObjectAttrs, _ string, err error) {
+	defer u.acquireWriter()()
 
 	// open local file.
 	f, err := os.Open(input.FilePath)
 	if err != nil {
-		result.Message = fmt.Sprintf("os.Open: %v", err)
-		return result
+		return nil, "", fmt.Errorf("os.Open: %w", err)
 	}
 	defer f.Close()
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*Timeout)
+	// count the bytes read from the file as they are copied to the object
+	counter := u.Progress.counter()
+	defer func() { counter.rollback(err) }()
+	src := io.TeeReader(f, counter)
+	digest := u.newDigest()
+	if digest != nil {
+		src = io.TeeReader(src, digest)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.AttemptTimeout())
 	defer cancel()
 
-	o := bucket.Object(input.ObjectName)
-	result.ObjectName = input.ObjectName
+	o := u.destination(bucket, input.ObjectName)
 
 	// upload an object with storage.Writer.
 	wc := o.NewWriter(ctx)
+	if u.ChunkSize > 0 {
+		wc.SetChunkSize(u.ChunkSize)
+	}
 
 	// apply all provided headers and acl to the object
-	applyHeaders(wc, u.Headers)
-	applyPredefinedACL(wc, u.ACL)
+	applyHeaders(wc.ObjectAttrs(), u.Headers)
+	applyPredefinedACL(wc.ObjectAttrs(), u.ACL)
+	applyStorageClass(wc.ObjectAttrs(), u.StorageClass)
+	u.applyProtection(wc.ObjectAttrs())
+	if err := u.applyContentType(wc.ObjectAttrs(), input.FilePath); err != nil {
+		return nil, "", err
+	}
+
+	if u.PreserveMtime {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, "", fmt.Errorf("File.Stat: %w", err)
+		}
+		applyMtime(wc.ObjectAttrs(), info)
+	}
 
-	if u.Gzip {
+	if u.shouldGzip(input.FilePath) {
 		gw := gzip.NewWriter(wc)
 		// override any provided content-encoding header to be gzip
 		wc.ObjectAttrs().ContentEncoding = GzipContentEncoding
 
-		if _, err := io.Copy(gw, f); err != nil {
-			result.Message = fmt.Sprintf("io.Copy: %v", err)
-			return result
+		if _, err := io.Copy(gw, src); err != nil {
+			return nil, "", fmt.Errorf("io.Copy: %w", err)
 		}
 
 		if err := gw.Close(); err != nil {
-			result.Message = fmt.Sprintf("gzip.Writer.Close: %v", err)
-			return result
+			return nil, "", fmt.Errorf("gzip.Writer.Close: %w", err)
 		}
 	} else {
-		if _, err := io.Copy(wc, f); err != nil {
-			result.Message = fmt.Sprintf("io.Copy: %v", err)
-			return result
+		if _, err := io.Copy(wc, src); err != nil {
+			return nil, "", fmt.Errorf("io.Copy: %w", err)
 		}
 	}
 
 	if err := wc.Close(); err != nil {
-		result.Message = fmt.Sprintf("Writer.Close: %v", err)
-		return result
+		return nil, "", fmt.Errorf("Writer.Close: %w", err)
 	}
-	result.Success = true
-	return result
+	return wc.Attrs(), encodeDigest(digest), nil
+}
+
+func applyStorageClass(attrs *storage.ObjectAttrs, storageClass string) {
+	if storageClass == "" {
+		return
+	}
+
+	attrs.StorageClass = storageClass
 }
 
-func applyPredefinedACL(wc stiface.Writer, acl string) {
+func applyPredefinedACL(attrs *storage.ObjectAttrs, acl string) {
 	if acl == "" {
 		return
 	}
 
-	wc.ObjectAttrs().PredefinedACL = acl
+	attrs.PredefinedACL = acl
+}
+
+// applyMtime records the modification time of the file in the object metadata.
+func applyMtime(attrs *storage.ObjectAttrs, info os.FileInfo) {
+	if attrs.Metadata == nil {
+		attrs.Metadata = make(map[string]string)
+	}
+	attrs.Metadata[MtimeMetadataKey] = strconv.FormatInt(info.ModTime().Unix(), 10)
 }
 
 var knownHeaders = map[string]bool{
@@ -152,30 +316,30 @@ func GetKnownHeaders() map[string]bool {
 	return knownHeaders
 }
 
-func applyHeaders(wc stiface.Writer, headers map[string]string) {
+func applyHeaders(attrs *storage.ObjectAttrs, headers map[string]string) {
 	// initialize map if it is nil
-	if wc.ObjectAttrs().Metadata == nil {
-		wc.ObjectAttrs().Metadata = make(map[string]string)
+	if attrs.Metadata == nil {
+		attrs.Metadata = make(map[string]string)
 	}
 
 	if contentType, ok := headers["content-type"]; ok {
-		wc.ObjectAttrs().ContentType = contentType
+		attrs.ContentType = contentType
 	}
 	if cacheControl, ok := headers["cache-control"]; ok {
-		wc.ObjectAttrs().CacheControl = cacheControl
+		attrs.CacheControl = cacheControl
 	}
 	if contentDisposition, ok := headers["content-disposition"]; ok {
-		wc.ObjectAttrs().ContentDisposition = contentDisposition
+		attrs.ContentDisposition = contentDisposition
 	}
 	if contentEncoding, ok := headers["content-encoding"]; ok {
-		wc.ObjectAttrs().ContentEncoding = contentEncoding
+		attrs.ContentEncoding = contentEncoding
 	}
 	if contentLanguage, ok := headers["content-language"]; ok {
-		wc.ObjectAttrs().ContentLanguage = contentLanguage
+		attrs.ContentLanguage = contentLanguage
 	}
 	if customTime, ok := headers["custom-time"]; ok {
 		t, _ := time.Parse(time.RFC3339, customTime)
-		wc.ObjectAttrs().CustomTime = t
+		attrs.CustomTime = t
 	}
 
 	// iterate over all the headers, skipping known headers and applying all metadata headers
@@ -184,6 +348,6 @@ func applyHeaders(wc stiface.Writer, headers map[string]string) {
 			continue
 		}
 
-		wc.ObjectAttrs().Metadata[key] = value
+		attrs.Metadata[key] = value
 	}
 }
@@ -25,8 +25,10 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
 	"github.com/google/go-cmp/cmp"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/googleapi"
 )
 
 type bucketMock struct {
@@ -67,6 +69,11 @@ func (m mockWriter) ObjectAttrs() *storage.ObjectAttrs {
 	return m.attrs
 }
 
+// Attrs returns nil as the mock does not create objects, leaving the results without a generation.
+func (m mockWriter) Attrs() *storage.ObjectAttrs {
+	return nil
+}
+
 func setup(t *testing.T) (*Uploader, *storage.ObjectAttrs, *bucketMock, *mockWriter, []UploadInput) {
 	t.Helper()
 
@@ -116,7 +123,7 @@ func TestGetKnownHeaders_Success(t *testing.T) {
 func TestUploadObjects_Success(t *testing.T) {
 	c, _, b, _, ui := setup(t)
 
-	want := []UploadResults{
+	want := []transfer.Results{
 		{
 			FilePath:   ui[0].FilePath,
 			ObjectName: ui[0].ObjectName,
@@ -155,7 +162,7 @@ func TestUploadObjects_Headers_Success(t *testing.T) {
 	u, a, b, _, ui := setup(t)
 	u.Headers = headers
 
-	want := []UploadResults{
+	want := []transfer.Results{
 		{
 			FilePath:   ui[0].FilePath,
 			ObjectName: ui[0].ObjectName,
@@ -215,7 +222,7 @@ func TestUploadObjects_PredefinedACL_Success(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			u, a, b, _, ui := setup(t)
 			u.ACL = test.name
-			want := []UploadResults{
+			want := []transfer.Results{
 				{
 					FilePath:   ui[0].FilePath,
 					ObjectName: ui[0].ObjectName,
@@ -239,7 +246,7 @@ func TestUploadObjects_PredefinedACL_Success(t *testing.T) {
 func TestUploadObjects_Gzip_Success(t *testing.T) {
 	u, a, b, w, ui := setup(t)
 	u.Gzip = true
-	want := []UploadResults{
+	want := []transfer.Results{
 		{
 			FilePath:   ui[0].FilePath,
 			ObjectName: ui[0].ObjectName,
@@ -278,7 +285,7 @@ func TestUploadObjects_GzipOverridesContentEncodingHeader_Success(t *testing.T)
 	u, a, b, w, ui := setup(t)
 	u.Gzip = true
 	u.Headers = map[string]string{"content-encoding": "myValue"}
-	want := []UploadResults{
+	want := []transfer.Results{
 		{
 			FilePath:   ui[0].FilePath,
 			ObjectName: ui[0].ObjectName,
@@ -312,3 +319,97 @@ func TestUploadObjects_GzipOverridesContentEncodingHeader_Success(t *testing.T)
 		t.Errorf("ContentDisposition doesn't match want: %v got: %v", GzipContentEncoding, a.ContentEncoding)
 	}
 }
+
+// flakyObjectMock returns a writer that fails to close with closeErr until failures attempts have been made.
+type flakyObjectMock struct {
+	stiface.ObjectHandle
+	attempts *int
+	failures int
+	closeErr error
+}
+
+type flakyWriter struct {
+	mockWriter
+	fail     bool
+	closeErr error
+}
+
+func (m flakyObjectMock) NewWriter(_ context.Context) stiface.Writer {
+	*m.attempts++
+	a := storage.ObjectAttrs{Metadata: map[string]string{}}
+	return &flakyWriter{mockWriter: mockWriter{attrs: &a}, fail: *m.attempts <= m.failures, closeErr: m.closeErr}
+}
+
+func (w *flakyWriter) Close() error {
+	if w.fail {
+		return w.closeErr
+	}
+	return nil
+}
+
+type flakyBucketMock struct {
+	stiface.BucketHandle
+	oMock flakyObjectMock
+}
+
+func (m flakyBucketMock) Object(_ string) stiface.ObjectHandle {
+	return m.oMock
+}
+
+func TestUploadObjects_Retries(t *testing.T) {
+	retryableErr := &googleapi.Error{Code: 503, Message: "backend unavailable"}
+	permanentErr := &googleapi.Error{Code: 403, Message: "forbidden"}
+
+	tests := []struct {
+		name             string
+		retries          int
+		failures         int
+		closeErr         error
+		expectedAttempts int
+		expectedSuccess  bool
+	}{
+		{
+			name:             "SucceedsAfterRetry",
+			retries:          3,
+			failures:         2,
+			closeErr:         retryableErr,
+			expectedAttempts: 3,
+			expectedSuccess:  true,
+		},
+		{
+			name:             "RetriesExhausted",
+			retries:          2,
+			failures:         5,
+			closeErr:         retryableErr,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "PermanentErrorNotRetried",
+			retries:          3,
+			failures:         1,
+			closeErr:         permanentErr,
+			expectedAttempts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, _, _, _, ui := setup(t)
+			u.Retries = test.retries
+			u.RetryBackoff = time.Millisecond
+
+			attempts := 0
+			b := flakyBucketMock{oMock: flakyObjectMock{attempts: &attempts, failures: test.failures, closeErr: test.closeErr}}
+
+			got := u.UploadObjects(ui, b)
+			if got[0].Success != test.expectedSuccess {
+				t.Errorf("UploadObjects() success = %v, want %v (message: %v)", got[0].Success, test.expectedSuccess, got[0].Message)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("UploadObjects() attempts = %d, want %d", attempts, test.expectedAttempts)
+			}
+			if !test.expectedSuccess && got[0].Message != "Writer.Close: "+test.closeErr.Error() {
+				t.Errorf("UploadObjects() message = %q, want %q", got[0].Message, "Writer.Close: "+test.closeErr.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package website deploys static websites to GCS. Every deploy is uploaded to its own version
+// prefix first, and the live site is only switched to it once all the files are uploaded, so
+// users are never served a mix of old and new assets.
+package website
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/upload"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// VersionsPrefixDefault is the prefix, relative to the live prefix, of the deployed versions.
+	VersionsPrefixDefault = "_versions"
+	// VersionFormat is the layout of the default version names, which sort by deploy time.
+	VersionFormat = "20060102T150405Z"
+	// PointerCacheControl keeps the pointer object from being cached, so the switch is seen at once.
+	PointerCacheControl = "no-cache, max-age=0"
+)
+
+// Deployer deploys a local folder as a new version of a website in a bucket.
+type Deployer struct {
+	// Uploader uploads the files of each version and copies them to the live prefix.
+	Uploader upload.Uploader
+	// UseIgnoreList skips the files ignored by the .gcloudignore file of the folder, or by the
+	// gcloud default rules when there is none.
+	UseIgnoreList bool
+
+	// Prefix is the live prefix the site is served from, empty for the root of the bucket.
+	Prefix string
+	// AllowBucketRoot allows copying the version to the root of the bucket when Prefix is empty.
+	// Every object of the bucket that is not part of the version is then deleted, except for the
+	// versions and the temporary objects of parallel composite uploads.
+	AllowBucketRoot bool
+	// VersionsPrefix holds a folder per deployed version, relative to Prefix so that the sites of a
+	// bucket keep and prune their own versions. Defaults to VersionsPrefixDefault.
+	VersionsPrefix string
+	// PointerObject, when set, switches the live version by writing the prefix of the version into
+	// this object, for a front end that reads it, instead of copying the version to the live prefix.
+	PointerObject string
+
+	// MainPageSuffix and NotFoundPage update the website configuration of the bucket when set.
+	MainPageSuffix string
+	NotFoundPage   string
+
+	// KeepVersions is the number of versions kept, including the deployed one. Older versions are
+	// deleted after the switch. Every version is kept when 0.
+	KeepVersions int
+}
+
+// DeployResults holds the results of every step of a deploy.
+type DeployResults struct {
+	Version string `json:"version"`
+	// Uploads of the files into the version prefix.
+	Uploads []transfer.Results `json:"uploads"`
+	// Copies of the version into the live prefix, and Deletes of the live objects that are not
+	// part of the version.
+	Copies  []transfer.Results `json:"copies,omitempty"`
+	Deletes []transfer.Results `json:"deletes,omitempty"`
+	// Pruned holds the deletes of the objects of the versions beyond KeepVersions.
+	Pruned         []transfer.Results `json:"pruned,omitempty"`
+	PrunedVersions []string           `json:"pruned_versions,omitempty"`
+}
+
+// NewVersion returns a version name for a deploy at t, which sorts by deploy time.
+func NewVersion(t time.Time) string {
+	return t.UTC().Format(VersionFormat)
+}
+
+// versionsPrefix returns the prefix, from the root of the bucket, of the versions of the site.
+func (d Deployer) versionsPrefix() string {
+	versionsPrefix := strings.Trim(d.VersionsPrefix, "/")
+	if versionsPrefix == "" {
+		versionsPrefix = VersionsPrefixDefault
+	}
+	return path.Join(strings.Trim(d.Prefix, "/"), versionsPrefix)
+}
+
+// VersionPrefix returns the prefix the files of the version are uploaded to.
+func (d Deployer) VersionPrefix(version string) string {
+	return path.Join(d.versionsPrefix(), version)
+}
+
+// Deploy uploads the folder into the prefix of the version, switches the live site to it, updates
+// the website configuration and prunes the old versions. The live site is left unchanged if any
+// file fails to upload.
+func (d Deployer) Deploy(ctx context.Context, bucket stiface.BucketHandle, folder, version string) (DeployResults, error) {
+	results := DeployResults{Version: version}
+	if version == "" || strings.Contains(version, "/") {
+		return results, fmt.Errorf("invalid version %q, must be a non empty name without '/'", version)
+	}
+	if d.PointerObject == "" && strings.Trim(d.Prefix, "/") == "" && !d.AllowBucketRoot {
+		return results, fmt.Errorf("copying the site to the root of the bucket deletes every other object of the " +
+			"bucket, set a live prefix or a pointer object, or allow the bucket root explicitly")
+	}
+	versionPrefix := d.VersionPrefix(version)
+
+	inputs, err := upload.ProcessPath(folder, versionPrefix, "", d.UseIgnoreList, false)
+	if err != nil {
+		return results, err
+	}
+	d.Uploader.Rules.Apply(inputs, versionPrefix)
+	results.Uploads = d.Uploader.UploadObjects(inputs, bucket)
+	if failed := countFailures(results.Uploads); failed > 0 {
+		return results, fmt.Errorf("%d of %d files failed to upload to %v, the live site was not changed", failed,
+			len(results.Uploads), versionPrefix)
+	}
+
+	if d.PointerObject != "" {
+		err = d.writePointer(ctx, bucket, versionPrefix)
+	} else {
+		results.Copies, results.Deletes, err = d.copyToLive(ctx, bucket, versionPrefix, results.Uploads)
+	}
+	if err != nil {
+		return results, err
+	}
+	fmt.Printf("Switched the live site to version %v\n", version)
+
+	if err := d.updateWebsite(ctx, bucket); err != nil {
+		return results, err
+	}
+
+	results.PrunedVersions, results.Pruned, err = d.prune(ctx, bucket, version)
+	return results, err
+}
+
+// writePointer atomically switches the live version by writing its prefix into the pointer object.
+func (d Deployer) writePointer(ctx context.Context, bucket stiface.BucketHandle, versionPrefix string) error {
+	w := bucket.Object(d.PointerObject).NewWriter(ctx)
+	w.ObjectAttrs().ContentType = "text/plain"
+	w.ObjectAttrs().CacheControl = PointerCacheControl
+	if _, err := w.Write([]byte(versionPrefix)); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing pointer object %v: %w", d.PointerObject, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing pointer object %v: %w", d.PointerObject, err)
+	}
+	return nil
+}
+
+// copyToLive copies the uploaded objects of the version into the live prefix, then deletes the
+// live objects that are not part of the version. The pages are copied after the other assets, so
+// that a new page never references an asset that is not live yet. Only the objects of this deploy
+// are copied, so that the leftovers of an earlier deploy of the same version never go live.
+func (d Deployer) copyToLive(ctx context.Context, bucket stiface.BucketHandle, versionPrefix string,
+	uploads []transfer.Results) (copies, deletes []transfer.Results, err error) {
+	live, err := d.liveObjects(ctx, bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var assets, pages []upload.CopyInput
+	current := map[string]bool{}
+	for _, uploaded := range uploads {
+		name := uploaded.ObjectName
+		target := path.Join(d.Prefix, strings.TrimPrefix(name, versionPrefix+"/"))
+		current[target] = true
+		input := upload.CopyInput{SourceName: name, ObjectName: target}
+		if isPage(name) {
+			pages = append(pages, input)
+		} else {
+			assets = append(assets, input)
+		}
+	}
+
+	copies = d.Uploader.CopyObjects(assets, bucket)
+	if failed := countFailures(copies); failed == 0 {
+		copies = append(copies, d.Uploader.CopyObjects(pages, bucket)...)
+	}
+	if failed := countFailures(copies); failed > 0 {
+		return copies, nil, fmt.Errorf("%d objects failed to be copied to the live site, it may be partially updated",
+			failed)
+	}
+
+	var stale []transfer.DeleteInput
+	for _, object := range live {
+		if !current[object.ObjectName] {
+			stale = append(stale, object)
+		}
+	}
+	deletes = d.Uploader.DeleteObjects(stale, bucket)
+	if failed := countFailures(deletes); failed > 0 {
+		return copies, deletes, fmt.Errorf("%d stale objects failed to be deleted from the live site", failed)
+	}
+	return copies, deletes, nil
+}
+
+// liveObjects lists the objects of the live site, without the versions that may live under it and
+// the temporary objects of the parallel composite uploads in progress.
+func (d Deployer) liveObjects(ctx context.Context, bucket stiface.BucketHandle) ([]transfer.DeleteInput, error) {
+	prefix := d.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	objects, err := listObjects(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var live []transfer.DeleteInput
+	for _, object := range objects {
+		name := object.ObjectName
+		if !strings.HasPrefix(name, d.versionsPrefix()+"/") && !strings.HasPrefix(name, upload.CompositeTmpPrefix) {
+			live = append(live, object)
+		}
+	}
+	return live, nil
+}
+
+// updateWebsite sets the main page suffix and not found page of the bucket, keeping the current
+// value of the ones that are not set.
+func (d Deployer) updateWebsite(ctx context.Context, bucket stiface.BucketHandle) error {
+	if d.MainPageSuffix == "" && d.NotFoundPage == "" {
+		return nil
+	}
+
+	attrs, err := bucket.Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the bucket website configuration: %w", err)
+	}
+	website := storage.BucketWebsite{}
+	if attrs.Website != nil {
+		website = *attrs.Website
+	}
+	if d.MainPageSuffix != "" {
+		website.MainPageSuffix = d.MainPageSuffix
+	}
+	if d.NotFoundPage != "" {
+		website.NotFoundPage = d.NotFoundPage
+	}
+
+	if _, err := bucket.Update(ctx, storage.BucketAttrsToUpdate{Website: &website}); err != nil {
+		return fmt.Errorf("error updating the bucket website configuration: %w", err)
+	}
+	return nil
+}
+
+// deployedVersion is a version of the site and the objects it is made of.
+type deployedVersion struct {
+	name    string
+	objects []transfer.DeleteInput
+	created time.Time
+}
+
+// prune deletes the objects of the versions beyond KeepVersions. The versions are ordered by the
+// creation time of their latest object, and the deployed version is always kept.
+func (d Deployer) prune(ctx context.Context, bucket stiface.BucketHandle,
+	deployed string) ([]string, []transfer.Results, error) {
+	if d.KeepVersions <= 0 {
+		return nil, nil, nil
+	}
+
+	versions := map[string]*deployedVersion{}
+	root := d.versionsPrefix() + "/"
+	it := bucket.Objects(ctx, &storage.Query{Prefix: root})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error listing versions under %v: %w", root, err)
+		}
+
+		name, _, ok := strings.Cut(strings.TrimPrefix(attrs.Name, root), "/")
+		if !ok {
+			continue
+		}
+		v := versions[name]
+		if v == nil {
+			v = &deployedVersion{name: name}
+			versions[name] = v
+		}
+		v.objects = append(v.objects, transfer.DeleteInput{ObjectName: attrs.Name, Generation: attrs.Generation})
+		if attrs.Created.After(v.created) {
+			v.created = attrs.Created
+		}
+	}
+
+	var ordered []*deployedVersion
+	for _, v := range versions {
+		if v.name != deployed {
+			ordered = append(ordered, v)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].created.Equal(ordered[j].created) {
+			return ordered[i].created.After(ordered[j].created)
+		}
+		return ordered[i].name > ordered[j].name
+	})
+	if len(ordered) < d.KeepVersions {
+		return nil, nil, nil
+	}
+
+	var pruned []string
+	var objects []transfer.DeleteInput
+	for _, v := range ordered[d.KeepVersions-1:] {
+		pruned = append(pruned, v.name)
+		objects = append(objects, v.objects...)
+	}
+	fmt.Printf("Pruning %d old versions: %v\n", len(pruned), strings.Join(pruned, ", "))
+	results := d.Uploader.DeleteObjects(objects, bucket)
+	if failed := countFailures(results); failed > 0 {
+		return pruned, results, fmt.Errorf("%d objects of old versions failed to be deleted", failed)
+	}
+	return pruned, results, nil
+}
+
+// listObjects returns the names and generations of the objects under the prefix, without folder
+// placeholders.
+func listObjects(ctx context.Context, bucket stiface.BucketHandle, prefix string) ([]transfer.DeleteInput, error) {
+	var objects []transfer.DeleteInput
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects with prefix %v: %w", prefix, err)
+		}
+		if !strings.HasSuffix(attrs.Name, "/") {
+			objects = append(objects, transfer.DeleteInput{ObjectName: attrs.Name, Generation: attrs.Generation})
+		}
+	}
+}
+
+// isPage reports whether the object is a page that may reference other assets of the site.
+func isPage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		return true
+	default:
+		return false
+	}
+}
+
+func countFailures(results []transfer.Results) int {
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,327 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package website
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/upload"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+)
+
+const testBucket = "bucketName"
+
+// setup creates a server with the given objects and a local site with an index page and a
+// stylesheet.
+func setup(t *testing.T, objects map[string]string) (*fakestorage.Server, stiface.BucketHandle, string) {
+	t.Helper()
+
+	initial := []fakestorage.Object{
+		{ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: "other/file.txt"}, Content: []byte("other")},
+	}
+	for name, content := range objects {
+		initial = append(initial, fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: testBucket, Name: name},
+			Content:     []byte(content),
+		})
+	}
+	server := fakestorage.NewServer(initial)
+	t.Cleanup(server.Stop)
+
+	folder := t.TempDir()
+	files := map[string]string{"index.html": "new index", filepath.Join("css", "app.css"): "new css"}
+	for name, content := range files {
+		p := filepath.Join(folder, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatalf("os.MkdirAll() = %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+	}
+	return server, stiface.AdaptClient(server.Client()).Bucket(testBucket), folder
+}
+
+// bucketContents returns the content of every object of the bucket by name.
+func bucketContents(t *testing.T, server *fakestorage.Server) map[string]string {
+	t.Helper()
+
+	objects, _, err := server.ListObjectsWithOptions(testBucket, fakestorage.ListOptions{})
+	if err != nil {
+		t.Fatalf("server.ListObjectsWithOptions() = %v", err)
+	}
+	contents := map[string]string{}
+	for _, o := range objects {
+		obj, err := server.GetObject(testBucket, o.Name)
+		if err != nil {
+			t.Fatalf("server.GetObject(%v) = %v", o.Name, err)
+		}
+		contents[o.Name] = string(obj.Content)
+	}
+	return contents
+}
+
+func TestDeploy_Copy(t *testing.T) {
+	server, bucket, folder := setup(t, map[string]string{
+		"site/index.html": "old index",
+		"site/stale.css":  "old css",
+	})
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}, Prefix: "site"}
+	results, err := d.Deploy(context.Background(), bucket, folder, "v1")
+	if err != nil {
+		t.Fatalf("Deploy() = %v", err)
+	}
+
+	want := map[string]string{
+		"other/file.txt":                "other",
+		"site/_versions/v1/index.html":  "new index",
+		"site/_versions/v1/css/app.css": "new css",
+		"site/index.html":               "new index",
+		"site/css/app.css":              "new css",
+	}
+	if diff := cmp.Diff(want, bucketContents(t, server)); diff != "" {
+		t.Errorf("bucket diff (-want +got):\n%s", diff)
+	}
+
+	// the stylesheet is copied before the page that references it
+	var copied []string
+	for _, result := range results.Copies {
+		copied = append(copied, result.ObjectName)
+	}
+	if diff := cmp.Diff([]string{"site/css/app.css", "site/index.html"}, copied); diff != "" {
+		t.Errorf("copies diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploy_CopyToRoot(t *testing.T) {
+	server, bucket, folder := setup(t, map[string]string{
+		"index.html":                           "old index",
+		"_versions/v0/index.html":              "old index",
+		upload.CompositeTmpPrefix + "upload/0": "part",
+	})
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}, AllowBucketRoot: true}
+	if _, err := d.Deploy(context.Background(), bucket, folder, "v1"); err != nil {
+		t.Fatalf("Deploy() = %v", err)
+	}
+
+	// the versions and the parts of other uploads live under the root of the site but are not part of it
+	want := map[string]string{
+		upload.CompositeTmpPrefix + "upload/0": "part",
+		"_versions/v0/index.html":              "old index",
+		"_versions/v1/index.html":              "new index",
+		"_versions/v1/css/app.css":             "new css",
+		"index.html":                           "new index",
+		"css/app.css":                          "new css",
+	}
+	if diff := cmp.Diff(want, bucketContents(t, server)); diff != "" {
+		t.Errorf("bucket diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploy_CopyToRootNotAllowed(t *testing.T) {
+	server, bucket, folder := setup(t, map[string]string{"index.html": "old index"})
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}}
+	_, err := d.Deploy(context.Background(), bucket, folder, "v1")
+	want := "copying the site to the root of the bucket deletes every other object of the bucket, set a live " +
+		"prefix or a pointer object, or allow the bucket root explicitly"
+	if err == nil || err.Error() != want {
+		t.Fatalf("Deploy() = %v, want %v", err, want)
+	}
+
+	// nothing is uploaded, and the unrelated objects are kept
+	wantContents := map[string]string{"other/file.txt": "other", "index.html": "old index"}
+	if diff := cmp.Diff(wantContents, bucketContents(t, server)); diff != "" {
+		t.Errorf("bucket diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploy_Pointer(t *testing.T) {
+	server, bucket, folder := setup(t, map[string]string{"site/index.html": "old index"})
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}, Prefix: "site", PointerObject: "site/LIVE"}
+	if _, err := d.Deploy(context.Background(), bucket, folder, "v1"); err != nil {
+		t.Fatalf("Deploy() = %v", err)
+	}
+
+	want := map[string]string{
+		"other/file.txt":                "other",
+		"site/_versions/v1/index.html":  "new index",
+		"site/_versions/v1/css/app.css": "new css",
+		"site/index.html":               "old index",
+		"site/LIVE":                     "site/_versions/v1",
+	}
+	if diff := cmp.Diff(want, bucketContents(t, server)); diff != "" {
+		t.Errorf("bucket diff (-want +got):\n%s", diff)
+	}
+	attrs, err := bucket.Object("site/LIVE").Attrs(context.Background())
+	if err != nil {
+		t.Fatalf("ObjectHandle.Attrs() = %v", err)
+	}
+	if attrs.ContentType != "text/plain" {
+		t.Errorf("pointer content type = %v, want text/plain", attrs.ContentType)
+	}
+}
+
+func TestDeploy_UploadFailureKeepsLiveSite(t *testing.T) {
+	server, bucket, folder := setup(t, map[string]string{
+		"site/index.html":              "old index",
+		"site/_versions/v1/index.html": "conflicting index",
+	})
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2, NoClobber: true}, Prefix: "site"}
+	_, err := d.Deploy(context.Background(), bucket, folder, "v1")
+	want := "1 of 2 files failed to upload to site/_versions/v1, the live site was not changed"
+	if err == nil || err.Error() != want {
+		t.Fatalf("Deploy() = %v, want %v", err, want)
+	}
+
+	if got := bucketContents(t, server)["site/index.html"]; got != "old index" {
+		t.Errorf("live index = %v, want the old index", got)
+	}
+}
+
+func TestDeploy_Prune(t *testing.T) {
+	now := time.Now()
+	initial := []fakestorage.Object{}
+	for i, version := range []string{"a", "b", "c"} {
+		initial = append(initial, fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: testBucket,
+				Name:       "_versions/" + version + "/index.html",
+				Created:    now.Add(time.Duration(i-3) * time.Hour),
+			},
+			Content: []byte(version),
+		})
+	}
+	server := fakestorage.NewServer(initial)
+	t.Cleanup(server.Stop)
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+	_, _, folder := setup(t, nil)
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}, PointerObject: "LIVE", KeepVersions: 2}
+	results, err := d.Deploy(context.Background(), bucket, folder, "d")
+	if err != nil {
+		t.Fatalf("Deploy() = %v", err)
+	}
+	if diff := cmp.Diff([]string{"b", "a"}, results.PrunedVersions); diff != "" {
+		t.Errorf("pruned versions diff (-want +got):\n%s", diff)
+	}
+
+	var got []string
+	for name := range bucketContents(t, server) {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{"LIVE", "_versions/c/index.html", "_versions/d/css/app.css", "_versions/d/index.html"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("bucket objects diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploy_PruneKeepsOtherSites(t *testing.T) {
+	now := time.Now()
+	initial := []fakestorage.Object{}
+	for i, name := range []string{"a/_versions/a1/index.html", "a/_versions/a2/index.html",
+		"b/_versions/b1/index.html", "b/_versions/b2/index.html"} {
+		initial = append(initial, fakestorage.Object{
+			ObjectAttrs: fakestorage.ObjectAttrs{
+				BucketName: testBucket,
+				Name:       name,
+				Created:    now.Add(time.Duration(i-4) * time.Hour),
+			},
+			Content: []byte(name),
+		})
+	}
+	server := fakestorage.NewServer(initial)
+	t.Cleanup(server.Stop)
+	bucket := stiface.AdaptClient(server.Client()).Bucket(testBucket)
+	_, _, folder := setup(t, nil)
+
+	// the deploy of site b only prunes the versions of site b
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}, Prefix: "b", PointerObject: "b/LIVE", KeepVersions: 2}
+	results, err := d.Deploy(context.Background(), bucket, folder, "b3")
+	if err != nil {
+		t.Fatalf("Deploy() = %v", err)
+	}
+	if diff := cmp.Diff([]string{"b1"}, results.PrunedVersions); diff != "" {
+		t.Errorf("pruned versions diff (-want +got):\n%s", diff)
+	}
+
+	var got []string
+	for name := range bucketContents(t, server) {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{"a/_versions/a1/index.html", "a/_versions/a2/index.html", "b/LIVE",
+		"b/_versions/b2/index.html", "b/_versions/b3/css/app.css", "b/_versions/b3/index.html"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("bucket objects diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploy_InvalidVersion(t *testing.T) {
+	_, bucket, folder := setup(t, nil)
+
+	_, err := Deployer{}.Deploy(context.Background(), bucket, folder, "a/b")
+	want := `invalid version "a/b", must be a non empty name without '/'`
+	if err == nil || err.Error() != want {
+		t.Errorf("Deploy() = %v, want %v", err, want)
+	}
+}
+
+// websiteBucket records the website configuration updates, which the fake server does not support.
+type websiteBucket struct {
+	stiface.BucketHandle
+	website *storage.BucketWebsite
+	updated *storage.BucketWebsite
+}
+
+func (b *websiteBucket) Attrs(_ context.Context) (*storage.BucketAttrs, error) {
+	return &storage.BucketAttrs{Name: testBucket, Website: b.website}, nil
+}
+
+func (b *websiteBucket) Update(_ context.Context, uattrs storage.BucketAttrsToUpdate) (*storage.BucketAttrs, error) {
+	b.updated = uattrs.Website
+	return &storage.BucketAttrs{Name: testBucket, Website: uattrs.Website}, nil
+}
+
+func TestDeploy_Website(t *testing.T) {
+	_, bucket, folder := setup(t, nil)
+	b := &websiteBucket{
+		BucketHandle: bucket,
+		website:      &storage.BucketWebsite{MainPageSuffix: "home.html", NotFoundPage: "missing.html"},
+	}
+
+	d := Deployer{Uploader: upload.Uploader{Concurrency: 2}, PointerObject: "LIVE", MainPageSuffix: "index.html"}
+	if _, err := d.Deploy(context.Background(), b, folder, "v1"); err != nil {
+		t.Fatalf("Deploy() = %v", err)
+	}
+
+	want := &storage.BucketWebsite{MainPageSuffix: "index.html", NotFoundPage: "missing.html"}
+	if diff := cmp.Diff(want, b.updated); diff != "" {
+		t.Errorf("website diff (-want +got):\n%s", diff)
+	}
+}
@@ -23,7 +23,7 @@ import (
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "cloud-storage",
-	Short: "Utility for uploading files to Google Cloud Storage",
+	Short: "Utility for uploading and downloading files to and from Google Cloud Storage",
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -15,17 +15,25 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/upload"
+	"github.com/GoogleCloudBuild/cicd-images/internal/archive"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/inhies/go-bytesize"
 	"github.com/spf13/cobra"
 	"google.golang.org/api/option"
 )
@@ -43,6 +51,54 @@ var (
 	concurrency   int
 	includeParent bool
 	userAgent     string
+	syncMode      bool
+	syncCompare   string
+	deleteExtra   bool
+	dryRun        bool
+	retries       int
+	timeout       time.Duration
+	maxFailures   int
+	resultsFile   string
+
+	resultsPath     string
+	isBuildArtifact string
+)
+
+var (
+	chunkSize          = bytesize.ByteSize(ChunkSizeDefault)
+	compositeThreshold bytesize.ByteSize
+	compositeParts     int
+
+	gzipExtensions    string
+	detectContentType bool
+
+	headerRulesFile string
+	headerRules     *upload.Rules
+
+	storageClass      string
+	kmsKey            string
+	encryptionKeyFile string
+	encryptionKeyEnv  string
+	encryptionKey     []byte
+	eventBasedHold    bool
+	temporaryHold     bool
+	retentionDuration time.Duration
+	retentionMode     string
+
+	noClobber         bool
+	ifGenerationMatch int64
+	skipIdentical     bool
+
+	signedURLTTL          time.Duration
+	signingKeyFile        string
+	signingServiceAccount string
+
+	progressInterval time.Duration
+	progressFormat   string
+	verbose          bool
+
+	archiveFormat string
+	archiveName   string
 )
 
 // uploadCmd represents the upload command
@@ -62,7 +118,57 @@ var uploadCmd = &cobra.Command{
 		}
 
 		err = validatePredefinedACL(predefinedACL)
+		if err != nil {
+			return err
+		}
+
+		err = validateSyncFlags(syncMode, syncCompare, deleteExtra, glob)
+		if err != nil {
+			return err
+		}
+
+		err = validateStorageClass(storageClass)
+		if err != nil {
+			return err
+		}
+
+		err = validateEncryptionFlags(kmsKey, encryptionKeyFile, encryptionKeyEnv)
+		if err != nil {
+			return err
+		}
+
+		err = validateRetentionFlags(retentionDuration, retentionMode)
+		if err != nil {
+			return err
+		}
+
+		err = validatePreconditionFlags(noClobber, ifGenerationMatch, skipIdentical, syncMode, path)
+		if err != nil {
+			return err
+		}
+
+		err = validateSigningFlags(signedURLTTL, signingKeyFile, signingServiceAccount,
+			encryptionKeyFile != "" || encryptionKeyEnv != "")
+		if err != nil {
+			return err
+		}
+
+		err = validateProgressFlags(progressInterval, progressFormat)
+		if err != nil {
+			return err
+		}
+
+		err = validateArchiveFlags(archiveFormat, archiveName, syncMode, dryRun)
+		if err != nil {
+			return err
+		}
+
+		encryptionKey, err = upload.LoadEncryptionKey(encryptionKeyFile, encryptionKeyEnv)
+		if err != nil {
+			return err
+		}
 
+		headerRules, err = loadHeaderRules(headerRulesFile)
 		return err
 	},
 	RunE: func(_ *cobra.Command, _ []string) error {
@@ -71,49 +177,282 @@ var uploadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		results, err := Upload(stiface.AdaptClient(client), destination, path, glob, predefinedACL, useIgnoreList,
-			includeParent, useGzip, parsedHeaders, concurrency)
+		u := upload.Uploader{
+			Gzip:          useGzip,
+			Concurrency:   concurrency,
+			ACL:           predefinedACL,
+			Headers:       parsedHeaders,
+			PreserveMtime: syncMode,
+			Retry:         transfer.Retry{Retries: retries, Timeout: timeout},
+			ChunkSize:     int(chunkSize),
+
+			GzipExtensions:    upload.ParseExtensions(gzipExtensions),
+			DetectContentType: detectContentType,
+			Rules:             headerRules,
+
+			StorageClass:   storageClass,
+			KMSKeyName:     kmsKey,
+			EncryptionKey:  encryptionKey,
+			EventBasedHold: eventBasedHold,
+			TemporaryHold:  temporaryHold,
+			RetentionMode:  retentionMode,
+
+			NoClobber:     noClobber,
+			SkipIdentical: skipIdentical,
+
+			CompositeThreshold: int64(compositeThreshold),
+			CompositeParts:     compositeParts,
+		}
+		// the provenance needs the digest of every uploaded file
+		u.RecordDigests = resultsPath != ""
+		if retentionDuration > 0 {
+			u.RetainUntil = time.Now().Add(retentionDuration)
+		}
+		if ifGenerationMatch >= 0 {
+			u.IfGenerationMatch = &ifGenerationMatch
+		}
+		u.Signer, err = newSigner(ctx, destination, signedURLTTL, signingKeyFile, signingServiceAccount)
 		if err != nil {
 			return err
 		}
+		if archiveFormat != "" {
+			return uploadArchive(stiface.AdaptClient(client), u)
+		}
+		if !dryRun && (progressInterval > 0 || verbose) {
+			u.Progress = upload.NewProgress(os.Stdout, progressFormat == ProgressFormatJSON, verbose)
+		}
 
-		// print out a summary of successful/failed uploads and a unique list of errors encountered
-		successCount, failCount, uniqueErrors := summarizeResults(results)
-		fmt.Printf("Attempted upload of %d files\n", len(results))
-		fmt.Printf("Successful upload count: %d\n", successCount)
-		if failCount > 0 {
-			fmt.Printf("Failed upload count: %d\n", failCount)
-			fmt.Println("Unique errors encountered:")
-			for k := range uniqueErrors {
-				fmt.Println(k)
+		if syncMode {
+			stopProgress := u.Progress.Start(progressInterval)
+			results, deleteResults, err := Sync(ctx, stiface.AdaptClient(client), destination, path, glob,
+				useIgnoreList, includeParent, u, syncCompare, deleteExtra, dryRun)
+			stopProgress()
+			if err != nil || dryRun {
+				return err
+			}
+
+			if err := writeResultsFile(resultsFile, results); err != nil {
+				return err
+			}
+			if err := writeProvenanceFile(resultsPath, destination, isBuildArtifact, results); err != nil {
+				return err
 			}
+			for _, result := range results {
+				printSignedURL(result)
+			}
+			summary := summarize(results)
+			printSummary("upload", summary.total, summary.successCount, summary.failCount, summary.uniqueErrors)
+			printStatusSummary(summary.statusCounts)
+			if deleteExtra {
+				deleteSuccessCount, deleteFailCount, deleteErrors := summarizeResults(deleteResults)
+				printSummary("delete", len(deleteResults), deleteSuccessCount, deleteFailCount, deleteErrors)
+				if err := checkFailures("delete", len(deleteResults), deleteFailCount, maxFailures); err != nil {
+					return err
+				}
+			}
+			return checkFailures("upload", summary.total, summary.failCount, maxFailures)
 		}
-		return nil
+
+		if dryRun {
+			return printUploadPlan(destination, path, glob, useIgnoreList, includeParent)
+		}
+
+		// results are aggregated and written as each upload completes, so that they are never all
+		// held in memory
+		rw, err := newResultsFileWriter(resultsFile)
+		if err != nil {
+			return err
+		}
+		pw, err := newResultsFileWriter(resultsPath)
+		if err != nil {
+			rw.Close()
+			return err
+		}
+		bucket, _, _ := strings.Cut(destination, "/")
+		summary := newResultsSummary()
+		stopProgress := u.Progress.Start(progressInterval)
+		err = Upload(stiface.AdaptClient(client), destination, path, glob, useIgnoreList, includeParent, u,
+			func(result transfer.Results) {
+				summary.add(result)
+				rw.Write(result)
+				printSignedURL(result)
+				if result.Success {
+					pw.Write(newProvenance(bucket, isBuildArtifact, result))
+				}
+			})
+		stopProgress()
+		if closeErr := rw.Close(); err == nil {
+			err = closeErr
+		}
+		if closeErr := pw.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		// print out a summary of successful/failed uploads and a unique list of errors encountered
+		printSummary("upload", summary.total, summary.successCount, summary.failCount, summary.uniqueErrors)
+		printStatusSummary(summary.statusCounts)
+		return checkFailures("upload", summary.total, summary.failCount, maxFailures)
 	},
 }
 
-func Upload(client stiface.Client, destination, path, glob, predefinedACL string, useIgnoreList, includeParent,
-	useGzip bool, parsedHeaders map[string]string, concurrency int) ([]upload.UploadResults, error) {
+// uploadArchive uploads the path as a single archive, and writes and summarizes its result like the
+// results of the other uploads.
+func uploadArchive(client stiface.Client, u upload.Uploader) error {
+	format, err := archive.ParseFormat(archiveFormat)
+	if err != nil {
+		return err
+	}
+	result := UploadArchive(client, destination, path, glob, useIgnoreList, format, archiveName, u)
+	results := []transfer.Results{result}
+
+	if err := writeResultsFile(resultsFile, results); err != nil {
+		return err
+	}
+	if err := writeProvenanceFile(resultsPath, destination, isBuildArtifact, results); err != nil {
+		return err
+	}
+	printSignedURL(result)
+	summary := summarize(results)
+	printSummary("upload", summary.total, summary.successCount, summary.failCount, summary.uniqueErrors)
+	printStatusSummary(summary.statusCounts)
+	return checkFailures("upload", summary.total, summary.failCount, maxFailures)
+}
+
+// UploadArchive streams the files of the path into a single archive object of the format under the
+// destination. The object is named by name, or by the base name of the path with the extension of
+// the format when name is empty.
+func UploadArchive(client stiface.Client, destination, path, glob string, useIgnoreList bool, format archive.Format,
+	name string, u upload.Uploader) transfer.Results {
+	bucket, prefix, _ := strings.Cut(destination, "/")
+	fmt.Printf("Parsed destination into bucketName: %v and prefix: %v\n", bucket, prefix)
+
+	if name == "" {
+		// the absolute path names the archive after the folder for relative paths such as '.'
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return transfer.Results{FilePath: path, Message: fmt.Sprintf("filepath.Abs: %v", err)}
+		}
+		name = filepath.Base(absPath) + "." + string(format)
+	}
+	objectName := name
+	if prefix != "" {
+		objectName = strings.TrimSuffix(prefix, "/") + "/" + name
+	}
+	fmt.Printf("Archiving %v into gs://%v/%v\n", path, bucket, objectName)
+	return u.UploadArchive(path, glob, useIgnoreList, format, objectName, client.Bucket(bucket))
+}
+
+// Upload walks the path and uploads the files as they are found, through a channel bounded by the
+// upload concurrency, so that the first uploads start before a large folder has been fully walked.
+// The report function is called with the result of each upload as it completes. If the walk fails,
+// the files found before the failure are still uploaded and the walk error is returned.
+func Upload(client stiface.Client, destination, path, glob string, useIgnoreList, includeParent bool,
+	u upload.Uploader, report func(transfer.Results)) error {
 	bucket, prefix, _ := strings.Cut(destination, "/")
 	fmt.Printf("Parsed destination into bucketName: %v and prefix: %v\n", bucket, prefix)
+
+	// the totals of the progress are counted by a walk of their own, since the walk of the uploads
+	// only runs ahead of them by the size of the channel. The count is waited for before returning.
+	countErr := make(chan error, 1)
+	if u.Progress != nil {
+		go func() { countErr <- upload.CountPath(path, glob, useIgnoreList, u.Progress) }()
+	} else {
+		countErr <- nil
+	}
+
+	inputs := make(chan upload.UploadInput, u.Concurrency)
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(inputs)
+		walkErr <- upload.WalkPath(path, prefix, glob, useIgnoreList, includeParent, func(input upload.UploadInput) error {
+			u.Rules.ApplyInput(&input, prefix)
+			inputs <- input
+			return nil
+		})
+	}()
+
+	for result := range u.UploadStream(inputs, client.Bucket(bucket)) {
+		report(result)
+	}
+	err := <-walkErr
+	if cerr := <-countErr; err == nil && cerr != nil {
+		err = fmt.Errorf("error counting the files to upload: %w", cerr)
+	}
+	return err
+}
+
+// Sync uploads only the files that are new or have changed compared to the objects under the
+// destination, and deletes the objects that no longer exist locally if deleteExtra is true.
+// When dryRun is true the plan is printed and nothing is uploaded or deleted.
+func Sync(ctx context.Context, client stiface.Client, destination, path, glob string, useIgnoreList, includeParent bool,
+	u upload.Uploader, compare string, deleteExtra, dryRun bool) (uploads, deletes []transfer.Results, err error) {
+	bucket, prefix, _ := strings.Cut(destination, "/")
+	fmt.Printf("Parsed destination into bucketName: %v and prefix: %v\n", bucket, prefix)
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error processing provided path: %v, %w", path, err)
+	}
+	if deleteExtra && !fileInfo.IsDir() {
+		return nil, nil, fmt.Errorf("--delete can only be used when path is a folder")
+	}
+
 	ui, err := upload.ProcessPath(path, prefix, glob, useIgnoreList, includeParent)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	u := upload.Uploader{
-		Gzip:        useGzip,
-		Concurrency: concurrency,
-		ACL:         predefinedACL,
-		Headers:     parsedHeaders,
+	u.Rules.Apply(ui, prefix)
+
+	// the objects of the synced folder all live under the sync root
+	syncRoot := prefix
+	if includeParent {
+		syncRoot = filepath.Join(prefix, path)
+	}
+
+	bh := client.Bucket(bucket)
+	plan, err := u.PlanSync(ctx, ui, bh, syncRoot, compare, deleteExtra)
+	if err != nil {
+		return nil, nil, err
+	}
+	plan.Print()
+	if dryRun {
+		return nil, nil, nil
 	}
 
-	results := u.UploadObjects(ui, client.Bucket(bucket))
-	return results, nil
+	uploads = u.UploadObjects(plan.Upload, bh)
+	deletes = u.DeleteObjects(plan.Delete, bh)
+	return uploads, deletes, nil
+}
+
+// printUploadPlan prints the files that would be uploaded without uploading them.
+func printUploadPlan(destination, path, glob string, useIgnoreList, includeParent bool) error {
+	_, prefix, _ := strings.Cut(destination, "/")
+	count := 0
+	err := upload.WalkPath(path, prefix, glob, useIgnoreList, includeParent, func(input upload.UploadInput) error {
+		fmt.Printf("Upload: %v -> %v\n", input.FilePath, input.ObjectName)
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Upload plan: %d to upload\n", count)
+	return nil
 }
 
 const ConcurrencyDefault = 100
+const RetriesDefault = 3
+const ChunkSizeDefault = 16 * bytesize.MB
+const ProgressFormatText = "text"
+const ProgressFormatJSON = "json"
+const StorageClassList = "'STANDARD', 'NEARLINE', 'COLDLINE', 'ARCHIVE'"
 const PredefinedACLList = "'authenticatedRead', 'bucketOwnerFullControl', 'bucketOwnerRead', 'private', 'projectPrivate', 'publicRead'"
 
+var kmsKeyRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
 // nolint: gochecknoinits
 func init() {
 	rootCmd.AddCommand(uploadCmd)
@@ -135,11 +474,22 @@ func init() {
 	uploadCmd.PersistentFlags().StringVarP(&glob, "glob", "g", "", "Glob pattern to search for within the "+
 		"path parameter when path is a folder")
 	uploadCmd.PersistentFlags().BoolVarP(&useIgnoreList, "ignore-list", "i", true, "Processes the .gcloudignore "+
-		"file present in the top-level of the repository. If true, the file is parsed and any filepaths that match are "+
-		"not uploaded to the storage bucket. Defaults to true.")
+		"file present at the root of the path folder, with the same syntax as gcloud, including '#!include:' "+
+		"directives and negated patterns. Without a .gcloudignore file, .git, .gitignore and the files ignored by "+
+		".gitignore are skipped, as gcloud does. If true, any files and folders that match are not uploaded to the "+
+		"storage bucket. Defaults to true.")
 	uploadCmd.PersistentFlags().BoolVarP(&useGzip, "gzip", "z", true, "Gzip files uploaded, defaults to true. This "+
 		"will override the 'content-encoding' header to have the value of gzip, and will leave all other user provided "+
 		"headers as-is.")
+	uploadCmd.PersistentFlags().StringVar(&gzipExtensions, "gzip-extensions", "", "Comma separated list of file "+
+		"extensions to gzip, such as 'html,css,js'. When set, only files with one of the extensions are gzipped and "+
+		"all other files are uploaded as-is, similar to 'gsutil cp -z'. The gzipped objects are stored with a "+
+		"content-encoding of gzip and are decompressed by clients that do not accept gzip. Compressing files in "+
+		"transit only and storing them uncompressed, as 'gsutil cp -j' does, is not supported, since the storage "+
+		"client cannot send compressed request bodies.")
+	uploadCmd.PersistentFlags().BoolVar(&detectContentType, "detect-content-type", true, "Set the content-type of "+
+		"each object from its file extension, or from its content when the extension is unknown. A content-type "+
+		"provided in --metadata-headers takes precedence. Defaults to true.")
 	uploadCmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", ConcurrencyDefault, "Number of files to "+
 		"simultaneously upload, defaults to 100.")
 	uploadCmd.PersistentFlags().BoolVarP(&includeParent, "parent", "x", true, "Whether the base dir of the path "+
@@ -147,21 +497,328 @@ func init() {
 	uploadCmd.PersistentFlags().StringVarP(&userAgent, "google-apis-user-agent", "u", "", "The user-agent to be "+
 		"applied when calling Google APIs")
 
+	uploadCmd.PersistentFlags().BoolVar(&syncMode, "sync", false, "Only upload files that are new or have changed "+
+		"compared to the objects already under the destination, similar to 'gsutil rsync'.")
+	uploadCmd.PersistentFlags().StringVar(&syncCompare, "sync-compare", upload.SyncCompareChecksum, "How files are "+
+		"compared to existing objects in sync mode. Acceptable values are 'checksum', which compares the MD5 or CRC32C "+
+		"hash, or 'mtime', which compares the size and the modification time recorded by a previous sync.")
+	uploadCmd.PersistentFlags().BoolVar(&deleteExtra, "delete", false, "In sync mode, delete the objects under the "+
+		"destination that no longer exist locally. Cannot be combined with --glob.")
+	uploadCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print what would be uploaded (and deleted in "+
+		"sync mode) without changing anything.")
+
+	uploadCmd.PersistentFlags().IntVar(&retries, "retries", RetriesDefault, "Number of times an upload is retried "+
+		"after a retryable error such as a timeout, a 429 or a 5xx response. Retries back off exponentially. "+
+		"Defaults to 3.")
+	uploadCmd.PersistentFlags().DurationVar(&timeout, "timeout", time.Second*transfer.Timeout, "Timeout for a single "+
+		"upload attempt, defaults to 50s.")
+	uploadCmd.PersistentFlags().IntVar(&maxFailures, "max-failures", 0, "Number of files that may fail to upload "+
+		"before the step fails. Defaults to 0, which fails the step on any error. Set to -1 to never fail the step.")
+	uploadCmd.PersistentFlags().StringVar(&resultsFile, "results-file", "", "Path of a file to write the JSON "+
+		"result of every attempted upload to.")
+	uploadCmd.PersistentFlags().StringVar(&resultsPath, "results-path", "", "Path of a file to write the "+
+		"provenance of every uploaded object to, as a JSON array of its gs:// uri, the sha256 digest of the file, "+
+		"whether it is a build artifact, the object generation and its crc32c, like the publish steps. With "+
+		"--sync, only the files that were uploaded are included.")
+	uploadCmd.PersistentFlags().StringVar(&isBuildArtifact, "is-build-artifact", "true", "If the provenance "+
+		"results should be a build artifact.")
+
+	uploadCmd.PersistentFlags().Var(&chunkSize, "chunk-size", "Size of each chunk of a resumable upload, such as "+
+		"'8MB'. A chunk that fails is retried without restarting the upload. Larger chunks are faster but each "+
+		"concurrent upload buffers a chunk in memory. Rounded up to a multiple of 256KB, defaults to 16MB.")
+	uploadCmd.PersistentFlags().Var(&compositeThreshold, "composite-threshold", "Files of this size or larger, "+
+		"such as '150MB', are split into parts that are uploaded in parallel and composed into a single object. "+
+		"Not applied to gzipped files, so --gzip=false or --gzip-extensions must also be set. Composite objects have a CRC32C but no MD5 "+
+		"hash. Disabled by default.")
+	uploadCmd.PersistentFlags().IntVar(&compositeParts, "composite-parts", upload.MaxComposeComponents, "Number of "+
+		"parts of a parallel composite upload, at most 32. Defaults to 32.")
+
+	uploadCmd.PersistentFlags().StringVar(&headerRulesFile, "header-rules", "", "Path to a YAML or JSON file of "+
+		"rules that apply headers, an acl, a storage class or gzip on/off to the objects matching a glob, relative "+
+		"to the destination. For example 'rules: [{glob: \"*.html\", headers: {cache-control: no-cache}, gzip: "+
+		"true}]'. A glob without a '/' matches file names at any depth. All matching rules are applied in order on "+
+		"top of the other flags, with later rules taking precedence.")
+
+	uploadCmd.PersistentFlags().StringVar(&storageClass, "storage-class", "", "Storage class of the uploaded "+
+		"objects, defaults to the default storage class of the bucket. Acceptable values are one of: "+StorageClassList)
+	uploadCmd.PersistentFlags().StringVar(&kmsKey, "kms-key", "", "Cloud KMS key used to encrypt the uploaded "+
+		"objects, in the format projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>. The "+
+		"Cloud Storage service agent must be able to use the key. Disables parallel composite uploads.")
+	uploadCmd.PersistentFlags().StringVar(&encryptionKeyFile, "encryption-key-file", "", "Path to a file "+
+		"holding a base64 encoded AES-256 customer-supplied encryption key used to encrypt the uploaded objects. "+
+		"Disables parallel composite uploads. Cannot be combined with --kms-key or --encryption-key-env.")
+	uploadCmd.PersistentFlags().StringVar(&encryptionKeyEnv, "encryption-key-env", "", "Name of an environment "+
+		"variable holding a base64 encoded AES-256 customer-supplied encryption key used to encrypt the uploaded "+
+		"objects. Disables parallel composite uploads. Cannot be combined with --kms-key or --encryption-key-file.")
+	uploadCmd.PersistentFlags().BoolVar(&eventBasedHold, "event-based-hold", false, "Place an event-based hold "+
+		"on the uploaded objects.")
+	uploadCmd.PersistentFlags().BoolVar(&temporaryHold, "temporary-hold", false, "Place a temporary hold on the "+
+		"uploaded objects.")
+	uploadCmd.PersistentFlags().DurationVar(&retentionDuration, "retention-duration", 0, "Retain the uploaded "+
+		"objects for this long after the upload starts, such as '720h'. The bucket must have object retention "+
+		"enabled.")
+	uploadCmd.PersistentFlags().StringVar(&retentionMode, "retention-mode", upload.RetentionModeUnlocked,
+		"Mode of the retention set by --retention-duration. Acceptable values are 'Unlocked', which can be "+
+			"changed later, or 'Locked', which cannot be shortened or removed. Defaults to Unlocked.")
+
+	uploadCmd.PersistentFlags().BoolVarP(&noClobber, "no-clobber", "n", false, "Only upload files whose object "+
+		"does not exist yet. A file whose object exists is skipped and reported with the 'already_exists' status, "+
+		"or the 'identical' status when --skip-identical is set and the object is identical. Skipped files do not "+
+		"count towards --max-failures.")
+	uploadCmd.PersistentFlags().Int64Var(&ifGenerationMatch, "if-generation-match", -1, "Only upload the file if "+
+		"its object has this generation, so that a concurrent write is not overwritten. A generation of 0 is the "+
+		"same as --no-clobber. Can only be used when path is a single file.")
+	uploadCmd.PersistentFlags().BoolVar(&skipIdentical, "skip-identical", false, "With --no-clobber or "+
+		"--if-generation-match, count a file whose object exists with the same hash as a success, with the "+
+		"'identical' status, so reruns are idempotent.")
+
+	uploadCmd.PersistentFlags().DurationVar(&signedURLTTL, "signed-url-ttl", 0, "Generate a V4 signed URL, "+
+		"expiring after this long such as '72h', for every uploaded object. The URLs are printed and written to "+
+		"the results file. At most 7 days, requires --signing-key-file or --signing-service-account. Cannot be "+
+		"combined with --encryption-key-file or --encryption-key-env.")
+	uploadCmd.PersistentFlags().StringVar(&signingKeyFile, "signing-key-file", "", "Path to the JSON key file of "+
+		"the service account that signs the URLs of --signed-url-ttl.")
+	uploadCmd.PersistentFlags().StringVar(&signingServiceAccount, "signing-service-account", "", "Email of the "+
+		"service account that signs the URLs of --signed-url-ttl through the IAM signBlob API. The credentials of "+
+		"the step need the Service Account Token Creator role on it.")
+
+	uploadCmd.PersistentFlags().DurationVar(&progressInterval, "progress-interval", 0,
+		"Interval between the reports of the files and bytes uploaded so far, the throughput and the ETA, e.g. "+
+			"10s. Reporting walks the folder a second time to count the totals. Defaults to 0, no reports.")
+	uploadCmd.PersistentFlags().StringVar(&progressFormat, "progress-format", ProgressFormatText, "Format of the "+
+		"progress reports. Acceptable values are 'text' or 'json', which reports a JSON object per line. Defaults "+
+		"to text.")
+	uploadCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Report every uploaded file with its size and "+
+		"the duration of its upload, in the --progress-format.")
+
+	uploadCmd.PersistentFlags().StringVar(&archiveFormat, "archive", "", "Upload the files of the path as a "+
+		"single archive of this format, 'tar.gz' or 'zip', streamed into the object without a temporary file. "+
+		"The sha256 digest of the archive is recorded in the results. --gzip does not apply to the archive, and "+
+		"--timeout applies to the whole archive.")
+	uploadCmd.PersistentFlags().StringVar(&archiveName, "archive-name", "", "Name of the --archive object under "+
+		"the destination prefix. Defaults to the base name of the path with the extension of the format.")
+
 	_ = uploadCmd.MarkPersistentFlagRequired("destination")
 	_ = uploadCmd.MarkPersistentFlagRequired("path")
 }
 
-func summarizeResults(results []upload.UploadResults) (successCount, failCount int, uniqueErrors map[string]bool) {
-	uniqueErrors = map[string]bool{}
+// resultsSummary aggregates the results of a transfer as they complete, without holding on to them.
+type resultsSummary struct {
+	total        int
+	successCount int
+	failCount    int
+	uniqueErrors map[string]bool
+	statusCounts map[string]int
+}
+
+func newResultsSummary() *resultsSummary {
+	return &resultsSummary{uniqueErrors: map[string]bool{}, statusCounts: map[string]int{}}
+}
+
+// add counts the result. A file that was not uploaded because its object already exists is
+// neither a success nor a failure, it is only counted by its status.
+func (s *resultsSummary) add(result transfer.Results) {
+	s.total++
+	switch {
+	case result.Success:
+		s.successCount++
+	case result.Status == upload.StatusAlreadyExists:
+	default:
+		s.failCount++
+		s.uniqueErrors[result.Message] = true
+	}
+	if result.Status != "" {
+		s.statusCounts[result.Status]++
+	}
+}
+
+func summarize(results []transfer.Results) *resultsSummary {
+	summary := newResultsSummary()
+	for _, result := range results {
+		summary.add(result)
+	}
+	return summary
+}
+
+func summarizeResults(results []transfer.Results) (successCount, failCount int, uniqueErrors map[string]bool) {
+	summary := summarize(results)
+	return summary.successCount, summary.failCount, summary.uniqueErrors
+}
+
+// printStatusSummary prints the number of files that were not uploaded because of the
+// no-clobber or generation preconditions, if any.
+func printStatusSummary(statusCounts map[string]int) {
+	if count := statusCounts[upload.StatusAlreadyExists]; count > 0 {
+		fmt.Printf("Already existing count: %d\n", count)
+	}
+	if count := statusCounts[upload.StatusIdentical]; count > 0 {
+		fmt.Printf("Identical existing count: %d\n", count)
+	}
+}
+
+// printSummary prints out a summary of the successful/failed transfers for the action
+// and a unique list of errors encountered
+func printSummary(action string, total, successCount, failCount int, uniqueErrors map[string]bool) {
+	fmt.Printf("Attempted %s of %d files\n", action, total)
+	fmt.Printf("Successful %s count: %d\n", action, successCount)
+	if failCount > 0 {
+		fmt.Printf("Failed %s count: %d\n", action, failCount)
+		fmt.Println("Unique errors encountered:")
+		for k := range uniqueErrors {
+			fmt.Println(k)
+		}
+	}
+}
+
+// checkFailures returns an error if more than maxFailures of the attempted files failed.
+// A negative maxFailures never returns an error.
+func checkFailures(action string, total, failCount, maxFailures int) error {
+	if maxFailures < 0 || failCount <= maxFailures {
+		return nil
+	}
+	return fmt.Errorf("%d of %d files failed to %s, exceeding the allowed maximum of %d", failCount, total, action,
+		maxFailures)
+}
+
+// writeResultsFile writes the results as JSON to the file at path. Nothing is written if path is empty.
+func writeResultsFile(path string, results any) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling results: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing results file %s: %w", path, err)
+	}
+	return nil
+}
+
+// newSigner creates the Signer of the signed URLs for the destination bucket, or returns nil when
+// no signed URLs were requested.
+func newSigner(ctx context.Context, destination string, ttl time.Duration, keyFile,
+	serviceAccount string) (*upload.Signer, error) {
+	if ttl == 0 {
+		return nil, nil
+	}
+	bucket, _, _ := strings.Cut(destination, "/")
+	if keyFile != "" {
+		return upload.NewKeySigner(bucket, ttl, keyFile)
+	}
+	return upload.NewIAMSigner(ctx, bucket, ttl, serviceAccount, option.WithUserAgent(userAgent),
+		option.WithQuotaProject(projID))
+}
+
+// printSignedURL prints the signed URL of the result, if any.
+func printSignedURL(result transfer.Results) {
+	if result.SignedURL != "" {
+		fmt.Printf("Signed URL for %v: %v\n", result.ObjectName, result.SignedURL)
+	}
+}
+
+// Provenance is the result of an uploaded object, in the shape written by the publish steps.
+type Provenance struct {
+	URI             string `json:"uri"`
+	Digest          string `json:"digest"`
+	IsBuildArtifact string `json:"isBuildArtifact"`
+	Generation      int64  `json:"generation"`
+	CRC32C          string `json:"crc32c"`
+}
+
+func newProvenance(bucket, isBuildArtifact string, result transfer.Results) Provenance {
+	return Provenance{
+		URI:             fmt.Sprintf("gs://%s/%s", bucket, result.ObjectName),
+		Digest:          result.Digest,
+		IsBuildArtifact: isBuildArtifact,
+		Generation:      result.Generation,
+		CRC32C:          result.CRC32C,
+	}
+}
+
+// writeProvenanceFile writes the provenance of the successful uploads to the file at path.
+// Nothing is written if path is empty.
+func writeProvenanceFile(path, destination, isBuildArtifact string, results []transfer.Results) error {
+	if path == "" {
+		return nil
+	}
+	bucket, _, _ := strings.Cut(destination, "/")
+	provenance := []Provenance{}
 	for _, result := range results {
 		if result.Success {
-			successCount += 1
-		} else {
-			failCount += 1
-			uniqueErrors[result.Message] = true
+			provenance = append(provenance, newProvenance(bucket, isBuildArtifact, result))
+		}
+	}
+	return writeResultsFile(path, provenance)
+}
+
+// resultsFileWriter streams results into the same JSON array as writeResultsFile, one result at
+// a time. The first error is kept and returned by Close, and a nil writer discards all results.
+type resultsFileWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	count int
+	err   error
+}
+
+// newResultsFileWriter creates the results file at path. It returns a nil writer if path is empty.
+func newResultsFileWriter(path string) (*resultsFileWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating results file %s: %w", path, err)
+	}
+	return &resultsFileWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (rw *resultsFileWriter) Write(result any) {
+	if rw == nil || rw.err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(result, "  ", "  ")
+	if err != nil {
+		rw.err = fmt.Errorf("error marshaling results: %w", err)
+		return
+	}
+
+	sep := ",\n  "
+	if rw.count == 0 {
+		sep = "[\n  "
+	}
+	rw.count++
+	if _, err := rw.w.WriteString(sep); err != nil {
+		rw.err = fmt.Errorf("error writing results file %s: %w", rw.f.Name(), err)
+		return
+	}
+	if _, err := rw.w.Write(data); err != nil {
+		rw.err = fmt.Errorf("error writing results file %s: %w", rw.f.Name(), err)
+	}
+}
+
+// Close terminates the JSON array and closes the file, returning the first error encountered.
+func (rw *resultsFileWriter) Close() error {
+	if rw == nil {
+		return nil
+	}
+
+	end := "\n]"
+	if rw.count == 0 {
+		end = "[]"
+	}
+	if rw.err == nil {
+		if _, err := rw.w.WriteString(end); err != nil {
+			rw.err = fmt.Errorf("error writing results file %s: %w", rw.f.Name(), err)
 		}
 	}
-	return successCount, failCount, uniqueErrors
+	if err := rw.w.Flush(); err != nil && rw.err == nil {
+		rw.err = fmt.Errorf("error writing results file %s: %w", rw.f.Name(), err)
+	}
+	if err := rw.f.Close(); err != nil && rw.err == nil {
+		rw.err = fmt.Errorf("error closing results file %s: %w", rw.f.Name(), err)
+	}
+	return rw.err
 }
 
 func convertHeaderStringToMap(val string) (map[string]string, error) {
@@ -184,6 +841,153 @@ func convertHeaderStringToMap(val string) (map[string]string, error) {
 	return out, nil
 }
 
+// loadHeaderRules loads the header rules file, if any, and validates the headers, acl and storage
+// class of each rule.
+func loadHeaderRules(filePath string) (*upload.Rules, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+
+	rules, err := upload.LoadRules(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules.Rules {
+		if err := validateHeaders(rule.Headers); err != nil {
+			return nil, fmt.Errorf("header rule %q: %w", rule.Glob, err)
+		}
+		if err := validatePredefinedACL(rule.ACL); err != nil {
+			return nil, fmt.Errorf("header rule %q: %w", rule.Glob, err)
+		}
+		if err := validateStorageClass(rule.StorageClass); err != nil {
+			return nil, fmt.Errorf("header rule %q: %w", rule.Glob, err)
+		}
+	}
+	return rules, nil
+}
+
+func validateEncryptionFlags(kmsKey, encryptionKeyFile, encryptionKeyEnv string) error {
+	if encryptionKeyFile != "" && encryptionKeyEnv != "" {
+		return fmt.Errorf("only one of --encryption-key-file and --encryption-key-env can be provided")
+	}
+	if kmsKey != "" && (encryptionKeyFile != "" || encryptionKeyEnv != "") {
+		return fmt.Errorf("--kms-key cannot be used with a customer-supplied encryption key")
+	}
+	if kmsKey != "" && !kmsKeyRegex.MatchString(kmsKey) {
+		return fmt.Errorf("invalid KMS key provided: %v. Must be in the format "+
+			"projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>", kmsKey)
+	}
+	return nil
+}
+
+func validatePreconditionFlags(noClobber bool, ifGenerationMatch int64, skipIdentical, syncMode bool,
+	path string) error {
+	hasGeneration := ifGenerationMatch >= 0
+	if noClobber && hasGeneration {
+		return fmt.Errorf("--no-clobber cannot be used with --if-generation-match")
+	}
+	if skipIdentical && !noClobber && !hasGeneration {
+		return fmt.Errorf("--skip-identical can only be used with --no-clobber or --if-generation-match")
+	}
+	if syncMode && (noClobber || hasGeneration) {
+		return fmt.Errorf("--no-clobber and --if-generation-match cannot be used with --sync")
+	}
+	if ifGenerationMatch > 0 {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("error processing provided path: %v, %w", path, err)
+		}
+		if fileInfo.IsDir() {
+			return fmt.Errorf("--if-generation-match can only be used when path is a single file")
+		}
+	}
+	return nil
+}
+
+func validateProgressFlags(interval time.Duration, format string) error {
+	if interval < 0 {
+		return fmt.Errorf("--progress-interval cannot be negative")
+	}
+	if format != ProgressFormatText && format != ProgressFormatJSON {
+		return fmt.Errorf("unknown progress format provided: %v. Must be one of 'text', 'json'", format)
+	}
+	return nil
+}
+
+// validateSigningFlags checks the signed URL flags. customerKey reports whether the objects are
+// encrypted with a customer-supplied key, whose signed URLs cannot be used without the key.
+func validateSigningFlags(ttl time.Duration, keyFile, serviceAccount string, customerKey bool) error {
+	if ttl == 0 {
+		if keyFile != "" || serviceAccount != "" {
+			return fmt.Errorf("--signing-key-file and --signing-service-account require --signed-url-ttl")
+		}
+		return nil
+	}
+	if ttl < 0 || ttl > upload.MaxSignedURLTTL {
+		return fmt.Errorf("--signed-url-ttl must be positive and at most 7 days, got %v", ttl)
+	}
+	if keyFile != "" && serviceAccount != "" {
+		return fmt.Errorf("cannot use both --signing-key-file and --signing-service-account")
+	}
+	if keyFile == "" && serviceAccount == "" {
+		return fmt.Errorf("--signed-url-ttl requires --signing-key-file or --signing-service-account")
+	}
+	if customerKey {
+		return fmt.Errorf("cannot use --signed-url-ttl with a customer-supplied encryption key, the signed URLs " +
+			"would require the key to read the objects")
+	}
+	return nil
+}
+
+func validateArchiveFlags(format, name string, syncMode, dryRun bool) error {
+	if format == "" {
+		if name != "" {
+			return fmt.Errorf("--archive-name can only be used with --archive")
+		}
+		return nil
+	}
+	if _, err := archive.ParseFormat(format); err != nil {
+		return err
+	}
+	if syncMode {
+		return fmt.Errorf("--archive cannot be used with --sync")
+	}
+	if dryRun {
+		return fmt.Errorf("--archive cannot be used with --dry-run")
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("--archive-name cannot contain '/', the destination sets its prefix")
+	}
+	return nil
+}
+
+func validateRetentionFlags(retentionDuration time.Duration, retentionMode string) error {
+	if retentionDuration < 0 {
+		return fmt.Errorf("--retention-duration cannot be negative")
+	}
+	if retentionMode != upload.RetentionModeUnlocked && retentionMode != upload.RetentionModeLocked {
+		return fmt.Errorf("unknown retention mode provided: %v. Must be one of 'Unlocked', 'Locked'", retentionMode)
+	}
+	return nil
+}
+
+func validateStorageClass(storageClass string) error {
+	if storageClass == "" {
+		return nil
+	}
+
+	knownStorageClasses := map[string]bool{
+		"STANDARD": true,
+		"NEARLINE": true,
+		"COLDLINE": true,
+		"ARCHIVE":  true,
+	}
+	if !knownStorageClasses[storageClass] {
+		return fmt.Errorf("unknown storage class provided: %v. Must be one of "+StorageClassList, storageClass)
+	}
+	return nil
+}
+
 func validatePredefinedACL(acl string) error {
 	if acl == "" {
 		return nil
@@ -205,6 +1009,20 @@ func validatePredefinedACL(acl string) error {
 	return nil
 }
 
+func validateSyncFlags(syncMode bool, compare string, deleteExtra bool, glob string) error {
+	if compare != upload.SyncCompareChecksum && compare != upload.SyncCompareMtime {
+		return fmt.Errorf("unknown sync comparison provided: %v. Must be one of 'checksum', 'mtime'", compare)
+	}
+	if deleteExtra && !syncMode {
+		return fmt.Errorf("--delete can only be used with --sync")
+	}
+	// a glob only selects some of the local files, so every other object would be deleted
+	if deleteExtra && glob != "" {
+		return fmt.Errorf("--delete cannot be used with --glob")
+	}
+	return nil
+}
+
 func validateHeaders(headers map[string]string) error {
 	knownHeaders := upload.GetKnownHeaders()
 
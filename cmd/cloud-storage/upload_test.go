@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
 	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/upload"
+	"github.com/GoogleCloudBuild/cicd-images/internal/archive"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
 )
 
@@ -61,6 +69,11 @@ func (m mockWriter) ObjectAttrs() *storage.ObjectAttrs {
 	return m.attrs
 }
 
+// Attrs returns nil as the mock does not create objects, leaving the results without a generation.
+func (m mockWriter) Attrs() *storage.ObjectAttrs {
+	return nil
+}
+
 func setup(t *testing.T) (c *clientMock, path string) {
 	t.Helper()
 
@@ -85,36 +98,170 @@ func setup(t *testing.T) (c *clientMock, path string) {
 func TestUpload_Success(t *testing.T) {
 	c, path := setup(t)
 
-	want := []upload.UploadResults{
+	want := []transfer.Results{
 		{
 			FilePath:   path,
 			ObjectName: filepath.Base(path),
 			Success:    true,
 		},
 	}
-	got, err := Upload(c, "bucketName", path, "", "", false, false, false, map[string]string{}, 100)
+	u := upload.Uploader{Concurrency: 100, Headers: map[string]string{}}
+	var got []transfer.Results
+	err := Upload(c, "bucketName", path, "", false, false, u, func(result transfer.Results) {
+		got = append(got, result)
+	})
 	if err != nil {
 		t.Fatalf("unexpected err: %s", err)
 	}
 	if diff := cmp.Diff(want, got); diff != "" {
-		t.Errorf("Upload(c, 'bucketName', path, '', '', false, false, false, map[string]string{}, 100) diff (-want +got):\n%s", diff)
+		t.Errorf("Upload(c, 'bucketName', path, '', false, false, u) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUpload_Folder_Success(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{})
+	defer server.Stop()
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: "bucketName"})
+
+	tempDir := t.TempDir()
+	var want []transfer.Results
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("file%02d.txt", i)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+		want = append(want, transfer.Results{
+			FilePath:   filepath.Join(tempDir, name),
+			ObjectName: "prefix/" + name,
+			Success:    true,
+		})
+	}
+
+	// a concurrency lower than the number of files exercises the bounded channel
+	u := upload.Uploader{Concurrency: 4, Headers: map[string]string{}}
+	var got []transfer.Results
+	err := Upload(stiface.AdaptClient(server.Client()), "bucketName/prefix", tempDir, "", false, false, u,
+		func(result transfer.Results) {
+			got = append(got, result)
+		})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].ObjectName < got[j].ObjectName })
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(transfer.Results{}, "Generation", "CRC32C")); diff != "" {
+		t.Errorf("Upload() diff (-want +got):\n%s", diff)
 	}
 }
 
+func TestUpload_Progress_Totals(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{})
+	defer server.Stop()
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: "bucketName"})
+
+	tempDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("file%02d.txt", i)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("1234"), 0600); err != nil {
+			t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+		}
+	}
+
+	// the totals are complete once Upload returns, since the count is waited for
+	u := upload.Uploader{Concurrency: 2, Headers: map[string]string{},
+		Progress: upload.NewProgress(io.Discard, false, false)}
+	err := Upload(stiface.AdaptClient(server.Client()), "bucketName", tempDir, "", false, false, u,
+		func(transfer.Results) {})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	r := u.Progress.Report()
+	if r.FilesTotal != 20 || r.BytesTotal != 80 || r.FilesDone != 20 {
+		t.Errorf("Progress.Report() = %+v, want 20 files and 80 bytes in total, 20 files done", r)
+	}
+}
+
+func TestUploadArchive_ObjectName(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{})
+	defer server.Stop()
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: "bucketName"})
+
+	tempDir := filepath.Join(t.TempDir(), "site")
+	if err := os.Mkdir(tempDir, 0700); err != nil {
+		t.Fatalf("os.Mkdir() = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "index.html"), []byte("index"), 0600); err != nil {
+		t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		destination string
+		path        string
+		archiveName string
+		format      archive.Format
+		want        string
+	}{
+		{name: "DefaultName", destination: "bucketName/prefix", path: tempDir, format: archive.TarGzip,
+			want: "prefix/site.tar.gz"},
+		{name: "NoPrefix", destination: "bucketName", path: tempDir, format: archive.Zip, want: "site.zip"},
+		{name: "ArchiveName", destination: "bucketName/prefix/", path: tempDir, archiveName: "build.zip",
+			format: archive.Zip, want: "prefix/build.zip"},
+		{name: "CurrentFolder", destination: "bucketName/current", path: ".", format: archive.TarGzip,
+			want: "current/site.tar.gz"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.path == "." {
+				chdir(t, tempDir)
+			}
+			u := upload.Uploader{Concurrency: 1}
+			got := UploadArchive(stiface.AdaptClient(server.Client()), test.destination, test.path, "", false,
+				test.format, test.archiveName, u)
+			if !got.Success {
+				t.Fatalf("UploadArchive() failed: %v", got.Message)
+			}
+			if got.ObjectName != test.want {
+				t.Errorf("UploadArchive() object = %q, want %q", got.ObjectName, test.want)
+			}
+			if _, err := server.GetObject("bucketName", test.want); err != nil {
+				t.Errorf("server.GetObject(%q) = %v", test.want, err)
+			}
+		})
+	}
+}
+
+// chdir changes the working directory to dir for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd() = %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("os.Chdir(%q) = %v", dir, err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatalf("os.Chdir(%q) = %v", wd, err)
+		}
+	})
+}
+
 func TestSummarizeResults_Success(t *testing.T) {
 	const errorString1 = "Error writing to GCS"
 	const errorString2 = "Unable to open file"
 
 	tests := []struct {
 		name                 string
-		input                []upload.UploadResults
+		input                []transfer.Results
 		expectedSuccessCount int
 		expectedFailureCount int
 		expectedErr          map[string]bool
 	}{
 		{
 			name: "AllSuccessful",
-			input: []upload.UploadResults{
+			input: []transfer.Results{
 				{
 					Success: true,
 				},
@@ -128,7 +275,7 @@ func TestSummarizeResults_Success(t *testing.T) {
 		},
 		{
 			name: "AllFailure",
-			input: []upload.UploadResults{
+			input: []transfer.Results{
 				{
 					Success: false,
 					Message: errorString1,
@@ -144,7 +291,7 @@ func TestSummarizeResults_Success(t *testing.T) {
 		},
 		{
 			name: "MixedSuccessAndFailure",
-			input: []upload.UploadResults{
+			input: []transfer.Results{
 				{
 					Success: false,
 					Message: errorString1,
@@ -168,6 +315,23 @@ func TestSummarizeResults_Success(t *testing.T) {
 			expectedFailureCount: 3,
 			expectedErr:          map[string]bool{errorString1: true, errorString2: true},
 		},
+		{
+			name: "AlreadyExistsNotFailed",
+			input: []transfer.Results{
+				{
+					Success: false,
+					Status:  upload.StatusAlreadyExists,
+					Message: "object already exists",
+				},
+				{
+					Success: true,
+					Status:  upload.StatusIdentical,
+				},
+			},
+			expectedSuccessCount: 1,
+			expectedFailureCount: 0,
+			expectedErr:          map[string]bool{},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -307,3 +471,499 @@ func TestInvalidPredefinedACL(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSyncFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name        string
+		syncMode    bool
+		compare     string
+		deleteExtra bool
+		glob        string
+		expectedErr error
+	}{
+		{
+			name:        "UnknownCompare",
+			syncMode:    true,
+			compare:     "size",
+			expectedErr: fmt.Errorf("unknown sync comparison provided: size. Must be one of 'checksum', 'mtime'"),
+		},
+		{
+			name:        "DeleteWithoutSync",
+			compare:     upload.SyncCompareChecksum,
+			deleteExtra: true,
+			expectedErr: fmt.Errorf("--delete can only be used with --sync"),
+		},
+		{
+			name:        "DeleteWithGlob",
+			syncMode:    true,
+			compare:     upload.SyncCompareChecksum,
+			deleteExtra: true,
+			glob:        "*.txt",
+			expectedErr: fmt.Errorf("--delete cannot be used with --glob"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateSyncFlags(test.syncMode, test.compare, test.deleteExtra, test.glob)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		failCount   int
+		maxFailures int
+		expectedErr error
+	}{
+		{
+			name:        "NoFailures",
+			failCount:   0,
+			maxFailures: 0,
+		},
+		{
+			name:        "AnyFailure",
+			failCount:   1,
+			maxFailures: 0,
+			expectedErr: fmt.Errorf("1 of 10 files failed to upload, exceeding the allowed maximum of 0"),
+		},
+		{
+			name:        "WithinThreshold",
+			failCount:   2,
+			maxFailures: 2,
+		},
+		{
+			name:        "NeverFail",
+			failCount:   10,
+			maxFailures: -1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := checkFailures("upload", 10, test.failCount, test.maxFailures)
+			if test.expectedErr == nil {
+				if got != nil {
+					t.Errorf("checkFailures() unexpected error: %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("checkFailures() expected error: %v", test.expectedErr)
+			}
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestResultsFileWriter(t *testing.T) {
+	results := []transfer.Results{
+		{FilePath: "a.txt", ObjectName: "prefix/a.txt", Success: true},
+		{FilePath: "b.txt", ObjectName: "prefix/b.txt", Message: "io.Copy: failed"},
+	}
+	tests := []struct {
+		name    string
+		results []transfer.Results
+	}{
+		{name: "Results", results: results},
+		{name: "Empty", results: []transfer.Results{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			streamedPath := filepath.Join(t.TempDir(), "streamed.json")
+			rw, err := newResultsFileWriter(streamedPath)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			for _, result := range test.results {
+				rw.Write(result)
+			}
+			if err := rw.Close(); err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+
+			// the streamed file is identical to the file written at once
+			writtenPath := filepath.Join(t.TempDir(), "written.json")
+			if err := writeResultsFile(writtenPath, test.results); err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			streamed, _ := os.ReadFile(streamedPath)
+			written, _ := os.ReadFile(writtenPath)
+			if diff := cmp.Diff(string(written), string(streamed)); diff != "" {
+				t.Errorf("results file diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteResultsFile(t *testing.T) {
+	resultsPath := filepath.Join(t.TempDir(), "results.json")
+	results := []transfer.Results{
+		{FilePath: "a.txt", ObjectName: "prefix/a.txt", Success: true},
+		{FilePath: "b.txt", ObjectName: "prefix/b.txt", Message: "io.Copy: failed"},
+	}
+	if err := writeResultsFile(resultsPath, results); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	data, err := os.ReadFile(resultsPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%v) = %v", resultsPath, err)
+	}
+	var got []transfer.Results
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if diff := cmp.Diff(results, got); diff != "" {
+		t.Errorf("results file diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteProvenanceFile(t *testing.T) {
+	resultsPath := filepath.Join(t.TempDir(), "provenance.json")
+	results := []transfer.Results{
+		{
+			FilePath:   "a.txt",
+			ObjectName: "prefix/a.txt",
+			Success:    true,
+			Generation: 1700000000000000,
+			CRC32C:     "yZRlqg==",
+			Digest:     "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		},
+		{FilePath: "b.txt", ObjectName: "prefix/b.txt", Message: "io.Copy: failed"},
+		{
+			FilePath:   "c.txt",
+			ObjectName: "prefix/c.txt",
+			Success:    true,
+			Generation: 1700000000000001,
+			CRC32C:     "AAAAAA==",
+			Digest:     "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+	}
+	if err := writeProvenanceFile(resultsPath, "bucketName/prefix", "true", results); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	data, err := os.ReadFile(resultsPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%v) = %v", resultsPath, err)
+	}
+	var got []Provenance
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	want := []Provenance{
+		{
+			URI:             "gs://bucketName/prefix/a.txt",
+			Digest:          "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			IsBuildArtifact: "true",
+			Generation:      1700000000000000,
+			CRC32C:          "yZRlqg==",
+		},
+		{
+			URI:             "gs://bucketName/prefix/c.txt",
+			Digest:          "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			IsBuildArtifact: "true",
+			Generation:      1700000000000001,
+			CRC32C:          "AAAAAA==",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("provenance file diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadHeaderRules_Fail(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       string
+		expectedErr error
+	}{
+		{
+			name:  "InvalidHeader",
+			rules: "rules:\n- glob: \"*.html\"\n  headers:\n    foo: bar\n",
+			expectedErr: fmt.Errorf("header rule \"*.html\": invalid header provided: foo=bar. Must be either a " +
+				"known header with keys 'content-type', 'cache-control', 'content-disposition', 'content-encoding', " +
+				"'content-language', 'custom-time', or it must be a header with a key prefix of 'x-goog-meta-'"),
+		},
+		{
+			name:  "InvalidACL",
+			rules: `{"rules": [{"glob": "assets/**", "acl": "public"}]}`,
+			expectedErr: fmt.Errorf("header rule \"assets/**\": unknown predefined acl provided: public. Must be " +
+				"one of " + PredefinedACLList),
+		},
+		{
+			name:  "InvalidStorageClass",
+			rules: "rules:\n- glob: \"*\"\n  storageClass: COLD\n",
+			expectedErr: fmt.Errorf("header rule \"*\": unknown storage class provided: COLD. Must be one of " +
+				StorageClassList),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(rulesPath, []byte(test.rules), 0600); err != nil {
+				t.Fatalf("os.WriteFile(path, data, 0600) = %v", err)
+			}
+
+			_, got := loadHeaderRules(rulesPath)
+			if got == nil {
+				t.Fatalf("loadHeaderRules() expected error %v", test.expectedErr)
+			}
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateEncryptionFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name              string
+		kmsKey            string
+		encryptionKeyFile string
+		encryptionKeyEnv  string
+		expectedErr       error
+	}{
+		{
+			name:              "FileAndEnv",
+			encryptionKeyFile: "key",
+			encryptionKeyEnv:  "KEY",
+			expectedErr:       fmt.Errorf("only one of --encryption-key-file and --encryption-key-env can be provided"),
+		},
+		{
+			name:             "KMSAndCSEK",
+			kmsKey:           "projects/p/locations/l/keyRings/r/cryptoKeys/k",
+			encryptionKeyEnv: "KEY",
+			expectedErr:      fmt.Errorf("--kms-key cannot be used with a customer-supplied encryption key"),
+		},
+		{
+			name:   "InvalidKMSKey",
+			kmsKey: "projects/p/keyRings/r",
+			expectedErr: fmt.Errorf("invalid KMS key provided: projects/p/keyRings/r. Must be in the format " +
+				"projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateEncryptionFlags(test.kmsKey, test.encryptionKeyFile, test.encryptionKeyEnv)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateRetentionFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name              string
+		retentionDuration time.Duration
+		retentionMode     string
+		expectedErr       error
+	}{
+		{
+			name:              "NegativeDuration",
+			retentionDuration: -time.Hour,
+			retentionMode:     upload.RetentionModeUnlocked,
+			expectedErr:       fmt.Errorf("--retention-duration cannot be negative"),
+		},
+		{
+			name:          "UnknownMode",
+			retentionMode: "Forever",
+			expectedErr:   fmt.Errorf("unknown retention mode provided: Forever. Must be one of 'Unlocked', 'Locked'"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateRetentionFlags(test.retentionDuration, test.retentionMode)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateSigningFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name           string
+		ttl            time.Duration
+		keyFile        string
+		serviceAccount string
+		customerKey    bool
+		expectedErr    error
+	}{
+		{
+			name:        "KeyWithoutTTL",
+			keyFile:     "key.json",
+			expectedErr: fmt.Errorf("--signing-key-file and --signing-service-account require --signed-url-ttl"),
+		},
+		{
+			name:        "TTLTooLong",
+			ttl:         8 * 24 * time.Hour,
+			keyFile:     "key.json",
+			expectedErr: fmt.Errorf("--signed-url-ttl must be positive and at most 7 days, got 192h0m0s"),
+		},
+		{
+			name:           "BothSigners",
+			ttl:            time.Hour,
+			keyFile:        "key.json",
+			serviceAccount: "signer@my-project.iam.gserviceaccount.com",
+			expectedErr:    fmt.Errorf("cannot use both --signing-key-file and --signing-service-account"),
+		},
+		{
+			name:        "NoSigner",
+			ttl:         time.Hour,
+			expectedErr: fmt.Errorf("--signed-url-ttl requires --signing-key-file or --signing-service-account"),
+		},
+		{
+			name:        "CustomerSuppliedKey",
+			ttl:         time.Hour,
+			keyFile:     "key.json",
+			customerKey: true,
+			expectedErr: fmt.Errorf("cannot use --signed-url-ttl with a customer-supplied encryption key, the " +
+				"signed URLs would require the key to read the objects"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateSigningFlags(test.ttl, test.keyFile, test.serviceAccount, test.customerKey)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateProgressFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		format      string
+		expectedErr error
+	}{
+		{
+			name:        "NegativeInterval",
+			interval:    -time.Second,
+			format:      ProgressFormatText,
+			expectedErr: fmt.Errorf("--progress-interval cannot be negative"),
+		},
+		{
+			name:        "UnknownFormat",
+			interval:    time.Second,
+			format:      "xml",
+			expectedErr: fmt.Errorf("unknown progress format provided: xml. Must be one of 'text', 'json'"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateProgressFlags(test.interval, test.format)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateArchiveFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		archiveName string
+		syncMode    bool
+		dryRun      bool
+		expectedErr error
+	}{
+		{
+			name:        "NameWithoutArchive",
+			archiveName: "build.zip",
+			expectedErr: fmt.Errorf("--archive-name can only be used with --archive"),
+		},
+		{
+			name:        "UnknownFormat",
+			format:      "rar",
+			expectedErr: fmt.Errorf("unknown archive format \"rar\", must be one of 'tar.gz', 'zip'"),
+		},
+		{
+			name:        "Sync",
+			format:      "zip",
+			syncMode:    true,
+			expectedErr: fmt.Errorf("--archive cannot be used with --sync"),
+		},
+		{
+			name:        "DryRun",
+			format:      "tar.gz",
+			dryRun:      true,
+			expectedErr: fmt.Errorf("--archive cannot be used with --dry-run"),
+		},
+		{
+			name:        "NameWithPrefix",
+			format:      "zip",
+			archiveName: "builds/build.zip",
+			expectedErr: fmt.Errorf("--archive-name cannot contain '/', the destination sets its prefix"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateArchiveFlags(test.format, test.archiveName, test.syncMode, test.dryRun)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestValidatePreconditionFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name              string
+		noClobber         bool
+		ifGenerationMatch int64
+		skipIdentical     bool
+		syncMode          bool
+		expectedErr       error
+	}{
+		{
+			name:              "NoClobberWithGeneration",
+			noClobber:         true,
+			ifGenerationMatch: 0,
+			expectedErr:       fmt.Errorf("--no-clobber cannot be used with --if-generation-match"),
+		},
+		{
+			name:              "SkipIdenticalAlone",
+			ifGenerationMatch: -1,
+			skipIdentical:     true,
+			expectedErr:       fmt.Errorf("--skip-identical can only be used with --no-clobber or --if-generation-match"),
+		},
+		{
+			name:              "Sync",
+			noClobber:         true,
+			ifGenerationMatch: -1,
+			syncMode:          true,
+			expectedErr:       fmt.Errorf("--no-clobber and --if-generation-match cannot be used with --sync"),
+		},
+		{
+			name:              "GenerationWithFolder",
+			ifGenerationMatch: 5,
+			expectedErr:       fmt.Errorf("--if-generation-match can only be used when path is a single file"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validatePreconditionFlags(test.noClobber, test.ifGenerationMatch, test.skipIdentical,
+				test.syncMode, t.TempDir())
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/transfer"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/upload"
+	"github.com/GoogleCloudBuild/cicd-images/cmd/cloud-storage/pkg/website"
+	"github.com/googleapis/google-cloud-go-testing/storage/stiface"
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+)
+
+// KeepVersionsDefault is the number of website versions kept by default, including the live one.
+const KeepVersionsDefault = 5
+
+var (
+	siteVersion    string
+	versionsPrefix string
+	pointerObject  string
+	mainPageSuffix string
+	notFoundPage   string
+	keepVersions   int
+
+	allowBucketRoot bool
+)
+
+// websiteCmd groups the commands for static websites hosted in GCS
+var websiteCmd = &cobra.Command{
+	Use:   "website",
+	Short: "Manage static websites hosted in GCS",
+}
+
+// websiteDeployCmd represents the website deploy command
+var websiteDeployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Deploy a folder as a new version of a static website",
+	Long: "Upload the folder to a new version prefix, then switch the live site to it once every file is " +
+		"uploaded, by copying the version to the live prefix on the server side or by writing the version to a " +
+		"pointer object. Users are never served a mix of old and new assets, and the live site is left unchanged " +
+		"if any file fails to upload.",
+	PreRunE: func(_ *cobra.Command, _ []string) error {
+		var err error
+		parsedHeaders, err = convertHeaderStringToMap(headers)
+		if err != nil {
+			return err
+		}
+
+		err = validateHeaders(parsedHeaders)
+		if err != nil {
+			return err
+		}
+
+		err = validateWebsiteFlags(destination, siteVersion, versionsPrefix, pointerObject, keepVersions,
+			allowBucketRoot)
+		if err != nil {
+			return err
+		}
+
+		headerRules, err = loadHeaderRules(headerRulesFile)
+		return err
+	},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		ctx := context.Background()
+		client, err := storage.NewClient(ctx, option.WithUserAgent(userAgent), option.WithQuotaProject(projID))
+		if err != nil {
+			return err
+		}
+
+		bucket, prefix, _ := strings.Cut(destination, "/")
+		d := website.Deployer{
+			Uploader: upload.Uploader{
+				Concurrency:       concurrency,
+				Headers:           parsedHeaders,
+				Rules:             headerRules,
+				DetectContentType: detectContentType,
+				Retry:             transfer.Retry{Retries: retries, Timeout: timeout},
+				ChunkSize:         int(chunkSize),
+			},
+			UseIgnoreList:   useIgnoreList,
+			Prefix:          prefix,
+			AllowBucketRoot: allowBucketRoot,
+			VersionsPrefix:  versionsPrefix,
+			PointerObject:   pointerObject,
+			MainPageSuffix:  mainPageSuffix,
+			NotFoundPage:    notFoundPage,
+			KeepVersions:    keepVersions,
+		}
+		version := siteVersion
+		if version == "" {
+			version = website.NewVersion(time.Now())
+		}
+		fmt.Printf("Deploying %v to gs://%v/%v\n", path, bucket, d.VersionPrefix(version))
+
+		results, err := d.Deploy(ctx, stiface.AdaptClient(client).Bucket(bucket), path, version)
+		if writeErr := writeResultsFile(resultsFile, results); err == nil {
+			err = writeErr
+		}
+		printWebsiteSummary(results)
+		return err
+	},
+}
+
+// printWebsiteSummary prints out a summary of the steps of a website deploy.
+func printWebsiteSummary(results website.DeployResults) {
+	successCount, failCount, uniqueErrors := summarizeResults(results.Uploads)
+	printSummary("upload", len(results.Uploads), successCount, failCount, uniqueErrors)
+	if len(results.Copies) > 0 {
+		successCount, failCount, uniqueErrors = summarizeResults(results.Copies)
+		printSummary("copy", len(results.Copies), successCount, failCount, uniqueErrors)
+	}
+	if len(results.Deletes) > 0 {
+		successCount, failCount, uniqueErrors = summarizeResults(results.Deletes)
+		printSummary("delete", len(results.Deletes), successCount, failCount, uniqueErrors)
+	}
+	if len(results.PrunedVersions) > 0 {
+		fmt.Printf("Pruned versions: %v\n", strings.Join(results.PrunedVersions, ", "))
+	}
+}
+
+func validateWebsiteFlags(destination, version, versionsPrefix, pointerObject string, keepVersions int,
+	allowBucketRoot bool) error {
+	if strings.Contains(version, "/") {
+		return fmt.Errorf("--version cannot contain '/'")
+	}
+	if keepVersions < 0 {
+		return fmt.Errorf("--keep-versions cannot be negative")
+	}
+
+	_, prefix, _ := strings.Cut(destination, "/")
+	prefix = strings.Trim(prefix, "/")
+	versionsPrefix = strings.Trim(versionsPrefix, "/")
+	if versionsPrefix == "" {
+		return fmt.Errorf("--versions-prefix cannot be empty")
+	}
+	if pointerObject == "" && prefix == "" && !allowBucketRoot {
+		return fmt.Errorf("copying the site to the root of the bucket deletes every other object of the bucket, " +
+			"set a live prefix in --destination, --pointer-object, or --allow-bucket-root")
+	}
+	return nil
+}
+
+// nolint: gochecknoinits
+func init() {
+	rootCmd.AddCommand(websiteCmd)
+	websiteCmd.AddCommand(websiteDeployCmd)
+
+	websiteDeployCmd.Flags().StringVarP(&path, "path", "f", "", "Path to the folder of the website to deploy.")
+	websiteDeployCmd.Flags().StringVarP(&destination, "destination", "d", "", "Name of the bucket the website is "+
+		"served from. Can be in the format of either <bucketName> or <bucketName>/<prefix>, where the prefix is "+
+		"the live prefix of the site. Objects under the live prefix that are not part of the new version are "+
+		"deleted.")
+	websiteDeployCmd.Flags().StringVar(&siteVersion, "version", "", "Name of the deployed version. Defaults to "+
+		"the UTC time of the deploy, such as '20240102T150405Z'.")
+	websiteDeployCmd.Flags().StringVar(&versionsPrefix, "versions-prefix", website.VersionsPrefixDefault,
+		"Prefix, relative to the live prefix, of the folder of each deployed version, so that the sites of a "+
+			"bucket keep their own versions. Defaults to '_versions'.")
+	websiteDeployCmd.Flags().StringVar(&pointerObject, "pointer-object", "", "Instead of copying the version to "+
+		"the live prefix, switch to it by writing its prefix into this object, for a front end that reads it. "+
+		"The switch is then atomic.")
+	websiteDeployCmd.Flags().BoolVar(&allowBucketRoot, "allow-bucket-root", false, "Allow copying the version to "+
+		"the root of the bucket when the destination has no prefix. Every object of the bucket that is not part of "+
+		"the new version is then deleted, except for the versions. Defaults to false.")
+	websiteDeployCmd.Flags().StringVar(&mainPageSuffix, "main-page-suffix", "", "Set the MainPageSuffix of the "+
+		"bucket website configuration, such as 'index.html'.")
+	websiteDeployCmd.Flags().StringVar(&notFoundPage, "not-found-page", "", "Set the NotFoundPage of the bucket "+
+		"website configuration, such as '404.html'.")
+	websiteDeployCmd.Flags().IntVar(&keepVersions, "keep-versions", KeepVersionsDefault, "Number of versions "+
+		"kept, including the deployed one. Older versions, by the time they were deployed, are deleted. Set to "+
+		"0 to keep every version. Defaults to 5.")
+
+	websiteDeployCmd.Flags().StringVarP(&projID, "project-id", "p", "", "The google cloud project ID that will "+
+		"be used for quota or billing purposes. If set the caller must have 'serviceusage.services.use' permissions.")
+	websiteDeployCmd.Flags().StringVarP(&headers, "metadata-headers", "m", "", "Metadata headers to include with "+
+		"every object of the version, as a list of key/value pairs (i.e. 'cache-control=max-age=300').")
+	websiteDeployCmd.Flags().StringVar(&headerRulesFile, "header-rules", "", "Path to a YAML or JSON file of "+
+		"rules that apply headers, an acl, a storage class or gzip on/off to the objects matching a glob, "+
+		"relative to the version.")
+	websiteDeployCmd.Flags().BoolVar(&detectContentType, "detect-content-type", true, "Set the content-type of "+
+		"each object from its file extension, or from its content when the extension is unknown. Defaults to true.")
+	websiteDeployCmd.Flags().BoolVarP(&useIgnoreList, "ignore-list", "i", true, "Processes the .gcloudignore "+
+		"file present at the root of the path folder, and does not deploy the files that match. Without a "+
+		".gcloudignore file, .git, .gitignore and the files ignored by .gitignore are not deployed.")
+	websiteDeployCmd.Flags().IntVarP(&concurrency, "concurrency", "c", ConcurrencyDefault, "Number of files to "+
+		"simultaneously upload or copy, defaults to 100.")
+	websiteDeployCmd.Flags().IntVar(&retries, "retries", RetriesDefault, "Number of times an upload or copy is "+
+		"retried after a retryable error. Defaults to 3.")
+	websiteDeployCmd.Flags().DurationVar(&timeout, "timeout", time.Second*transfer.Timeout, "Timeout for a single "+
+		"upload or copy attempt, defaults to 50s.")
+	websiteDeployCmd.Flags().StringVarP(&userAgent, "google-apis-user-agent", "u", "", "The user-agent to be "+
+		"applied when calling Google APIs")
+	websiteDeployCmd.Flags().StringVar(&resultsFile, "results-file", "", "Path of a file to write the JSON "+
+		"results of the deploy to.")
+
+	_ = websiteDeployCmd.MarkFlagRequired("destination")
+	_ = websiteDeployCmd.MarkFlagRequired("path")
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateWebsiteFlags_Fail(t *testing.T) {
+	tests := []struct {
+		name            string
+		destination     string
+		version         string
+		versionsPrefix  string
+		pointerObject   string
+		keepVersions    int
+		allowBucketRoot bool
+		expectedErr     error
+	}{
+		{
+			name:           "VersionWithSlash",
+			destination:    "bucketName",
+			version:        "release/1",
+			versionsPrefix: "_versions",
+			expectedErr:    fmt.Errorf("--version cannot contain '/'"),
+		},
+		{
+			name:           "NegativeKeepVersions",
+			destination:    "bucketName",
+			versionsPrefix: "_versions",
+			keepVersions:   -1,
+			expectedErr:    fmt.Errorf("--keep-versions cannot be negative"),
+		},
+		{
+			name:           "EmptyVersionsPrefix",
+			destination:    "bucketName",
+			versionsPrefix: "/",
+			expectedErr:    fmt.Errorf("--versions-prefix cannot be empty"),
+		},
+		{
+			name:           "CopyToBucketRoot",
+			destination:    "bucketName",
+			versionsPrefix: "_versions",
+			expectedErr: fmt.Errorf("copying the site to the root of the bucket deletes every other object of the " +
+				"bucket, set a live prefix in --destination, --pointer-object, or --allow-bucket-root"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := validateWebsiteFlags(test.destination, test.version, test.versionsPrefix, test.pointerObject,
+				test.keepVersions, test.allowBucketRoot)
+
+			if diff := cmp.Diff(test.expectedErr.Error(), got.Error()); diff != "" {
+				t.Errorf("mismatched error: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive streams files into a .tar.gz or .zip archive, one entry at a time, so that a
+// folder can be archived straight into an upload without a temporary file.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Format is the format of an archive.
+type Format string
+
+const (
+	TarGzip Format = "tar.gz"
+	Zip     Format = "zip"
+)
+
+// reproducibleTime is the modification time of every entry of a reproducible archive. It is the
+// earliest time a zip archive can hold.
+var reproducibleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ParseFormat returns the Format named by s, such as "tar.gz", "tgz" or "zip".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "tar.gz", "tgz":
+		return TarGzip, nil
+	case "zip":
+		return Zip, nil
+	default:
+		return "", fmt.Errorf("unknown archive format %q, must be one of 'tar.gz', 'zip'", s)
+	}
+}
+
+// ContentType returns the content type of archives of the format.
+func (f Format) ContentType() string {
+	if f == Zip {
+		return "application/zip"
+	}
+	return "application/gzip"
+}
+
+// Writer writes the entries of an archive into an io.Writer. The archive is complete once Close
+// returns, which does not close the underlying io.Writer.
+type Writer struct {
+	// Reproducible writes every entry with the same modification time and no owner, so that the
+	// same files always produce the same archive.
+	Reproducible bool
+
+	gw *gzip.Writer
+	tw *tar.Writer
+	zw *zip.Writer
+}
+
+// NewWriter creates a Writer of the format into w.
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	switch format {
+	case TarGzip:
+		gw := gzip.NewWriter(w)
+		return &Writer{gw: gw, tw: tar.NewWriter(gw)}, nil
+	case Zip:
+		return &Writer{zw: zip.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q, must be one of 'tar.gz', 'zip'", format)
+	}
+}
+
+// AddFile adds the regular file at filePath as the entry name, a slash separated path relative
+// to the root of the archive.
+func (w *Writer) AddFile(filePath, name string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("File.Stat: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%v is not a regular file", filePath)
+	}
+
+	entry, err := w.create(info, name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, f); err != nil {
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+	return nil
+}
+
+// AddDir adds an entry for the directory described by info, so that empty directories are kept.
+func (w *Writer) AddDir(info fs.FileInfo, name string) error {
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", info.Name())
+	}
+	_, err := w.create(info, name)
+	return err
+}
+
+// create writes the header of the entry and returns the writer of its content.
+func (w *Writer) create(info fs.FileInfo, name string) (io.Writer, error) {
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	if info.IsDir() {
+		name += "/"
+	}
+	modTime := info.ModTime()
+	if w.Reproducible {
+		modTime = reproducibleTime
+	}
+
+	if w.zw != nil {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return nil, fmt.Errorf("zip.FileInfoHeader: %w", err)
+		}
+		header.Name = name
+		header.Modified = modTime
+		if !info.IsDir() {
+			header.Method = zip.Deflate
+		}
+		return w.zw.CreateHeader(header)
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, fmt.Errorf("tar.FileInfoHeader: %w", err)
+	}
+	header.Name = name
+	header.ModTime = modTime
+	if w.Reproducible {
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return nil, fmt.Errorf("tar.Writer.WriteHeader: %w", err)
+	}
+	return w.tw, nil
+}
+
+// Close writes the end of the archive.
+func (w *Writer) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gw.Close()
+}
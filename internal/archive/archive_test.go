@@ -0,0 +1,171 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Format
+		wantErr bool
+	}{
+		{name: "TarGzip", input: "tar.gz", want: TarGzip},
+		{name: "Tgz", input: ".tgz", want: TarGzip},
+		{name: "Zip", input: "ZIP", want: Zip},
+		{name: "Unknown", input: "rar", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseFormat(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseFormat(%q) error = %v, wantErr %v", test.input, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseFormat(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+// writeArchive archives the files of the map, keyed by entry name, and returns the archive.
+func writeArchive(t *testing.T, format Format, reproducible bool, files map[string]string) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	if err != nil {
+		t.Fatalf("NewWriter() = %v", err)
+	}
+	w.Reproducible = reproducible
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("os.Stat() = %v", err)
+	}
+	if err := w.AddDir(info, "empty"); err != nil {
+		t.Fatalf("AddDir() = %v", err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("os.MkdirAll() = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(files[name]), 0600); err != nil {
+			t.Fatalf("os.WriteFile() = %v", err)
+		}
+		if err := w.AddFile(path, name); err != nil {
+			t.Fatalf("AddFile(%v) = %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriter(t *testing.T) {
+	files := map[string]string{"a.txt": "a data", "sub/b.txt": "b data"}
+	want := map[string]string{"empty/": "", "a.txt": "a data", "sub/b.txt": "b data"}
+
+	t.Run("TarGzip", func(t *testing.T) {
+		gr, err := gzip.NewReader(bytes.NewReader(writeArchive(t, TarGzip, false, files)))
+		if err != nil {
+			t.Fatalf("gzip.NewReader() = %v", err)
+		}
+		got := map[string]string{}
+		tr := tar.NewReader(gr)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("tar.Reader.Next() = %v", err)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("io.ReadAll() = %v", err)
+			}
+			got[header.Name] = string(data)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("tar.gz entries diff (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Zip", func(t *testing.T) {
+		data := writeArchive(t, Zip, false, files)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("zip.NewReader() = %v", err)
+		}
+		got := map[string]string{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("zip.File.Open() = %v", err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("io.ReadAll() = %v", err)
+			}
+			got[f.Name] = string(data)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("zip entries diff (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestWriter_Reproducible(t *testing.T) {
+	files := map[string]string{"a.txt": "a data", "sub/b.txt": "b data"}
+	for _, format := range []Format{TarGzip, Zip} {
+		t.Run(string(format), func(t *testing.T) {
+			first := writeArchive(t, format, true, files)
+			// the files of the second archive are written later, with a newer modification time
+			time.Sleep(10 * time.Millisecond)
+			second := writeArchive(t, format, true, files)
+			if !bytes.Equal(first, second) {
+				t.Errorf("reproducible %v archives of the same files differ", format)
+			}
+		})
+	}
+}
+
+func TestWriter_AddFile_NotRegular(t *testing.T) {
+	w, err := NewWriter(io.Discard, TarGzip)
+	if err != nil {
+		t.Fatalf("NewWriter() = %v", err)
+	}
+	if err := w.AddFile(t.TempDir(), "dir"); err == nil {
+		t.Errorf("AddFile() of a directory = nil, want error")
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcloudignore reads .gcloudignore files and matches source files against them the way
+// gcloud does. Patterns use the .gitignore syntax and are relative to the source root, the
+// "#!include:" directive pulls in the patterns of another file from the source root, and an
+// ignored directory excludes everything below it.
+package gcloudignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FileName is the name of the ignore file at the root of the source.
+	FileName = ".gcloudignore"
+
+	includePrefix = "#!include:"
+	gitIgnoreFile = ".gitignore"
+	gitDir        = ".git"
+)
+
+// Matcher holds the patterns of an ignore file. The zero value, and a nil Matcher, ignore nothing.
+type Matcher struct {
+	patterns []pattern
+}
+
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Load reads the .gcloudignore file at the root of the source. A Matcher that ignores nothing is
+// returned if the file does not exist.
+func Load(root string) (*Matcher, error) {
+	f, err := os.Open(filepath.Join(root, FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Matcher{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	return parse(root, FileName, f, true)
+}
+
+// LoadOrDefault reads the .gcloudignore file at the root of the source. As in gcloud, a source
+// without one ignores .gcloudignore, .git and .gitignore, along with the files ignored by its
+// .gitignore file.
+func LoadOrDefault(root string) (*Matcher, error) {
+	if _, err := os.Stat(filepath.Join(root, FileName)); err == nil {
+		return Load(root)
+	}
+
+	defaults := FileName + "\n" + gitDir + "\n" + gitIgnoreFile + "\n"
+	if _, err := os.Stat(filepath.Join(root, gitIgnoreFile)); err == nil {
+		defaults += includePrefix + gitIgnoreFile + "\n"
+	}
+	return Parse(root, defaults)
+}
+
+// Parse compiles the lines of an ignore file. Included files are read relative to root.
+func Parse(root, content string) (*Matcher, error) {
+	return parse(root, FileName, strings.NewReader(content), true)
+}
+
+func parse(root, name string, r io.Reader, allowInclude bool) (*Matcher, error) {
+	m := &Matcher{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+
+		if include, ok := strings.CutPrefix(line, includePrefix); ok {
+			included, err := parseInclude(root, name, strings.TrimSpace(include), allowInclude)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, lineNum, err)
+			}
+			m.patterns = append(m.patterns, included.patterns...)
+			continue
+		}
+
+		p, ok, err := compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNum, err)
+		}
+		if ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// parseInclude reads the patterns of an included file. As in gcloud, the file must be in the
+// source root and cannot include other files.
+func parseInclude(root, from, include string, allowInclude bool) (*Matcher, error) {
+	if !allowInclude {
+		return nil, fmt.Errorf("included file %s cannot include other files", from)
+	}
+	if include == "" || strings.ContainsAny(include, `/\`) {
+		return nil, fmt.Errorf("can only include files in the same directory, got %q", include)
+	}
+
+	f, err := os.Open(filepath.Join(root, include))
+	if err != nil {
+		return nil, fmt.Errorf("failed to include %s: %w", include, err)
+	}
+	defer f.Close()
+
+	return parse(root, include, f, false)
+}
+
+// compile converts a single .gitignore line into a pattern. Blank lines and comments report false.
+func compile(line string) (pattern, bool, error) {
+	line = trimTrailingSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false, nil
+	}
+
+	p := pattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// a pattern with a separator other than a trailing one is relative to the root,
+	// otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return pattern{}, false, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				c = line[i]
+			}
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		case '*':
+			if i+1 < len(line) && line[i+1] == '*' {
+				i++
+				switch {
+				case i+1 < len(line) && line[i+1] == '/':
+					// '**/' also matches zero folders
+					i++
+					sb.WriteString("(?:.*/)?")
+				default:
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(line[i:], ']')
+			if end == -1 {
+				return pattern{}, false, fmt.Errorf("invalid pattern %q: unterminated character class", line)
+			}
+			class := line[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return pattern{}, false, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	p.re = re
+	return p, true, nil
+}
+
+// trimTrailingSpace removes trailing spaces that are not escaped with a backslash.
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Match reports whether the entry is ignored by the patterns themselves, where the last
+// matching pattern wins. The relPath is slash separated and relative to the source root. It
+// does not check the parent directories, see Ignored.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(relPath) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// Ignored reports whether the entry, or any of its parent directories, is ignored. As with git,
+// a negated pattern cannot include a file again once its directory is ignored.
+func (m *Matcher) Ignored(relPath string, isDir bool) bool {
+	relPath = path.Clean(relPath)
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if m.Match(dir, true) {
+			return true
+		}
+	}
+	return m.Match(relPath, isDir)
+}
+
+// Walk walks the files under root in lexical order, calling fn for every entry that is not
+// ignored. Ignored directories are pruned without being read. The root itself is not passed to fn.
+func (m *Matcher) Walk(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(p, d, err)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		if m.Match(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(p, d, nil)
+	})
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloudignore
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIgnored(t *testing.T) {
+	m, err := Parse("", strings.Join([]string{
+		"# comment",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"docs/*.md",
+		"node_modules/",
+		"**/testdata/**",
+		`\#hash`,
+		"trailing   ",
+	}, "\n"))
+	if err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+
+	testCases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{path: "app.log", ignored: true},
+		{path: "src/app.log", ignored: true},
+		{path: "keep.log", ignored: false},
+		{path: "build", isDir: true, ignored: true},
+		{path: "build/out.bin", ignored: true},
+		{path: "src/build/out.bin", ignored: false},
+		{path: "docs/readme.md", ignored: true},
+		{path: "docs/api/readme.md", ignored: false},
+		{path: "node_modules", ignored: false},
+		{path: "web/node_modules/pkg/index.js", ignored: true},
+		{path: "pkg/testdata/golden.txt", ignored: true},
+		{path: "#hash", ignored: true},
+		{path: "trailing", ignored: true},
+		{path: "main.go", ignored: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := m.Ignored(tc.path, tc.isDir); got != tc.ignored {
+				t.Errorf("Ignored(%q, %v) = %v, want %v", tc.path, tc.isDir, got, tc.ignored)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		FileName:     "#!include:.gitignore\n!debug.log\n",
+		".gitignore": "*.log\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0600); err != nil {
+			t.Fatalf("os.WriteFile() = %v", err)
+		}
+	}
+
+	m, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if !m.Ignored("app.log", false) {
+		t.Errorf("Ignored(app.log) = false, want the included pattern to apply")
+	}
+	if m.Ignored("debug.log", false) {
+		t.Errorf("Ignored(debug.log) = true, want the negation after the include to apply")
+	}
+}
+
+func TestLoad_NoFile(t *testing.T) {
+	m, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if m.Ignored("anything", false) {
+		t.Errorf("Ignored() = true without an ignore file")
+	}
+}
+
+func TestLoadOrDefault(t *testing.T) {
+	testCases := []struct {
+		name    string
+		files   map[string]string
+		ignored map[string]bool
+	}{
+		{
+			name:  "Default rules",
+			files: map[string]string{".gitignore": "*.log\n"},
+			ignored: map[string]bool{
+				".git":          true,
+				".gitignore":    true,
+				".gcloudignore": true,
+				"app.log":       true,
+				"main.go":       false,
+			},
+		},
+		{
+			name:  "Default rules without .gitignore",
+			files: map[string]string{},
+			ignored: map[string]bool{
+				".git":    true,
+				"app.log": false,
+			},
+		},
+		{
+			name:  "Ignore file replaces the default rules",
+			files: map[string]string{FileName: "*.tmp\n", ".gitignore": "*.log\n"},
+			ignored: map[string]bool{
+				".git":    false,
+				"app.log": false,
+				"a.tmp":   true,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, data := range tc.files {
+				if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0600); err != nil {
+					t.Fatalf("os.WriteFile() = %v", err)
+				}
+			}
+
+			m, err := LoadOrDefault(root)
+			if err != nil {
+				t.Fatalf("LoadOrDefault() = %v", err)
+			}
+			for path, ignored := range tc.ignored {
+				if got := m.Ignored(path, path == ".git"); got != ignored {
+					t.Errorf("Ignored(%q) = %v, want %v", path, got, ignored)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_Fail(t *testing.T) {
+	testCases := []struct {
+		name          string
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			name:          "Missing include",
+			files:         map[string]string{FileName: "#!include:.gitignore\n"},
+			expectedError: ".gcloudignore:1: failed to include .gitignore",
+		},
+		{
+			name:          "Include outside the root",
+			files:         map[string]string{FileName: "#!include:sub/.gitignore\n"},
+			expectedError: `.gcloudignore:1: can only include files in the same directory, got "sub/.gitignore"`,
+		},
+		{
+			name: "Nested include",
+			files: map[string]string{
+				FileName:     "#!include:.gitignore\n",
+				".gitignore": "#!include:.other\n",
+			},
+			expectedError: ".gcloudignore:1: .gitignore:1: included file .gitignore cannot include other files",
+		},
+		{
+			name:          "Invalid pattern",
+			files:         map[string]string{FileName: "*.go\n[abc\n"},
+			expectedError: `.gcloudignore:2: invalid pattern "[abc": unterminated character class`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, data := range tc.files {
+				if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0600); err != nil {
+					t.Fatalf("os.WriteFile() = %v", err)
+				}
+			}
+
+			_, err := Load(root)
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expectedError) {
+				t.Errorf("Load() error = %v, want prefix %q", err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a/keep.txt", "a/skip.log", "vendor/lib/x.go", "z.txt"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("os.MkdirAll() = %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatalf("os.WriteFile() = %v", err)
+		}
+	}
+	m, err := Parse(root, "*.log\nvendor/\n!vendor/lib/x.go\n")
+	if err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+
+	var got []string
+	err = m.Walk(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() = %v", err)
+	}
+
+	want := []string{"a", "a/keep.txt", "z.txt"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Walk() diff (-want +got):\n%s", diff)
+	}
+}